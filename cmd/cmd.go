@@ -1,101 +1,1499 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	grep "github.com/one2n-go-bootcamp/go-grep/pkg"
 )
 
-func run(fSys fs.FS, stdin io.Reader, out io.Writer, keyword, path, fileWName string, linesBeforeMatch int, linesAfterMatch int, ignoreCase, searchDir, lineCount bool) {
-	option := grep.GrepOptions{}
-
-	// stdin case
-	if path == "" {
-		option.Stdin = stdin
-		option.Keyword = keyword
-		option.FileWName = fileWName
-		option.IgnoreCase = ignoreCase
-		option.LinesBeforeMatch = linesBeforeMatch
-		option.LinesAfterMatch = linesAfterMatch
-		option.SearchDir = searchDir
-		option.LineCount = lineCount
+// holds the arguments and flags passed from the command line
+type input struct {
+	stdin io.Reader
+	output io.Writer
+	errOutput io.Writer
+	keyword string
+	path string
+	fileWName string
+	linesBeforeMatch int
+	linesAfterMatch int
+	ignoreCase bool
+	searchDir bool
+	lineCount bool
+	countMatches bool
+	onlyMatching bool
+	maxMatchesPerLine int
+	regexp bool
+	lineNumber bool
+	json bool
+	force bool
+	append bool
+	withFileName bool
+	null bool
+	encoding string
+	encodingErrorMode string
+	excludeDir []string
+	noDefaultExcludes bool
+	listFiles bool
+	includeExt []string
+	excludeExt []string
+	filesWithMatches bool
+	quiet bool
+	stats bool
+	summary bool		// prints the totals instead of the lines
+	byExtension bool		// includes the matches by extension in summary
+	multiline bool
+	replace *string
+	inPlace bool
+	backupSuffix string
+	countFiles bool
+	filesFrom string
+	noMessages bool
+	directories string
+	parallelFile bool
+	nameOnly bool
+	heading bool
+	trim bool
+	expandTabs int
+	pathFilter string
+	timeout time.Duration
+	tar bool
+	zip bool
+	groupSeparator string
+	noGroupSeparator bool
+	lineDelim string
+	sort string
+	sortReverse bool
+	maxTotal int
+	report bool
+	progress bool
+	countAll bool
+	pathMode string
+	pre string
+	excludeEmpty bool
+	join string
+	noUnicode bool
+	flushInterval time.Duration
+	allKeywords []string
+	butNot string
+	patterns []string		// literal patterns of -e
+	regexPatterns []string		// regexp patterns of --eregex
+	skipBlank bool
+	head int
+	tail int
+	lines string		// range of line numbers, start:end
+	byteOffset bool
+	pathSeparator string		// separator of the path elements in output, as they are if empty
+	mark []string		// markers before and after each match
+	noFollowSymlink bool
+	snippet int		// characters around each match in its snippet
+	field int		// field of the line to match, whole line if 0
+	fieldSep string
+	patternStdin bool		// keyword is the first line of stdin
+	colorColumns string		// GREP_COLORS like spec, output is colored only if it's passed
+	palette palette		// colors parsed from colorColumns
+	follow bool		// keeps searching the lines appended to the file
+	stripPrefix int		// count of leading components removed from the paths in output
+	plural bool
+	ignoreBinaryMatches bool
+	text bool
+}
+
+var errInPlaceStdin = errors.New("in place edit is not supported for stdin")
+var errInPlaceDecoded = errors.New("in place edit is not supported with --encoding, --pre and --multiline, since the file is rewritten from its raw lines")
+var errInvalidDirectories = errors.New("invalid directories action, expected one of read, skip and recurse")
+var errInvalidLineDelim = errors.New("invalid line delimiter, expected a single byte")
+var errInvalidSort = errors.New("invalid sort key, expected one of path, modified and count")
+var errInvalidPathMode = errors.New("invalid path mode, expected one of relative and absolute")
+var errStdinTerminal = errors.New("stdin is a terminal, pass a path or pipe the input, eg: cat file.txt | grep keyword")
+var errStdinListedTwice = errors.New("- is listed more than once in --filesFrom, stdin is searched only for the first one")
+var errInvalidEncodingErrorMode = errors.New("invalid encoding error mode, expected one of strict, replace and skip")
+var errInvalidPathSeparator = errors.New("invalid path separator, expected a single character, eg: \\")
+var errInvalidMark = errors.New("invalid markers, expected the ones before and after the match, eg: [[,]]")
+var errInvalidLineRange = errors.New("invalid line range, expected start:end with start not after end, eg: 10:20")
+var errInvalidColors = errors.New("invalid colors, expected name=SGR pairs separated by :, eg: ms=01;31:fn=35")
+var errColorsMark = errors.New("--mark can't be passed with --colorColumns, since the matches are colored")
+var errFollowPath = errors.New("follow needs the path of a single file")
+var errNoPatternStdin = errors.New("no pattern in stdin, expected it on the first line")
+
+// forms of the paths in output
+const (
+	pathRelative = "relative"		// as passed by user, eg: ../testdata/file.txt
+	pathAbsolute = "absolute"
+)
+
+// actions on a directory path without -r, same as -d of GNU grep
+const (
+	directoriesRead = "read"		// tries to read it, which fails with is a directory error
+	directoriesSkip = "skip"
+	directoriesRecurse = "recurse"	// searches it like -r
+)
+
+// modes for writing the output to file
+type writeMode int
+
+const (
+	createMode writeMode = iota		// refuses to write if file exists
+	overwriteMode
+	appendMode
+)
+
+// exit status of the program, same as GNU grep
+const (
+	exitMatch = 0
+	exitNoMatch = 1
+	exitError = 2		// an error occurred, even if some lines matched
+	exitTimeout = 3		// timeout elapsed, output has the results found till then
+)
+
+// patterns of -e and --eregex for the search, literal ones come first
+func patternsOf(input input) []grep.Pattern {
+	var patterns []grep.Pattern
+	for _, p := range input.patterns {
+		patterns = append(patterns, grep.Pattern{Text: p})
+	}
+	for _, p := range input.regexPatterns {
+		patterns = append(patterns, grep.Pattern{Text: p, Regexp: true})
+	}
+	return patterns
+}
+
+// parses the line range like 10:20, 10: or :20 into the start and end, 0 for the end left out
+// empty range is the whole file
+func parseLineRange(s string) ([2]int, bool) {
+	var lineRange [2]int
+	if s == "" {
+		return lineRange, true
+	}
+	start, end, found := strings.Cut(s, ":")
+	if !found {
+		return lineRange, false
+	}
+	for i, num := range []string{start, end} {
+		if num == "" {
+			continue
+		}
+		n, err := strconv.Atoi(num)
+		if err != nil || n < 1 {
+			return lineRange, false
+		}
+		lineRange[i] = n
+	}
+	if lineRange[1] > 0 && lineRange[0] > lineRange[1] {
+		return lineRange, false
+	}
+	return lineRange, true
+}
+
+// runs the search and prints the output, returns the exit status
+func run(fSys fs.FS, input input) int {
+	// count of every searched file, including the ones without matches
+	if input.countAll {
+		input.lineCount = true
+	}
+
+	// keyword is read before anything else, so that the rest of stdin is left for - in --filesFrom
+	if input.patternStdin {
+		if isTerminalInput(input.stdin) {
+			fmt.Fprintln(input.output, errStdinTerminal.Error())
+			return exitError
+		}
+		keyword, err := readPatternLine(input.stdin)
+		if err != nil {
+			fmt.Fprintln(input.output, err.Error())
+			return exitError
+		}
+		input.keyword = keyword
+	}
+
+	option := grep.GrepOptions{
+		Keyword: input.keyword,
+		AllKeywords: input.allKeywords,
+		ButNot: input.butNot,
+		Patterns: patternsOf(input),
+		SkipBlank: input.skipBlank,
+		HeadLines: input.head,
+		ByteOffset: input.byteOffset,
+		NoFollowSymlink: input.noFollowSymlink,
+		SnippetRadius: input.snippet,
+		Plural: input.plural,
+		IgnoreBinaryMatches: input.ignoreBinaryMatches,
+		Text: input.text,
+		FieldNum: input.field,
+		FieldSep: input.fieldSep,
+		TailLines: input.tail,
+		FileWName: input.fileWName,
+		IgnoreCase: input.ignoreCase,
+		LinesBeforeMatch: input.linesBeforeMatch,
+		LinesAfterMatch: input.linesAfterMatch,
+		SearchDir: input.searchDir,
+		LineCount: input.lineCount,
+		CountMatches: input.countMatches,
+		OnlyMatching: input.onlyMatching,
+		MaxMatchesPerLine: input.maxMatchesPerLine,
+		Regexp: input.regexp,
+		Encoding: input.encoding,
+		EncodingErrorMode: input.encodingErrorMode,
+		ExcludeDir: input.excludeDir,
+		NoDefaultExcludes: input.noDefaultExcludes,
+		ListFiles: input.listFiles,
+		IncludeExt: input.includeExt,
+		ExcludeExt: input.excludeExt,
+		FilesWithMatches: input.filesWithMatches || input.quiet || input.report,
+		Multiline: input.multiline,
+		Replace: input.replace,
+		ParallelFile: input.parallelFile,
+		NameOnly: input.nameOnly,
+		PathFilter: input.pathFilter,
+		SortBy: input.sort,
+		SortReverse: input.sortReverse,
+		TotalLimit: input.maxTotal,
+		Report: input.report || input.countAll,
+		Pre: input.pre,
+		ExcludeEmpty: input.excludeEmpty,
+		ASCII: input.noUnicode,
+	}
+
+	switch input.directories {
+	case "", directoriesRead, directoriesSkip, directoriesRecurse:
+	default:
+		fmt.Fprintln(input.output, fmt.Errorf("%s: %w", input.directories, errInvalidDirectories).Error())
+		return exitError
+	}
+
+	switch input.pathMode {
+	case "", pathRelative, pathAbsolute:
+	default:
+		fmt.Fprintln(input.output, fmt.Errorf("%s: %w", input.pathMode, errInvalidPathMode).Error())
+		return exitError
+	}
+
+	if len(input.mark) != 0 && len(input.mark) != 2 {
+		fmt.Fprintln(input.output, fmt.Errorf("%s: %w", strings.Join(input.mark, ","), errInvalidMark).Error())
+		return exitError
+	}
+	if len(input.mark) == 2 {
+		option.MarkBefore, option.MarkAfter = input.mark[0], input.mark[1]
+	}
+
+	// matches are colored by the markers, which are the escape codes here
+	if input.colorColumns != "" {
+		if len(input.mark) > 0 {
+			fmt.Fprintln(input.output, errColorsMark.Error())
+			return exitError
+		}
+		p, err := parsePalette(input.colorColumns)
+		if err != nil {
+			fmt.Fprintln(input.output, fmt.Errorf("%s: %w", input.colorColumns, err).Error())
+			return exitError
+		}
+		input.palette = p
+		if p.match != "" {
+			option.MarkBefore, option.MarkAfter = colorStart(p.match), colorEnd
+		}
+	}
+
+	if utf8.RuneCountInString(input.pathSeparator) > 1 {
+		fmt.Fprintln(input.output, fmt.Errorf("%s: %w", input.pathSeparator, errInvalidPathSeparator).Error())
+		return exitError
+	}
+
+	switch input.encodingErrorMode {
+	case "", grep.EncodingErrorStrict, grep.EncodingErrorReplace, grep.EncodingErrorSkip:
+	default:
+		fmt.Fprintln(input.output, fmt.Errorf("%s: %w", input.encodingErrorMode, errInvalidEncodingErrorMode).Error())
+		return exitError
+	}
+
+	switch input.sort {
+	case "", grep.SortPath, grep.SortModified, grep.SortCount:
+	default:
+		fmt.Fprintln(input.output, fmt.Errorf("%s: %w", input.sort, errInvalidSort).Error())
+		return exitError
+	}
+
+	// lines are split and joined at the delimiter, new line if it's not passed
+	if len(input.lineDelim) > 1 {
+		fmt.Fprintln(input.output, fmt.Errorf("%q: %w", input.lineDelim, errInvalidLineDelim).Error())
+		return exitError
+	}
+	delim := byte('\n')
+	if input.lineDelim != "" {
+		delim = input.lineDelim[0]
+	}
+	option.LineDelim = delim
+
+	lineRange, ok := parseLineRange(input.lines)
+	if !ok {
+		fmt.Fprintln(input.output, fmt.Errorf("%s: %w", input.lines, errInvalidLineRange).Error())
+		return exitError
+	}
+	option.LineRange = lineRange
+
+	// conflicting options are usage errors, reported before anything is read
+	if err := option.Validate(); err != nil {
+		fmt.Fprintln(input.output, err.Error())
+		return exitError
+	}
+
+	// reading from an interactive terminal would wait for the input forever
+	readsStdin := (input.path == "" && input.filesFrom == "") || input.filesFrom == "-"
+	if readsStdin && isTerminalInput(input.stdin) {
+		fmt.Fprintln(input.output, errStdinTerminal.Error())
+		return exitError
+	}
+
+	// stops the search after timeout, results found till then are printed
+	if input.timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), input.timeout)
+		defer cancel()
+		option.Context = ctx
+	}
+
+	// GrepR can only count the error for invalid path filter, so it's checked here to print it
+	if _, err := regexp.Compile(input.pathFilter); err != nil {
+		fmt.Fprintln(input.output, err.Error())
+		return exitError
+	}
+
+	if input.path == "" {
+		// stdin case
+		option.Stdin = input.stdin
 	} else {
 		// file case
-		fullPath, err := getFullPath(fSys, path)
+		fullPath, err := getFullPath(fSys, input.path)
 		if err != nil {
-			fmt.Println(err)
-			return
+			printFileError(input, err)
+			return exitError
 		}
 
-		option.Keyword = keyword
-		option.OrigPath = path
+		option.OrigPath = input.path
 		option.Path = fullPath
-		option.FileWName = fileWName
-		option.IgnoreCase = ignoreCase
-		option.LinesBeforeMatch = linesBeforeMatch
-		option.LinesAfterMatch = linesAfterMatch
-		option.SearchDir = searchDir
-		option.LineCount = lineCount
+	}
+
+	// acts on the directory path as per the directories option
+	if input.path != "" && !input.searchDir {
+		info, err := fs.Stat(fSys, option.Path)
+		if err == nil && info.IsDir() {
+			switch input.directories {
+			case directoriesSkip:
+				return exitNoMatch
+			case directoriesRecurse:
+				input.searchDir = true
+				option.SearchDir = true
+			}
+		}
+	}
+
+	// printing the matches in the lines appended to the file, till interrupted
+	if input.follow {
+		if input.path == "" || input.searchDir || input.filesFrom != "" || input.tar || input.zip {
+			fmt.Fprintln(input.output, errFollowPath.Error())
+			return exitError
+		}
+		return runFollow(input, option, delim)
+	}
+
+	// rewriting the files instead of printing the result
+	if input.inPlace {
+		// files are rewritten from their raw lines, so the matches can't be found in the decoded (or preprocessed) content
+		if input.encoding != "" || input.pre != "" || input.multiline {
+			fmt.Fprintln(input.output, errInPlaceDecoded.Error())
+			return exitError
+		}
+		matched, hadError, err := runInPlace(fSys, input, option)
+		if err != nil {
+			fmt.Fprintln(input.output, err.Error())
+			return exitError
+		}
+		return exitStatus(input, matched, hadError)
 	}
 
 	var result []grep.GrepResult
-	if searchDir {
-		result = grep.GrepR(fSys, option)
+	var stats grep.GrepStats
+	walked := false
+	hadError := false
+	if input.filesFrom != "" {
+		filesResult, err := grepFilesFrom(fSys, input, option)
+		if err != nil {
+			fmt.Fprintln(input.output, err.Error())
+			return exitError
+		}
+		result, hadError = dropErrors(input, filesResult)
+	} else if input.tar {
+		result, hadError = dropErrors(input, grep.GrepTar(fSys, option))
+	} else if input.zip {
+		result, hadError = dropErrors(input, grep.GrepZip(fSys, option))
+	} else if input.searchDir || input.listFiles || input.nameOnly {
+		// progress line is only for a terminal, it'd be noise in a file or pipe
+		if input.progress && isTerminal(input.errOutput) {
+			option.ProgressFunc = progressPrinter(input.errOutput)
+		}
+		// progress line would be mixed with the lines printed as they are found
+		if canStream(input) && option.ProgressFunc == nil {
+			return runStream(fSys, input, option, delim)
+		}
+		result, stats = grep.GrepRStats(fSys, option)
+		walked = true
+		hadError = reportWalk(input, option, stats)
 	} else {
 		grepResult := grep.Grep(fSys, option)
-		if grepResult.Error != nil {
-			fmt.Fprintln(out, grepResult.Error.Error())
-			return
+		if grepResult.Error != nil && !isTimeout(grepResult.Error) {
+			printFileError(input, grepResult.Error)
+			return exitError
+		}
+		// notes the file filtered out by --include or --exclude, since it was passed explicitly
+		if grepResult.Skipped != "" && !input.noMessages {
+			fmt.Fprintf(input.errOutput, "%s: %s filter, skipped\n", input.path, grepResult.Skipped)
 		}
 		result = append(result, grepResult)
 	}
+	status := exitStatus(input, anyMatched(input, result), hadError)
+	if option.Context != nil && isTimeout(option.Context.Err()) {
+		fmt.Fprintf(input.errOutput, "timed out after %s, printing the results found till then\n", input.timeout)
+		status = exitTimeout
+	}
+
+	// nothing is printed in quiet mode
+	if input.quiet {
+		return status
+	}
 
 	var outputArr []string
-	// preparing to print the result on the basis of options
+	if input.summary {
+		// files searched are known only from the walk in -r, the results have every file searched otherwise
+		if !walked {
+			stats = grep.ResultStats(result)
+		}
+		outputArr = summaryOutput(input, stats)
+	} else if input.countFiles {
+		outputArr = []string{strconv.Itoa(countMatchedFiles(result))}
+	} else if input.json {
+		jsonArr, err := jsonOutput(input, result)
+		if err != nil {
+			fmt.Fprintln(input.output, err.Error())
+			return exitError
+		}
+		outputArr = jsonArr
+	} else {
+		outputArr = textOutput(input, result)
+	}
+
+	// writing to file if file name was passed
+	if input.fileWName != "" {
+		err := writeToFile(input.fileWName, joinLines(outputArr, delim), getWriteMode(input))
+		if err != nil {
+			fmt.Fprintln(input.output, err.Error())
+			return exitError
+		}
+		return status
+	}
+
+	fmt.Fprint(input.output, joinLines(outputArr, delim))
+	return status
+}
+
+// checks if any file in result matched
+// listed files are not searched, so listing any file counts as a match
+func anyMatched(input input, result []grep.GrepResult) bool {
 	for _, res := range result {
-		if searchDir && option.LineCount {
-			outputArr = append(outputArr, fmt.Sprintf("%s:%d\n", res.Path, res.LineCount))
-		} else if searchDir && !option.LineCount {
-			for _, line := range res.MatchedLines {
-				outputArr = append(outputArr, fmt.Sprintf("%s:%s\n", res.Path, line))
+		if res.Matched || input.listFiles {
+			return true
+		}
+	}
+	return false
+}
+
+// checks if the results of -r can be printed as they are found
+// count of files and sorting other than the order of walk need all the results, and output file is written at once
+func canStream(input input) bool {
+	if input.quiet || input.summary || input.countFiles || input.fileWName != "" || input.sortReverse {
+		return false
+	}
+	return input.sort == "" || input.sort == grep.SortPath
+}
+
+// runs the search in -r and prints each result as it's found, returns the exit status
+// output goes through a buffer which is flushed within flushInterval, so that a long search shows the early matches
+func runStream(fSys fs.FS, input input, option grep.GrepOptions, delim byte) int {
+	out := newFlushWriter(input.output, input.flushInterval)
+	defer out.Flush()
+	// errors are printed through the same buffer, so that they are in order with the lines
+	input.output = out
+
+	results, wait := grep.GrepRStream(fSys, option)
+	formatter := textFormatter{input: input}
+	matched, hadError := false, false
+	var jsonErr error
+	for res := range results {
+		kept, resError := dropErrors(input, []grep.GrepResult{res})
+		hadError = hadError || resError
+		matched = matched || anyMatched(input, kept)
+
+		// rest of the results are still read after an error, since the search waits for them
+		if jsonErr != nil {
+			continue
+		}
+		var lines []string
+		if input.json {
+			lines, jsonErr = jsonOutput(input, kept)
+		} else {
+			for _, res := range kept {
+				lines = append(lines, formatter.format(res)...)
+			}
+		}
+		io.WriteString(out, joinLines(lines, delim))
+	}
+	if jsonErr != nil {
+		fmt.Fprintln(out, jsonErr.Error())
+		return exitError
+	}
+
+	stats := wait()
+	hadError = reportWalk(input, option, stats) || hadError
+	status := exitStatus(input, matched, hadError)
+	if option.Context != nil && isTimeout(option.Context.Err()) {
+		out.Flush()
+		fmt.Fprintf(input.errOutput, "timed out after %s, printing the results found till then\n", input.timeout)
+		status = exitTimeout
+	}
+	return status
+}
+
+// interval at which the followed file is checked for the appended lines
+const followInterval = 200 * time.Millisecond
+
+// searches the file and then the lines appended to it, printing the matches of each batch as they are found
+// file is read from the OS with the path as passed, since the fs.FS of run can't wait for the writes
+// stops on interrupt (or timeout), and exits with the status of the lines matched till then
+func runFollow(input input, option grep.GrepOptions, delim byte) int {
+	ctx := option.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	option.Context = ctx
+
+	formatter := textFormatter{input: input}
+	matched := false
+	err := grep.Follow(input.path, option, followInterval, func(res grep.GrepResult) error {
+		matched = true
+		var lines []string
+		if input.json {
+			var err error
+			if lines, err = jsonOutput(input, []grep.GrepResult{res}); err != nil {
+				return err
 			}
 		} else {
-			for _, line := range res.MatchedLines {
-				outputArr = append(outputArr, fmt.Sprintf("%s\n", line))
+			lines = formatter.format(res)
+		}
+		_, err := io.WriteString(input.output, joinLines(lines, delim))
+		return err
+	})
+	if err != nil {
+		printFileError(input, err)
+		return exitError
+	}
+	if isTimeout(ctx.Err()) {
+		fmt.Fprintf(input.errOutput, "timed out after %s, printing the results found till then\n", input.timeout)
+		return exitTimeout
+	}
+	return exitStatus(input, matched, false)
+}
+
+// clears the progress line and prints the summary and warnings of -r to errOutput, reports if any file had an error
+func reportWalk(input input, option grep.GrepOptions, stats grep.GrepStats) bool {
+	if option.ProgressFunc != nil {
+		fmt.Fprintf(input.errOutput, "\r\033[K")
+	}
+	if input.searchDir && input.stats {
+		printStats(input.errOutput, stats)
+	}
+	// warns about the skipped sockets, fifos and devices, unless messages are suppressed
+	if !input.noMessages {
+		for _, path := range stats.NotRegular {
+			fmt.Fprintf(input.errOutput, "%s: %s, skipped\n", path, grep.SkipReasonNotRegular)
+		}
+	}
+	return stats.Errors > 0
+}
+
+// writes to w through a buffer, which is flushed within interval of a write so that the output shows up soon
+// zero interval flushes on every write, it's safe for concurrent use since the flush runs on a timer
+type flushWriter struct {
+	mu sync.Mutex
+	w *bufio.Writer
+	interval time.Duration
+	timer *time.Timer		// pending flush, if anything is written since the last one
+}
+
+func newFlushWriter(w io.Writer, interval time.Duration) *flushWriter {
+	return &flushWriter{w: bufio.NewWriter(w), interval: interval}
+}
+
+func(f *flushWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if f.interval <= 0 {
+		return n, f.w.Flush()
+	}
+	if f.timer == nil {
+		f.timer = time.AfterFunc(f.interval, func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.timer = nil
+			f.w.Flush()
+		})
+	}
+	return n, nil
+}
+
+// flushes the buffer now, it has to be called once everything is written
+func(f *flushWriter) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	return f.w.Flush()
+}
+
+// returns the exit status for the search on the basis of match and error
+// error wins over the match, except in quiet mode where a match is all that's asked for
+func exitStatus(input input, matched bool, hadError bool) int {
+	if hadError && !(input.quiet && matched) {
+		return exitError
+	}
+	if matched {
+		return exitMatch
+	}
+	return exitNoMatch
+}
+
+// prints the error about a file which couldn't be read, unless noMessages was passed
+// the error is still reported through the exit status
+func printFileError(input input, err error) {
+	if input.noMessages {
+		return
+	}
+	fmt.Fprintln(input.output, err.Error())
+}
+
+// prints the errors in result and drops them, reports if there was any error
+// results cut short by the timeout are kept, since they have the lines found till then
+func dropErrors(input input, result []grep.GrepResult) ([]grep.GrepResult, bool) {
+	var kept []grep.GrepResult
+	hadError := false
+	for _, res := range result {
+		if res.Error != nil && !isTimeout(res.Error) {
+			printFileError(input, res.Error)
+			hadError = true
+			continue
+		}
+		kept = append(kept, res)
+	}
+	return kept, hadError
+}
+
+// joins the lines of output with delim, every output goes through it
+// ensures exactly one delim after each line, irrespective of the mode and the delims in them
+func joinLines(lines []string, delim byte) string {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(strings.TrimRight(line, string(delim)))
+		b.WriteByte(delim)
+	}
+	return b.String()
+}
+
+// greps each file from the list in filesFrom ("-" for stdin) instead of the path
+// files are searched concurrently by at most filesFromWorkers workers, results are in the order of list
+// errors for a file are returned in its result, and rest of the files are still searched
+func grepFilesFrom(fSys fs.FS, input input, option grep.GrepOptions) ([]grep.GrepResult, error) {
+	var data []byte
+	var err error
+	if input.filesFrom == "-" {
+		data, err = io.ReadAll(input.stdin)
+	} else {
+		data, err = os.ReadFile(input.filesFrom)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// each worker saves the result at the index of its file, so that the order of list is kept
+	paths := splitFileList(string(data))
+	result := make([]grep.GrepResult, len(paths))
+	sem := make(chan struct{}, filesFromWorkers)
+	var wg sync.WaitGroup
+	stdinListed := false
+	for i, path := range paths {
+		// stdin can be read only once, so - listed again is an error instead of a concurrent read of it
+		if path == "-" && input.filesFrom != "-" {
+			if stdinListed {
+				result[i] = grep.GrepResult{Path: stdinName, Error: errStdinListedTwice}
+				continue
 			}
+			stdinListed = true
 		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, path string, option grep.GrepOptions) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// - in the list is stdin, unless the list itself was read from it
+			if path == "-" && input.filesFrom != "-" {
+				result[i] = grepStdin(fSys, input, option)
+				return
+			}
+
+			fullPath, err := getFullPath(fSys, path)
+			if err != nil {
+				result[i] = grep.GrepResult{Path: path, Error: err}
+				return
+			}
+
+			option.OrigPath = path
+			option.Path = fullPath
+			grepResult := grep.Grep(fSys, option)
+			// path is relative to fSys, so using the one from list
+			if grepResult.Error == nil || isTimeout(grepResult.Error) {
+				grepResult.Path = path
+			}
+			result[i] = grepResult
+		}(i, path, option)
 	}
+	wg.Wait()
 
-	// writing to file if file name was passed
-	if fileWName != "" {
-		err := writeToFile(fileWName, strings.Join(outputArr, ""))
+	// files after the one cut short by timeout are dropped, as if they weren't searched
+	for i, res := range result {
+		if isTimeout(res.Error) {
+			return result[:i+1], nil
+		}
+	}
+	return result, nil
+}
+
+// searches stdin as one of the files from list, labelled as stdinName
+func grepStdin(fSys fs.FS, input input, option grep.GrepOptions) grep.GrepResult {
+	if isTerminalInput(input.stdin) {
+		return grep.GrepResult{Path: stdinName, Error: errStdinTerminal}
+	}
+	option.Stdin = input.stdin
+	option.Path = ""
+	option.OrigPath = ""
+	result := grep.Grep(fSys, option)
+	result.Path = stdinName
+	return result
+}
+
+// reads the first line of r as the keyword, without the new line (and \r before it)
+// r is read a byte at a time, since a buffered reader would take the lines after it as well
+func readPatternLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			// empty first line is an empty keyword, but there's no line at all here
+			if len(line) == 0 {
+				return "", errNoPatternStdin
+			}
+			break
+		}
 		if err != nil {
-			fmt.Fprint(out, err.Error())
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(string(line), "\r"), nil
+}
+
+// label of stdin in place of the path in output
+const stdinName = "(standard input)"
+
+// count of the files from list searched at once, so that a long list doesn't open all of its files together
+var filesFromWorkers = runtime.NumCPU()
+
+// checks if the error is from the timeout, results with it have the lines found till then
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// splits the list of paths on NUL if present (like from find -print0), and on new lines otherwise
+func splitFileList(list string) []string {
+	sep := "\n"
+	if strings.Contains(list, "\x00") {
+		sep = "\x00"
+	}
+
+	var paths []string
+	for _, path := range strings.Split(list, sep) {
+		path = strings.TrimSuffix(path, "\r")
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// counts the files with at least one match
+func countMatchedFiles(result []grep.GrepResult) int {
+	count := 0
+	for _, res := range result {
+		if res.Matched {
+			count++
+		}
+	}
+	return count
+}
+
+// prints the summary of recursive search
+func printStats(w io.Writer, stats grep.GrepStats) {
+	skipped := 0
+	var reasons []string
+	for reason, count := range stats.FilesSkipped {
+		skipped += count
+		reasons = append(reasons, fmt.Sprintf("%s: %d", reason, count))
+	}
+	sort.Strings(reasons)
+
+	fmt.Fprintf(w, "files scanned: %d\n", stats.FilesScanned)
+	if len(reasons) > 0 {
+		fmt.Fprintf(w, "files skipped: %d (%s)\n", skipped, strings.Join(reasons, ", "))
+	} else {
+		fmt.Fprintf(w, "files skipped: %d\n", skipped)
+	}
+	fmt.Fprintf(w, "matches: %d\n", stats.Matches)
+	fmt.Fprintf(w, "bytes scanned: %d (%.1f MB/s)\n", stats.BytesScanned, throughput(stats))
+	fmt.Fprintf(w, "elapsed: %s\n", stats.Elapsed)
+}
+
+// prepares the lines of summary output, with the matches by extension if asked
+func summaryOutput(input input, stats grep.GrepStats) []string {
+	outputArr := []string{
+		fmt.Sprintf("matches: %d", stats.Matches),
+		fmt.Sprintf("files matched: %d", stats.FilesMatched),
+		fmt.Sprintf("files searched: %d", stats.FilesScanned),
+	}
+	if !input.byExtension {
+		return outputArr
+	}
+
+	exts := make([]string, 0, len(stats.MatchesByExt))
+	for ext := range stats.MatchesByExt {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	for _, ext := range exts {
+		name := ext
+		if name == "" {
+			name = "(no extension)"
+		}
+		outputArr = append(outputArr, fmt.Sprintf("matches in %s: %d", name, stats.MatchesByExt[ext]))
+	}
+	return outputArr
+}
+
+// returns the MB (10^6 bytes) scanned per second in the search, 0 if no time has elapsed
+func throughput(stats grep.GrepStats) float64 {
+	if stats.Elapsed <= 0 {
+		return 0
+	}
+	return float64(stats.BytesScanned) / 1e6 / stats.Elapsed.Seconds()
+}
+
+// prepares the lines of text output on the basis of options, without the new line
+func textOutput(input input, result []grep.GrepResult) []string {
+	var outputArr []string
+	formatter := textFormatter{input: input}
+	for _, res := range result {
+		outputArr = append(outputArr, formatter.format(res)...)
+	}
+	return outputArr
+}
+
+// formats the results as the lines of text output one at a time, so that they can be printed as they are found
+// holds the state which depends on the results before, like the separators between them
+type textFormatter struct {
+	input input
+	printed bool		// if any line is in output, so that the heading of next file is separated from it
+	grouped bool		// if any group of context is in output, so that the next one is separated from it
+}
+
+// returns the lines of text output for the result, without the new line
+func(f *textFormatter) format(res grep.GrepResult) []string {
+	input := f.input
+	var outputArr []string
+	prefix := pathPrefix(input, res)
+	// paths are listed as is, since only the files to be listed are in result
+	if input.listFiles || input.nameOnly {
+		outputArr = append(outputArr, colorize(input, input.palette.fileName, formatPath(input, res.Path)))
+	} else if input.report {
+		outputArr = append(outputArr, textPath(input, res)+separator(input)+reportStatus(res))
+	} else if input.filesWithMatches {
+		if res.Matched {
+			outputArr = append(outputArr, textPath(input, res))
+		}
+	} else if input.lineCount {
+		outputArr = append(outputArr, fmt.Sprintf("%s%d", prefix, res.LineCount))
+	} else if input.countMatches {
+		outputArr = append(outputArr, fmt.Sprintf("%s%d", prefix, res.MatchCount))
+	} else if res.Binary && len(res.MatchedLines) > 0 {
+		// lines of a binary file would be garbage on a terminal, so only the match is noted like GNU grep
+		outputArr = append(outputArr, "Binary file "+textPath(input, res)+" matches")
+	} else if input.heading && multipleFiles(input) {
+		if len(res.MatchedLines) > 0 {
+			outputArr = append(outputArr, headingLines(input, res, !f.printed)...)
+		}
+	} else if joinsGroups(input) {
+		outputArr = append(outputArr, joinedGroups(input, res, prefix)...)
+	} else {
+		for i, line := range res.MatchedLines {
+			// separates the groups of context, which aren't adjacent in the file or are from another file
+			if hasGroupSeparator(input) && isGroupStart(res, i) {
+				if f.grouped {
+					outputArr = append(outputArr, input.groupSeparator)
+				}
+				f.grouped = true
+			}
+			outputArr = append(outputArr, fmt.Sprintf("%s%s%s", prefix, lineNumberPrefix(input, res, i), formatLine(input, line)))
+		}
+	}
+	f.printed = f.printed || len(outputArr) > 0
+	return outputArr
+}
+
+// checks if the separator is printed between the groups of context
+// empty separator is same as noGroupSeparator, only matched lines (with context) are in groups
+func hasGroupSeparator(input input) bool {
+	if input.noGroupSeparator || input.groupSeparator == "" || input.onlyMatching || input.multiline {
+		return false
+	}
+	return input.linesBeforeMatch > 0 || input.linesAfterMatch > 0
+}
+
+// checks if each group of context is printed as a single line joined by the join string
+// matched lines without context aren't in groups, since adjacent ones would be joined with each other
+func joinsGroups(input input) bool {
+	if input.join == "" || input.onlyMatching || input.multiline {
+		return false
+	}
+	return input.linesBeforeMatch > 0 || input.linesAfterMatch > 0
+}
+
+// returns a line for each group of context in result, with its lines joined by the join string
+// path is printed once at the start, and line number (if passed) before each joined line
+func joinedGroups(input input, res grep.GrepResult, prefix string) []string {
+	var groups []string
+	var lines []string
+	for i, line := range res.MatchedLines {
+		if isGroupStart(res, i) && len(lines) > 0 {
+			groups = append(groups, prefix+strings.Join(lines, input.join))
+			lines = nil
+		}
+		lines = append(lines, lineNumberPrefix(input, res, i)+formatLine(input, line))
+	}
+	if len(lines) > 0 {
+		groups = append(groups, prefix+strings.Join(lines, input.join))
+	}
+	return groups
+}
+
+// checks if the ith line of result starts a group, which is when it's not just after the previous line
+func isGroupStart(res grep.GrepResult, i int) bool {
+	if i == 0 || i >= len(res.LineNumbers) {
+		return true
+	}
+	return res.LineNumbers[i] != res.LineNumbers[i-1]+1
+}
+
+// returns the func which rewrites the progress line in w, at most every 100ms to not slow down the search
+func progressPrinter(w io.Writer) func(scanned, matched int) {
+	var last time.Time
+	return func(scanned, matched int) {
+		if time.Since(last) < 100*time.Millisecond {
 			return
 		}
-		return
+		last = time.Now()
+		fmt.Fprintf(w, "\r\033[Kfiles scanned: %d, matches: %d", scanned, matched)
+	}
+}
+
+// checks if v is a terminal, like the stdin or stderr of an interactive shell
+func isTerminal(v any) bool {
+	f, ok := v.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&fs.ModeCharDevice != 0
+}
+
+// checks if stdin is a terminal, a var so that tests can pass a terminal without having one
+// null device is a char device as well, but it's an empty input (like < /dev/null in scripts) instead of a terminal
+var isTerminalInput = func(r io.Reader) bool {
+	if !isTerminal(r) {
+		return false
+	}
+	info, err := r.(*os.File).Stat()
+	null, nullErr := os.Stat(os.DevNull)
+	return err != nil || nullErr != nil || !os.SameFile(info, null)
+}
+
+// returns the match status of file in report
+func reportStatus(res grep.GrepResult) string {
+	if res.Matched {
+		return "matched"
+	}
+	return "not matched"
+}
+
+// returns the lines of result grouped under the path of file, each with its line number
+// a blank line separates the group from the one of previous file
+func headingLines(input input, res grep.GrepResult, first bool) []string {
+	var lines []string
+	if !first {
+		lines = append(lines, "")
+	}
+	lines = append(lines, textPath(input, res)+colorize(input, input.palette.separator, ":"))
+
+	input.lineNumber = true
+	for i, line := range res.MatchedLines {
+		lines = append(lines, lineNumberPrefix(input, res, i)+formatLine(input, line))
+	}
+	return lines
+}
+
+// transforms the matched (or context) line for output, the search is done on the original line
+func formatLine(input input, line string) string {
+	if input.expandTabs > 0 {
+		line = expandTabs(line, input.expandTabs)
+	}
+	if input.trim {
+		line = strings.TrimSpace(line)
+	}
+	return line
+}
+
+// replaces each tab with the spaces up to the next tab stop, which are tabWidth columns apart
+// columns are counted in runes from the start of the line
+func expandTabs(line string, tabWidth int) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+
+	var b strings.Builder
+	col := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := tabWidth - col%tabWidth
+			b.WriteString(strings.Repeat(" ", spaces))
+			col += spaces
+			continue
+		}
+		b.WriteRune(r)
+		col++
+	}
+	return b.String()
+}
+
+// returns the path prefix for lines of result
+// path is always included in recursive search, and for single file only if withFileName was passed
+func pathPrefix(input input, res grep.GrepResult) string {
+	if !multipleFiles(input) && !input.withFileName {
+		return ""
+	}
+	return textPath(input, res) + separator(input)
+}
+
+// checks if multiple files are searched, so that path is required to tell apart the lines
+func multipleFiles(input input) bool {
+	return input.searchDir || input.filesFrom != "" || input.tar || input.zip
+}
+
+// returns the path of result to be printed
+func displayPath(input input, res grep.GrepResult) string {
+	if multipleFiles(input) {
+		return formatPath(input, res.Path)
+	}
+	// path is relative to fSys for a single file, so using the one passed by user
+	if input.path == "" {
+		return stdinName
+	}
+	return formatPath(input, input.path)
+}
+
+// returns the path of result for text output, in the color of file name if colors were passed
+func textPath(input input, res grep.GrepResult) string {
+	return colorize(input, input.palette.fileName, displayPath(input, res))
+}
+
+// returns the path in the form of pathMode, it's as passed by user unless absolute was asked for
+// leading components are removed if stripPrefix was passed, and separators are replaced with pathSeparator if it was
+func formatPath(input input, path string) string {
+	if path == stdinName {
+		return path
+	}
+	if input.pathMode == pathAbsolute && path != "" {
+		if absPath, err := filepath.Abs(path); err == nil {
+			path = absPath
+		}
+	}
+	path = stripComponents(path, input.stripPrefix)
+	if input.pathSeparator == "" {
+		return path
+	}
+	// paths of fs.FS use / on every OS, and the ones of OS use its own separator
+	path = strings.ReplaceAll(path, "/", input.pathSeparator)
+	return strings.ReplaceAll(path, string(filepath.Separator), input.pathSeparator)
+}
+
+// removes the smallest prefix of path with n separators, like -p of patch, so the leading / of an absolute path is a component
+// file name is kept even if path has fewer components
+func stripComponents(path string, n int) string {
+	for ; n > 0; n-- {
+		i := strings.IndexAny(path, "/"+string(filepath.Separator))
+		if i < 0 {
+			break
+		}
+		path = path[i+1:]
+	}
+	return path
+}
+
+// returns the separator after path and line number
+// NUL byte is used if null was passed, since it can't be a part of path
+func separator(input input) string {
+	if input.null {
+		return "\x00"
+	}
+	return colorize(input, input.palette.separator, ":")
+}
+
+// colors of GNU grep, used for the elements not in the spec of colorColumns
+const defaultColors = "ms=01;31:fn=35:ln=32:bn=32:se=36"
+
+// escape code after a colored element, which resets the color and clears the rest of line like GNU grep
+const colorEnd = "\033[m\033[K"
+
+// colors of the elements of text output, as SGR parameters like 01;31, uncolored if empty
+type palette struct {
+	match string
+	fileName string
+	lineNumber string
+	byteOffset string
+	separator string
+}
+
+// parses the colors in GREP_COLORS form, eg: ms=01;31:fn=35, on top of the default ones
+// capabilities without a value (like ne) and the ones for elements not printed here (like mc and cx) are ignored
+func parsePalette(spec string) (palette, error) {
+	var p palette
+	specs := defaultColors + ":" + spec
+	for _, capability := range strings.Split(specs, ":") {
+		name, value, ok := strings.Cut(capability, "=")
+		if !ok {
+			continue
+		}
+		if strings.Trim(value, "0123456789;") != "" {
+			return palette{}, errInvalidColors
+		}
+		switch name {
+		case "ms", "mt":
+			p.match = value
+		case "fn":
+			p.fileName = value
+		case "ln":
+			p.lineNumber = value
+		case "bn":
+			p.byteOffset = value
+		case "se":
+			p.separator = value
+		}
 	}
+	return p, nil
+}
 
-	fmt.Fprint(out, strings.Join(outputArr, ""))
+// returns the escape code before an element in the color
+func colorStart(color string) string {
+	return "\033[" + color + "m\033[K"
+}
+
+// wraps s in the color, if colors were passed and the element has one
+func colorize(input input, color string, s string) string {
+	if input.colorColumns == "" || color == "" || s == "" {
+		return s
+	}
+	return colorStart(color) + s + colorEnd
 }
 
-func writeToFile(filePath string, content string) error {
-	// check if file exists
-	_, err := os.Stat(filePath)
-	if err == nil {
-		return fmt.Errorf("%s: %w", filePath, os.ErrExist)
+// returns the line number prefix for the ith line of result if line number was passed
+// byte offset follows the line number if it was passed, same as GNU grep
+func lineNumberPrefix(input input, res grep.GrepResult, i int) string {
+	prefix := ""
+	if input.lineNumber && i < len(res.LineNumbers) {
+		prefix = colorize(input, input.palette.lineNumber, strconv.Itoa(res.LineNumbers[i])) + separator(input)
 	}
+	if input.byteOffset && i < len(res.ByteOffsets) {
+		prefix += colorize(input, input.palette.byteOffset, strconv.FormatInt(res.ByteOffsets[i], 10)) + separator(input)
+	}
+	return prefix
+}
+
+// record for each matched line in json output
+type jsonMatch struct {
+	Path string `json:"path,omitempty"`
+	LineNumber int `json:"line_number"`
+	Line string `json:"line"`
+}
+
+// record for each file in json output when counting
+type jsonCount struct {
+	Path string `json:"path,omitempty"`
+	Count int `json:"count"`
+}
+
+// record for each file in json output when listing files (or files with matches)
+type jsonFile struct {
+	Path string `json:"path"`
+}
+
+// record for each binary file with matches in json output, in place of its lines
+type jsonBinary struct {
+	Path string `json:"path,omitempty"`
+	Binary bool `json:"binary"`
+}
+
+// record for each file searched in json output of report
+type jsonReport struct {
+	Path string `json:"path"`
+	Matched bool `json:"matched"`
+}
+
+// prepares one json object per line (or per file when counting) of the result, without the new line
+func jsonOutput(input input, result []grep.GrepResult) ([]string, error) {
+	var records []any
+	for _, res := range result {
+		// path is relative to fSys for a single file, so using the one passed by user
+		path := res.Path
+		if !multipleFiles(input) {
+			path = input.path
+		}
+		path = formatPath(input, path)
+
+		if input.listFiles || input.nameOnly {
+			records = append(records, jsonFile{Path: formatPath(input, res.Path)})
+			continue
+		}
+		if input.report {
+			records = append(records, jsonReport{Path: displayPath(input, res), Matched: res.Matched})
+			continue
+		}
+		if input.filesWithMatches {
+			if res.Matched {
+				records = append(records, jsonFile{Path: displayPath(input, res)})
+			}
+			continue
+		}
+		if input.lineCount {
+			records = append(records, jsonCount{Path: path, Count: res.LineCount})
+			continue
+		}
+		if input.countMatches {
+			records = append(records, jsonCount{Path: path, Count: res.MatchCount})
+			continue
+		}
+		// lines of a binary file may not be text, so only the match is noted like in the text output
+		if res.Binary && len(res.MatchedLines) > 0 {
+			records = append(records, jsonBinary{Path: path, Binary: true})
+			continue
+		}
+		for i, line := range res.MatchedLines {
+			records = append(records, jsonMatch{Path: path, LineNumber: res.LineNumbers[i], Line: formatLine(input, line)})
+		}
+	}
+
+	var outputArr []string
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		outputArr = append(outputArr, string(data))
+	}
+	return outputArr, nil
+}
+
+// rewrites the file (or the files with matches in -r) with matches replaced
+// reports if any file had matches and if any file in -r couldn't be read, files without matches are left untouched
+func runInPlace(fSys fs.FS, input input, option grep.GrepOptions) (bool, bool, error) {
+	if input.path == "" {
+		return false, false, errInPlaceStdin
+	}
+	if option.Replace == nil {
+		return false, false, grep.ErrNoReplace
+	}
+
+	// finds the files with matches, so that other files are left untouched
+	option.FilesWithMatches = true
+	if !input.searchDir {
+		info, err := os.Stat(input.path)
+		if err != nil {
+			return false, false, err
+		}
+		if info.IsDir() {
+			return false, false, fmt.Errorf("%s: %w", input.path, grep.ErrIsDirectory)
+		}
 
-	// create file
-	file, err := os.Create(filePath)
+		res := grep.Grep(fSys, option)
+		if res.Error != nil || !res.Matched {
+			return false, false, res.Error
+		}
+		return true, false, editInPlace(input.path, option, input.backupSuffix)
+	}
+
+	// files which couldn't be read are reported, the rest are still edited
+	var results []grep.GrepResult
+	hadError := false
+	events, wait := grep.GrepREvents(fSys, option)
+	for event := range events {
+		if event.Err != nil {
+			printFileError(input, event.Err)
+			hadError = true
+			continue
+		}
+		results = append(results, *event.Result)
+	}
+	wait()
+	for _, res := range results {
+		if err := editInPlace(res.Path, option, input.backupSuffix); err != nil {
+			return false, hadError, err
+		}
+	}
+	return len(results) > 0, hadError, nil
+}
+
+// rewrites the file with matches replaced, saves a copy of original with backupSuffix if passed
+// writes to a temp file in the same directory and renames it over the file, so the file is intact on failure
+func editInPlace(filePath string, option grep.GrepOptions, backupSuffix string) (err error) {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	// removing the temp file on failure
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = grep.Replace(src, tmp, option); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if backupSuffix != "" {
+		if err = copyFile(filePath, filePath+backupSuffix, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	err = os.Rename(tmp.Name(), filePath)
+	return err
+}
+
+// copies the content of file at src to dst
+func copyFile(src, dst string, perm fs.FileMode) error {
+	data, err := os.ReadFile(src)
 	if err != nil {
 		return err
 	}
+	return os.WriteFile(dst, data, perm)
+}
+
+// gets the mode for writing to file, append takes precedence over force
+func getWriteMode(input input) writeMode {
+	if input.append {
+		return appendMode
+	}
+	if input.force {
+		return overwriteMode
+	}
+	return createMode
+}
+
+// writes content to file on the basis of mode
+func writeToFile(filePath string, content string, mode writeMode) error {
+	flag := os.O_WRONLY | os.O_CREATE
+	switch mode {
+	case createMode:
+		flag |= os.O_EXCL
+	case overwriteMode:
+		flag |= os.O_TRUNC
+	case appendMode:
+		flag |= os.O_APPEND
+	}
+
+	// create parent directories, if not present
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	// open file, fails if it exists in create mode
+	file, err := os.OpenFile(filePath, flag, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s: %w", filePath, os.ErrExist)
+		}
+		return err
+	}
 	defer file.Close()
 
 	// write to file
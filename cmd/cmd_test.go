@@ -1,13 +1,21 @@
 package cmd
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 	grep "github.com/one2n-go-bootcamp/go-grep/pkg"
 )
 
@@ -24,6 +32,17 @@ func TestRun(t *testing.T) {
 		linesAfterMatch int
 		searchDir        bool
 		lineCount        bool
+		countMatches     bool
+		onlyMatching     bool
+		regexp           bool
+		lineNumber       bool
+		withFileName     bool
+		null             bool
+		excludeDir       []string
+		listFiles        bool
+		filesWithMatches bool
+		quiet            bool
+		countFiles       bool
 		result           [][]string
 		expErr           error
 	}{
@@ -94,7 +113,6 @@ func TestRun(t *testing.T) {
 				{
 					"../testdata/cmd_test/test1.txt:Dummy Line",
 					"../testdata/cmd_test/test1.txt:this is a test file",
-					"../testdata/cmd_test/test1.txt:this is a test file",
 					"../testdata/cmd_test/test1.txt:one can test a program by running test cases",
 				},
 				{
@@ -110,7 +128,6 @@ func TestRun(t *testing.T) {
 			linesAfterMatch: 1,
 			result: [][]string{
 				{
-					"../testdata/cmd_test/test1.txt:this is a test file",
 					"../testdata/cmd_test/test1.txt:this is a test file",
 					"../testdata/cmd_test/test1.txt:one can test a program by running test cases",
 					"../testdata/cmd_test/test1.txt:something here",
@@ -132,22 +149,253 @@ func TestRun(t *testing.T) {
 				{"../testdata/cmd_test/inner/test2.txt:1"},
 			},
 		},
+		{
+			name:      "greps on a multi-line file with line count option",
+			path:      "../testdata/cmd_test/test1.txt",
+			keyword:   "test",
+			lineCount: true,
+			result:    [][]string{{"2"}},
+		},
+		{
+			name:      "greps on a multi-line file without matches with line count option",
+			path:      "../testdata/cmd_test/test2.txt",
+			keyword:   "vibgyor",
+			lineCount: true,
+			result:    [][]string{{"0"}},
+		},
+		{
+			name:         "greps on a multi-line file with line count and file name option",
+			path:         "../testdata/cmd_test/test1.txt",
+			keyword:      "test",
+			lineCount:    true,
+			withFileName: true,
+			result:       [][]string{{"../testdata/cmd_test/test1.txt:2"}},
+		},
+		{
+			name:         "greps on stdin with file name option",
+			stdin:        bytes.NewReader([]byte("you will find\nno matches here\nwhatsoever")),
+			keyword:      "match",
+			withFileName: true,
+			result:       [][]string{{"(standard input):no matches here"}},
+		},
+		{
+			name:         "greps on stdin with count matches option",
+			stdin:        bytes.NewReader([]byte("test test test\nno match\none more test")),
+			keyword:      "test",
+			countMatches: true,
+			result:       [][]string{{"4"}},
+		},
+		{
+			name:         "greps on stdin with only matching and line count option",
+			stdin:        bytes.NewReader([]byte("test test test\nno match\none more test")),
+			keyword:      "test",
+			onlyMatching: true,
+			lineCount:    true,
+			result:       [][]string{{"4"}},
+		},
+		{
+			name:         "greps inside a directory with -r with count matches option",
+			path:         "../testdata/cmd_test",
+			keyword:      "test",
+			searchDir:    true,
+			countMatches: true,
+			result:       [][]string{
+				{"../testdata/cmd_test/test1.txt:3"},
+				{"../testdata/cmd_test/inner/test2.txt:1"},
+			},
+		},
+		{
+			name:         "greps inside a directory with -r with only matching regexp option",
+			path:         "../testdata/cmd_test",
+			keyword:      "te?st[a-z ]*",
+			searchDir:    true,
+			onlyMatching: true,
+			regexp:       true,
+			result:       [][]string{
+				{
+					"../testdata/cmd_test/test1.txt:test file",
+					"../testdata/cmd_test/test1.txt:test a program by running test cases",
+				},
+				{
+					"../testdata/cmd_test/inner/test2.txt:test line",
+				},
+			},
+		},
+		{
+			name:       "greps inside a directory with -r with line number option",
+			path:       "../testdata/cmd_test",
+			keyword:    "test",
+			searchDir:  true,
+			lineNumber: true,
+			result:     [][]string{
+				{
+					"../testdata/cmd_test/test1.txt:2:this is a test file",
+					"../testdata/cmd_test/test1.txt:3:one can test a program by running test cases",
+				},
+				{
+					"../testdata/cmd_test/inner/test2.txt:1:this file contains a test line",
+				},
+			},
+		},
+		{
+			name:      "greps inside a directory with -r with null option",
+			path:      "../testdata/cmd_test",
+			keyword:   "test",
+			searchDir: true,
+			null:      true,
+			result:    [][]string{
+				{
+					"../testdata/cmd_test/test1.txt\x00this is a test file",
+					"../testdata/cmd_test/test1.txt\x00one can test a program by running test cases",
+				},
+				{
+					"../testdata/cmd_test/inner/test2.txt\x00this file contains a test line",
+				},
+			},
+		},
+		{
+			name:       "greps inside a directory with -r with null and line number option",
+			path:       "../testdata/cmd_test",
+			keyword:    "test",
+			searchDir:  true,
+			null:       true,
+			lineNumber: true,
+			result:     [][]string{
+				{
+					"../testdata/cmd_test/test1.txt\x002\x00this is a test file",
+					"../testdata/cmd_test/test1.txt\x003\x00one can test a program by running test cases",
+				},
+				{
+					"../testdata/cmd_test/inner/test2.txt\x001\x00this file contains a test line",
+				},
+			},
+		},
+		{
+			name:       "greps inside a directory with -r with exclude dir option",
+			path:       "../testdata/cmd_test",
+			keyword:    "test",
+			searchDir:  true,
+			excludeDir: []string{"inner"},
+			result:     [][]string{
+				{
+					"../testdata/cmd_test/test1.txt:this is a test file",
+					"../testdata/cmd_test/test1.txt:one can test a program by running test cases",
+				},
+			},
+		},
+		{
+			name:       "lists files inside a directory with -r with exclude dir option",
+			path:       "../testdata/cmd_test",
+			searchDir:  true,
+			excludeDir: []string{"inner", "perm_err"},
+			listFiles:  true,
+			result:     [][]string{
+				{
+					"../testdata/cmd_test/test1.txt",
+					"../testdata/cmd_test/test2.txt",
+				},
+			},
+		},
+		{
+			name:             "greps inside a directory with -r with files with matches option",
+			path:             "../testdata/cmd_test",
+			keyword:          "test",
+			searchDir:        true,
+			filesWithMatches: true,
+			result:           [][]string{
+				{"../testdata/cmd_test/inner/test2.txt"},
+				{"../testdata/cmd_test/test1.txt"},
+			},
+		},
+		{
+			name:             "greps on a multi-line file with files with matches option",
+			path:             "../testdata/cmd_test/test2.txt",
+			keyword:          "match",
+			filesWithMatches: true,
+			result:           [][]string{{"../testdata/cmd_test/test2.txt"}},
+		},
+		{
+			name:       "greps inside a directory with -r with count files option",
+			path:       "../testdata/cmd_test",
+			keyword:    "test",
+			searchDir:  true,
+			countFiles: true,
+			result:     [][]string{{"2"}},
+		},
+		{
+			name:       "greps inside a directory with -r without matches with count files option",
+			path:       "../testdata/cmd_test",
+			keyword:    "vibgyor",
+			searchDir:  true,
+			countFiles: true,
+			result:     [][]string{{"0"}},
+		},
+		{
+			name:       "greps on a multi-line file with count files option",
+			path:       "../testdata/cmd_test/test2.txt",
+			keyword:    "match",
+			countFiles: true,
+			result:     [][]string{{"1"}},
+		},
+		{
+			name:    "greps on a multi-line file with quiet option",
+			path:    "../testdata/cmd_test/test2.txt",
+			keyword: "match",
+			quiet:   true,
+			result:  [][]string{},
+		},
+		{
+			name:    "greps on stdin with invalid regexp",
+			stdin:   bytes.NewReader([]byte("no matches here")),
+			keyword: "match(",
+			regexp:  true,
+			expErr:  errors.New("missing closing )"),
+		},
 	}
 	
 	// creates a file for permission error case, and deletes it in cleanup
-	cleanup, err := setTestForPermissonCase(t, "../testdata/cmd_test/perm_err/test1.txt", "test for permisson case")
-	if err != nil {
-		t.Fatalf("Unexpected error while setting up test: %v", err)
+	// root can open the file irrespective of its permissions, so the case is skipped in that case
+	isRoot := os.Geteuid() == 0
+	if !isRoot {
+		cleanup, err := setTestForPermissonCase(t, "../testdata/cmd_test/perm_err/test1.txt", "test for permisson case")
+		if err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+		defer cleanup()
 	}
-	defer cleanup()
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
+			if isRoot && errors.Is(tc.expErr, fs.ErrPermission) {
+				t.Skip("permission error can't be set up for root")
+			}
 			fs := os.DirFS("/")
 			var got bytes.Buffer
 			want := getExpectedOutput(t, tc.result)
 
-			run(fs, tc.stdin, &got, tc.keyword, tc.path, tc.fileWName, tc.linesBeforeMatch, tc.linesAfterMatch, tc.ignoreCase, tc.searchDir, tc.lineCount)
+			run(fs, input{
+				stdin: tc.stdin,
+				output: &got,
+				keyword: tc.keyword,
+				path: tc.path,
+				fileWName: tc.fileWName,
+				linesBeforeMatch: tc.linesBeforeMatch,
+				linesAfterMatch: tc.linesAfterMatch,
+				ignoreCase: tc.ignoreCase,
+				searchDir: tc.searchDir,
+				lineCount: tc.lineCount,
+				countMatches: tc.countMatches,
+				onlyMatching: tc.onlyMatching,
+				regexp: tc.regexp,
+				lineNumber: tc.lineNumber,
+				withFileName: tc.withFileName,
+				null: tc.null,
+				excludeDir: tc.excludeDir,
+				listFiles: tc.listFiles,
+				filesWithMatches: tc.filesWithMatches,
+				quiet: tc.quiet,
+				countFiles: tc.countFiles,
+			})
 
 			// checking for error
 			if tc.expErr != nil {
@@ -181,90 +429,2005 @@ func TestRun(t *testing.T) {
 	}
 }
 
-func TestWriteToFile(t *testing.T) {
+func TestRunDeterministicOrder(t *testing.T) {
+	want := "../testdata/cmd_test/inner/test2.txt:this file contains a test line\n" +
+		"../testdata/cmd_test/test1.txt:this is a test file\n" +
+		"../testdata/cmd_test/test1.txt:one can test a program by running test cases\n"
+
+	// running multiple times, since workers may finish in any order
+	for i := 0; i < 5; i++ {
+		var got bytes.Buffer
+		run(os.DirFS("/"), input{output: &got, keyword: "test", path: "../testdata/cmd_test", searchDir: true})
+		if got.String() != want {
+			t.Fatalf("Expected %q but got %q", want, got.String())
+		}
+	}
+}
+
+func TestRunStats(t *testing.T) {
+	var got, gotErr bytes.Buffer
+	run(os.DirFS("/"), input{
+		output: &got,
+		errOutput: &gotErr,
+		keyword: "test",
+		path: "../testdata/cmd_test",
+		searchDir: true,
+		excludeDir: []string{"inner"},
+		stats: true,
+	})
+
+	// main output stays unchanged
+	want := "../testdata/cmd_test/test1.txt:this is a test file\n" +
+		"../testdata/cmd_test/test1.txt:one can test a program by running test cases\n"
+	if got.String() != want {
+		t.Errorf("Expected %q but got %q", want, got.String())
+	}
+
+	for _, w := range []string{"files scanned: 2\n", "files skipped: 1 (excluded directory: 1)\n", "matches: 2\n", "bytes scanned: 130 (", "elapsed: "} {
+		if !strings.Contains(gotErr.String(), w) {
+			t.Errorf("Expected %q in stats %q", w, gotErr.String())
+		}
+	}
+}
+
+func TestRunSummary(t *testing.T) {
 	testCases := []struct {
 		name     string
-		filePath string
-		content  string
-		expErr   error
+		input    input
+		expected string
 	}{
-		{name: "write to file", filePath: "test.txt", content: "test only", expErr: nil},
-		{name: "write to already created file", filePath: "test.txt", content: "test only", expErr: os.ErrExist},
+		{
+			name:     "directory",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, summary: true},
+			expected: "matches: 3\nfiles matched: 2\nfiles searched: 4\n",
+		},
+		{
+			name:     "directory by extension",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, summary: true, byExtension: true},
+			expected: "matches: 3\nfiles matched: 2\nfiles searched: 4\nmatches in .txt: 3\n",
+		},
+		{
+			name:     "excluded directory",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, excludeDir: []string{"inner"}, summary: true},
+			expected: "matches: 2\nfiles matched: 1\nfiles searched: 2\n",
+		},
+		{
+			name:     "single file",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/test2.txt", summary: true},
+			expected: "matches: 0\nfiles matched: 0\nfiles searched: 1\n",
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			if tc.expErr != nil {
-				os.Create(tc.filePath)
+			var got bytes.Buffer
+			tc.input.output = &got
+			tc.input.errOutput = io.Discard
+			run(os.DirFS("/"), tc.input)
+			if got.String() != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, got.String())
 			}
+		})
+	}
+}
 
-			err := writeToFile(tc.filePath, tc.content)
-			defer os.Remove(tc.filePath)
-
-			if tc.expErr != nil {
-				if err == nil {
-					t.Fatalf("Expected error but didn't got one")
-				}
-
-				if !errors.Is(err, tc.expErr) {
-					t.Errorf("Expected error %v but got %v", tc.expErr, err)
-				}
+func TestRunExitStatus(t *testing.T) {
+	replace := "rainbow"
+	testCases := []struct {
+		name      string
+		input     input
+		stdin     string
+		expected  int
+		expOutput bool
+	}{
+		{
+			name:      "match in file",
+			input:     input{keyword: "test", path: "../testdata/cmd_test/test1.txt"},
+			expected:  exitMatch,
+			expOutput: true,
+		},
+		{
+			name:     "no match in file",
+			input:    input{keyword: "vibgyor", path: "../testdata/cmd_test/test1.txt"},
+			expected: exitNoMatch,
+		},
+		{
+			name:     "quiet with multiline match spanning lines",
+			input:    input{keyword: "file.one", path: "../testdata/cmd_test/test1.txt", regexp: true, multiline: true, quiet: true},
+			expected: exitMatch,
+		},
+		{
+			name:      "missing file",
+			input:     input{keyword: "test", path: "../testdata/cmd_test/missing.txt"},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:      "count with context",
+			input:     input{keyword: "test", path: "../testdata/cmd_test/test1.txt", lineCount: true, linesAfterMatch: 2},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:      "negative context",
+			input:     input{keyword: "test", path: "../testdata/cmd_test/test1.txt", linesBeforeMatch: -1},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:     "missing file with noMessages",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/missing.txt", noMessages: true},
+			expected: exitError,
+		},
+		{
+			name:      "match in directory",
+			input:     input{keyword: "test", path: "../testdata/cmd_test", searchDir: true},
+			expected:  exitMatch,
+			expOutput: true,
+		},
+		{
+			name:     "no match in directory",
+			input:    input{keyword: "vibgyor", path: "../testdata/cmd_test", searchDir: true},
+			expected: exitNoMatch,
+		},
+		{
+			name:      "match with a missing file in list",
+			input:     input{keyword: "test", filesFrom: "-", noMessages: true},
+			stdin:     "../testdata/cmd_test/test1.txt\n../testdata/cmd_test/missing.txt\n",
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:     "match with a missing file in list in quiet mode",
+			input:    input{keyword: "test", filesFrom: "-", noMessages: true, quiet: true},
+			stdin:    "../testdata/cmd_test/test1.txt\n../testdata/cmd_test/missing.txt\n",
+			expected: exitMatch,
+		},
+		{
+			name:      "invalid path mode",
+			input:     input{keyword: "test", path: "../testdata/cmd_test/test1.txt", pathMode: "canonical"},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:      "invalid sort key",
+			input:     input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, sort: "size"},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:      "invalid encoding error mode",
+			input:     input{keyword: "test", path: "../testdata/cmd_test/test1.txt", encodingErrorMode: "ignore"},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:      "single marker",
+			input:     input{keyword: "test", path: "../testdata/cmd_test/test1.txt", mark: []string{"[["}},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:      "invalid path separator",
+			input:     input{keyword: "test", path: "../testdata/cmd_test/test1.txt", pathSeparator: "::"},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:      "invalid line range",
+			input:     input{keyword: "test", path: "../testdata/cmd_test/test1.txt", lines: "20:10"},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:      "line range without colon",
+			input:     input{keyword: "test", path: "../testdata/cmd_test/test1.txt", lines: "10"},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:      "invalid line delimiter",
+			input:     input{keyword: "test", path: "../testdata/cmd_test/test1.txt", lineDelim: "ab"},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:      "invalid regexp",
+			input:     input{keyword: "(test", path: "../testdata/cmd_test/test1.txt", regexp: true},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:      "invalid path filter",
+			input:     input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, pathFilter: "inner("},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:     "no match in place",
+			input:    input{keyword: "vibgyor", path: "../testdata/cmd_test/test1.txt", replace: &replace, inPlace: true},
+			expected: exitNoMatch,
+		},
+		{
+			name:      "in place on stdin",
+			input:     input{keyword: "test", replace: &replace, inPlace: true},
+			expected:  exitError,
+			expOutput: true,
+		},
+		{
+			name:     "no match with a missing file in list in quiet mode",
+			input:    input{keyword: "vibgyor", filesFrom: "-", noMessages: true, quiet: true},
+			stdin:    "../testdata/cmd_test/test1.txt\n../testdata/cmd_test/missing.txt\n",
+			expected: exitError,
+		},
+	}
 
-				return
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bytes.Buffer
+			tc.input.output = &got
+			tc.input.stdin = strings.NewReader(tc.stdin)
+			status := run(os.DirFS("/"), tc.input)
+			if status != tc.expected {
+				t.Errorf("Expected status %v but got %v", tc.expected, status)
 			}
-
-			if err != nil {
-				t.Fatalf("Unexpected error: %v", err)
+			if (got.Len() > 0) != tc.expOutput {
+				t.Errorf("Expected output %v but got %q", tc.expOutput, got.String())
 			}
+		})
+	}
+}
 
-			data, err := os.ReadFile(tc.filePath)
-			if err != nil {
-				t.Fatalf("Unexpected error: %v", err)
-			}
+func TestExecute(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected int
+	}{
+		{name: "match", args: []string{"test", "../testdata/cmd_test/test1.txt"}, expected: exitMatch},
+		{name: "no match", args: []string{"vibgyor", "../testdata/cmd_test/test1.txt"}, expected: exitNoMatch},
+		{name: "missing file", args: []string{"test", "../testdata/cmd_test/missing.txt"}, expected: exitError},
+		{name: "missing keyword", args: []string{}, expected: exitError},
+		{name: "unknown flag", args: []string{"test", "../testdata/cmd_test/test1.txt", "--vibgyor"}, expected: exitError},
+	}
 
-			if string(data) != tc.content {
-				t.Errorf("Expected %q but got %q", string(data), tc.content)
+	var got bytes.Buffer
+	rootCmd.SetOut(&got)
+	rootCmd.SetErr(&got)
+	defer rootCmd.SetOut(nil)
+	defer rootCmd.SetErr(nil)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status := execute(tc.args)
+			if status != tc.expected {
+				t.Errorf("Expected status %v but got %v", tc.expected, status)
 			}
 		})
 	}
 }
 
-func getExpectedOutput(t *testing.T, result [][]string) string {
-	t.Helper()
-	var wantArr []string
-	for _, res := range result {
-		wantArr = append(wantArr, strings.Join(res, "\n"))
+func TestExecuteEnvOptions(t *testing.T) {
+	var got bytes.Buffer
+	rootCmd.SetOut(&got)
+	defer rootCmd.SetOut(nil)
+	// flags keep their values across executions
+	defer rootCmd.Flags().Set(lineNumberFlag, "false")
+	defer rootCmd.Flags().Set(linesAfterMatchFlag, "0")
+
+	// default of env applies
+	t.Setenv(optionsEnv, `-n --after-context 1`)
+	args, err := withEnvOptions([]string{"file", "../testdata/cmd_test/test1.txt"})
+	if err != nil {
+		t.Fatalf("Didn't expected an error: %v", err)
+	}
+	if status := execute(args); status != exitMatch {
+		t.Fatalf("Expected status %v but got %v", exitMatch, status)
+	}
+	expected := "2:this is a test file\n3:one can test a program by running test cases\n"
+	if got.String() != expected {
+		t.Errorf("Expected %q but got %q", expected, got.String())
+	}
+
+	// flag passed explicitly overrides it
+	rootCmd.Flags().Set(lineNumberFlag, "false")
+	rootCmd.Flags().Set(linesAfterMatchFlag, "0")
+	got.Reset()
+	args, err = withEnvOptions([]string{"file", "../testdata/cmd_test/test1.txt", "-A", "0"})
+	if err != nil {
+		t.Fatalf("Didn't expected an error: %v", err)
+	}
+	if status := execute(args); status != exitMatch {
+		t.Fatalf("Expected status %v but got %v", exitMatch, status)
+	}
+	expected = "2:this is a test file\n"
+	if got.String() != expected {
+		t.Errorf("Expected %q but got %q", expected, got.String())
+	}
+
+	// slice flags of env are replaced by the ones passed, instead of adding to them
+	t.Setenv(optionsEnv, `--include=md -e file -n --exclude log`)
+	args, err = withEnvOptions([]string{"--include=txt", "--pattern", "zzz", "test", "dir"})
+	if err != nil {
+		t.Fatalf("Didn't expected an error: %v", err)
+	}
+	expectedArgs := []string{"-n", "--exclude", "log", "--include=txt", "--pattern", "zzz", "test", "dir"}
+	if !slices.Equal(args, expectedArgs) {
+		t.Errorf("Expected %q but got %q", expectedArgs, args)
+	}
+
+	t.Setenv(optionsEnv, `--mark "[[`)
+	if _, err := withEnvOptions(nil); !errors.Is(err, errUnterminatedQuote) {
+		t.Errorf("Expected error %v but got %v", errUnterminatedQuote, err)
 	}
-	return strings.Join(wantArr, "\n")
 }
 
-func setTestForPermissonCase(t *testing.T, filePath, content string) (func() error, error) {
-	t.Helper()
-	
-	// creating file
-    file, err := os.Create(filePath)
-    if err != nil {
-        return nil, err
-    }
+func TestExecuteStdin(t *testing.T) {
+	var got bytes.Buffer
+	rootCmd.SetOut(&got)
+	defer rootCmd.SetOut(nil)
+	defer rootCmd.SetIn(nil)
 
-	// writing to file
-    if _, err := file.WriteString(content); err != nil {
-        return nil, err
-    }
+	// only the keyword is passed, so piped stdin is searched
+	rootCmd.SetIn(strings.NewReader("foo bar\nbaz\n"))
+	if status := execute([]string{"foo"}); status != exitMatch {
+		t.Fatalf("Expected status %v but got %v", exitMatch, status)
+	}
+	if got.String() != "foo bar\n" {
+		t.Errorf("Expected %q but got %q", "foo bar\n", got.String())
+	}
 
-	// setting permisson to 0000
-    if err := os.Chmod(filePath, 0000); err != nil {
-        return nil, err
-    }
+	// terminal would wait for the input forever, so it's an error instead
+	defer func(f func(io.Reader) bool) { isTerminalInput = f }(isTerminalInput)
+	isTerminalInput = func(r io.Reader) bool { return true }
+	got.Reset()
+	if status := execute([]string{"foo"}); status != exitError {
+		t.Fatalf("Expected status %v but got %v", exitError, status)
+	}
+	if got.String() != errStdinTerminal.Error()+"\n" {
+		t.Errorf("Expected %q but got %q", errStdinTerminal.Error()+"\n", got.String())
+	}
+}
 
-    // Define the cleanup function
-    cleanup := func() error {
-		file.Close()
-        if err := os.Remove(filePath); err != nil {
-            return err
-        }
-        return nil
-    }
+func TestSplitArgs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		s        string
+		expected []string
+	}{
+		{name: "empty", s: "", expected: nil},
+		{name: "white space", s: "  -n\t-A 2 \n", expected: []string{"-n", "-A", "2"}},
+		{name: "double quotes", s: `--mark "[[ , ]]" -n`, expected: []string{"--mark", "[[ , ]]", "-n"}},
+		{name: "single quotes", s: `--pathSeparator '\' -n`, expected: []string{"--pathSeparator", `\`, "-n"}},
+		{name: "quoted part of arg", s: `--groupSeparator="-- "x`, expected: []string{"--groupSeparator=-- x"}},
+		{name: "empty quoted arg", s: `--join ""`, expected: []string{"--join", ""}},
+		{name: "escaped space", s: `--butNot known\ error`, expected: []string{"--butNot", "known error"}},
+		{name: "escaped quote", s: `"say \"hi\""`, expected: []string{`say "hi"`}},
+	}
 
-    return cleanup, nil
-}
\ No newline at end of file
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := splitArgs(tc.s)
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if !slices.Equal(got, tc.expected) {
+				t.Errorf("Expected %q but got %q", tc.expected, got)
+			}
+		})
+	}
+
+	for _, s := range []string{`"open`, `'open`, `trailing\`} {
+		if _, err := splitArgs(s); !errors.Is(err, errUnterminatedQuote) {
+			t.Errorf("Expected error %v for %q but got %v", errUnterminatedQuote, s, err)
+		}
+	}
+}
+
+func TestExecuteLongFlags(t *testing.T) {
+	testCases := []struct {
+		name  string
+		short []string
+		long  []string
+	}{
+		{name: "after context", short: []string{"-A", "1"}, long: []string{"--after-context", "1"}},
+		{name: "before context", short: []string{"-B", "1"}, long: []string{"--before-context=1"}},
+		{name: "both", short: []string{"-A", "1", "-B", "2"}, long: []string{"--after-context", "1", "--before-context", "2"}},
+	}
+
+	var got bytes.Buffer
+	rootCmd.SetOut(&got)
+	defer rootCmd.SetOut(nil)
+	// flags keep their values across executions
+	defer rootCmd.Flags().Set(linesAfterMatchFlag, "0")
+	defer rootCmd.Flags().Set(linesBeforeMatchFlag, "0")
+
+	args := []string{"program", "../testdata/cmd_test/test1.txt"}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rootCmd.Flags().Set(linesAfterMatchFlag, "0")
+			rootCmd.Flags().Set(linesBeforeMatchFlag, "0")
+			got.Reset()
+			if status := execute(append(args, tc.short...)); status != exitMatch {
+				t.Fatalf("Expected status %v but got %v", exitMatch, status)
+			}
+			expected := got.String()
+
+			rootCmd.Flags().Set(linesAfterMatchFlag, "0")
+			rootCmd.Flags().Set(linesBeforeMatchFlag, "0")
+			got.Reset()
+			if status := execute(append(args, tc.long...)); status != exitMatch {
+				t.Fatalf("Expected status %v but got %v", exitMatch, status)
+			}
+			if got.String() != expected {
+				t.Errorf("Expected %q but got %q", expected, got.String())
+			}
+		})
+	}
+}
+
+func TestRunSingleFileExtFilter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		includeExt []string
+		excludeExt []string
+		noMessages bool
+		expected   string
+		expErr     string
+		expStatus  int
+	}{
+		{
+			name:       "excluded file",
+			excludeExt: []string{"txt"},
+			expErr:     "../testdata/cmd_test/test1.txt: extension filter, skipped\n",
+			expStatus:  exitNoMatch,
+		},
+		{
+			name:       "excluded file with noMessages",
+			excludeExt: []string{"txt"},
+			noMessages: true,
+			expStatus:  exitNoMatch,
+		},
+		{
+			name:       "not included file",
+			includeExt: []string{"md"},
+			expErr:     "../testdata/cmd_test/test1.txt: extension filter, skipped\n",
+			expStatus:  exitNoMatch,
+		},
+		{
+			name:       "included file",
+			includeExt: []string{"txt"},
+			expected:   "this is a test file\none can test a program by running test cases\n",
+			expStatus:  exitMatch,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got, gotErr bytes.Buffer
+			status := run(os.DirFS("/"), input{
+				output: &got,
+				errOutput: &gotErr,
+				keyword: "test",
+				path: "../testdata/cmd_test/test1.txt",
+				includeExt: tc.includeExt,
+				excludeExt: tc.excludeExt,
+				noMessages: tc.noMessages,
+			})
+			if got.String() != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, got.String())
+			}
+			if gotErr.String() != tc.expErr {
+				t.Errorf("Expected %q but got %q", tc.expErr, gotErr.String())
+			}
+			if status != tc.expStatus {
+				t.Errorf("Expected status %v but got %v", tc.expStatus, status)
+			}
+		})
+	}
+}
+
+func TestRunFilesFromStdin(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("match "+name+"\n"), 0644); err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+	}
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	list := filepath.Join(dir, "list.txt")
+	if err := os.WriteFile(list, []byte(a+"\n-\n"+b+"\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+
+	// stdin is searched in its place in list
+	var output bytes.Buffer
+	got := run(os.DirFS("/"), input{
+		stdin: strings.NewReader("match stdin\nnone\n"),
+		output: &output,
+		keyword: "match",
+		filesFrom: list,
+		lineNumber: true,
+	})
+	if got != exitMatch {
+		t.Errorf("Expected %v but got %v", exitMatch, got)
+	}
+	expected := a + ":1:match a.txt\n(standard input):1:match stdin\n" + b + ":1:match b.txt\n"
+	if output.String() != expected {
+		t.Errorf("Expected %q but got %q", expected, output.String())
+	}
+
+	// stdin is an error if it's a terminal, other files are still searched
+	defer func(f func(io.Reader) bool) { isTerminalInput = f }(isTerminalInput)
+	isTerminalInput = func(r io.Reader) bool { return true }
+	output.Reset()
+	got = run(os.DirFS("/"), input{
+		stdin: strings.NewReader(""),
+		output: &output,
+		keyword: "match",
+		filesFrom: list,
+		filesWithMatches: true,
+	})
+	if got != exitError {
+		t.Errorf("Expected %v but got %v", exitError, got)
+	}
+	expected = errStdinTerminal.Error() + "\n" + a + "\n" + b + "\n"
+	if output.String() != expected {
+		t.Errorf("Expected %q but got %q", expected, output.String())
+	}
+
+	// stdin listed again is an error, it's searched only once
+	isTerminalInput = func(r io.Reader) bool { return false }
+	if err := os.WriteFile(list, []byte("-\n"+a+"\n-\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	output.Reset()
+	got = run(os.DirFS("/"), input{
+		stdin: strings.NewReader("match stdin\n"),
+		output: &output,
+		keyword: "match",
+		filesFrom: list,
+	})
+	if got != exitError {
+		t.Errorf("Expected %v but got %v", exitError, got)
+	}
+	expected = errStdinListedTwice.Error() + "\n(standard input):match stdin\n" + a + ":match a.txt\n"
+	if output.String() != expected {
+		t.Errorf("Expected %q but got %q", expected, output.String())
+	}
+}
+
+func TestRunColorColumns(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    input
+		expected string
+	}{
+		{
+			name:     "default colors",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/inner", searchDir: true, lineNumber: true, colorColumns: defaultColors},
+			expected: "\033[35m\033[K../testdata/cmd_test/inner/test2.txt\033[m\033[K\033[36m\033[K:\033[m\033[K" +
+				"\033[32m\033[K1\033[m\033[K\033[36m\033[K:\033[m\033[K" +
+				"this file contains a \033[01;31m\033[Ktest\033[m\033[K line\n",
+		},
+		{
+			name:     "spec on top of the defaults",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/inner", searchDir: true, colorColumns: "fn=34:se=:ne"},
+			expected: "\033[34m\033[K../testdata/cmd_test/inner/test2.txt\033[m\033[K:this file contains a \033[01;31m\033[Ktest\033[m\033[K line\n",
+		},
+		{
+			name:     "files with matches",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/inner", searchDir: true, filesWithMatches: true, colorColumns: "fn=35"},
+			expected: "\033[35m\033[K../testdata/cmd_test/inner/test2.txt\033[m\033[K\n",
+		},
+		{
+			name:     "invalid spec",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/inner", searchDir: true, colorColumns: "fn=red"},
+			expected: "fn=red: " + errInvalidColors.Error() + "\n",
+		},
+		{
+			name:     "with mark",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/inner", searchDir: true, colorColumns: defaultColors, mark: []string{"[", "]"}},
+			expected: errColorsMark.Error() + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bytes.Buffer
+			tc.input.output = &got
+			tc.input.errOutput = io.Discard
+			run(os.DirFS("/"), tc.input)
+			if got.String() != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, got.String())
+			}
+		})
+	}
+}
+
+func TestRunFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("error: first\ninfo\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+
+	// appends the lines while the file is followed
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return
+		}
+		defer file.Close()
+		file.WriteString("debug\nerror: second\n")
+	}()
+
+	var output, errOutput bytes.Buffer
+	got := run(os.DirFS("/"), input{
+		output: &output,
+		errOutput: &errOutput,
+		keyword: "error",
+		path: path,
+		lineNumber: true,
+		follow: true,
+		timeout: 1500 * time.Millisecond,
+	})
+	if got != exitTimeout {
+		t.Errorf("Expected %v but got %v", exitTimeout, got)
+	}
+	expected := "1:error: first\n4:error: second\n"
+	if output.String() != expected {
+		t.Errorf("Expected %q but got %q", expected, output.String())
+	}
+
+	// only a single file can be followed
+	output.Reset()
+	got = run(os.DirFS("/"), input{output: &output, keyword: "error", path: filepath.Dir(path), searchDir: true, follow: true})
+	if got != exitError || output.String() != errFollowPath.Error()+"\n" {
+		t.Errorf("Expected %q with %v but got %q with %v", errFollowPath.Error()+"\n", exitError, output.String(), got)
+	}
+}
+
+func TestRunPatternStdin(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("info start\nerror: disk\nerror\r\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	list := filepath.Join(dir, "list.txt")
+	if err := os.WriteFile(list, []byte(file+"\n-\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		input    input
+		stdin    string
+		status   int
+		expected string
+	}{
+		{
+			name:     "pattern for the file",
+			input:    input{path: file, lineNumber: true},
+			stdin:    "error:\n",
+			status:   exitMatch,
+			expected: "2:error: disk\n",
+		},
+		{
+			name:     "pattern with carriage return and without new line",
+			input:    input{path: file},
+			stdin:    "info start\r",
+			status:   exitMatch,
+			expected: "info start\n",
+		},
+		{
+			name:     "rest of stdin is left for the list",
+			input:    input{filesFrom: list},
+			stdin:    "disk\nno disk here\nnone\n",
+			status:   exitMatch,
+			expected: file + ":error: disk\n(standard input):no disk here\n",
+		},
+		{
+			name:     "empty stdin",
+			input:    input{path: file},
+			stdin:    "",
+			status:   exitError,
+			expected: errNoPatternStdin.Error() + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var output bytes.Buffer
+			tc.input.output = &output
+			tc.input.stdin = strings.NewReader(tc.stdin)
+			tc.input.patternStdin = true
+			got := run(os.DirFS("/"), tc.input)
+			if got != tc.status {
+				t.Errorf("Expected %v but got %v", tc.status, got)
+			}
+			if output.String() != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, output.String())
+			}
+		})
+	}
+}
+
+func TestRunStdinTerminal(t *testing.T) {
+	defer func(f func(io.Reader) bool) { isTerminalInput = f }(isTerminalInput)
+	isTerminalInput = func(r io.Reader) bool { return true }
+
+	testCases := []struct {
+		name      string
+		input     input
+		expStatus int
+		expOutput string
+	}{
+		{name: "stdin", input: input{keyword: "test"}, expStatus: exitError, expOutput: errStdinTerminal.Error() + "\n"},
+		{name: "files from stdin", input: input{keyword: "test", filesFrom: "-"}, expStatus: exitError, expOutput: errStdinTerminal.Error() + "\n"},
+		{name: "path isn't affected", input: input{keyword: "vibgyor", path: "../testdata/cmd_test/test1.txt"}, expStatus: exitNoMatch, expOutput: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bytes.Buffer
+			tc.input.output = &got
+			tc.input.stdin = strings.NewReader("test line\n")
+			status := run(os.DirFS("/"), tc.input)
+			if status != tc.expStatus {
+				t.Errorf("Expected status %v but got %v", tc.expStatus, status)
+			}
+			if got.String() != tc.expOutput {
+				t.Errorf("Expected %q but got %q", tc.expOutput, got.String())
+			}
+		})
+	}
+}
+
+func TestProgressPrinter(t *testing.T) {
+	var got bytes.Buffer
+	printProgress := progressPrinter(&got)
+	printProgress(1, 2)
+	// calls within 100ms of the last print are dropped
+	printProgress(2, 3)
+	if want := "\r\033[Kfiles scanned: 1, matches: 2"; got.String() != want {
+		t.Errorf("Expected %q but got %q", want, got.String())
+	}
+
+	// progress isn't shown if stderr isn't a terminal
+	var gotErr bytes.Buffer
+	run(os.DirFS("/"), input{output: &got, errOutput: &gotErr, keyword: "test", path: "../testdata/cmd_test", searchDir: true, progress: true})
+	if gotErr.Len() != 0 {
+		t.Errorf("Expected no progress but got %q", gotErr.String())
+	}
+}
+
+func TestRunPathMode(t *testing.T) {
+	absDir, err := filepath.Abs("../testdata/cmd_test")
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		input    input
+		expected string
+	}{
+		{
+			name:     "relative in -r",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, excludeDir: []string{"inner"}, pathMode: pathRelative},
+			expected: "../testdata/cmd_test/test1.txt:this is a test file\n../testdata/cmd_test/test1.txt:one can test a program by running test cases\n",
+		},
+		{
+			name:     "absolute in -r",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, excludeDir: []string{"inner"}, pathMode: pathAbsolute},
+			expected: absDir + "/test1.txt:this is a test file\n" + absDir + "/test1.txt:one can test a program by running test cases\n",
+		},
+		{
+			name:     "absolute for a single file",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/test1.txt", filesWithMatches: true, pathMode: pathAbsolute},
+			expected: absDir + "/test1.txt\n",
+		},
+		{
+			name:     "separator in -r",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, excludeDir: []string{"inner"}, filesWithMatches: true, pathSeparator: `\`},
+			expected: `..\testdata\cmd_test\test1.txt` + "\n",
+		},
+		{
+			name:     "separator for a single file",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/test1.txt", withFileName: true, pathSeparator: `\`},
+			expected: `..\testdata\cmd_test\test1.txt:this is a test file` + "\n" + `..\testdata\cmd_test\test1.txt:one can test a program by running test cases` + "\n",
+		},
+		{
+			name:     "first component stripped in -r",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, stripPrefix: 1},
+			expected: "testdata/cmd_test/inner/test2.txt:this file contains a test line\ntestdata/cmd_test/test1.txt:this is a test file\ntestdata/cmd_test/test1.txt:one can test a program by running test cases\n",
+		},
+		{
+			name:     "components stripped before separator",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, filesWithMatches: true, stripPrefix: 2, pathSeparator: `\`},
+			expected: `cmd_test\inner\test2.txt` + "\n" + `cmd_test\test1.txt` + "\n",
+		},
+		{
+			name:     "file name kept",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/test1.txt", lineCount: true, json: true, stripPrefix: 10},
+			expected: `{"path":"test1.txt","count":2}` + "\n",
+		},
+		{
+			name:     "absolute in json",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/test1.txt", lineCount: true, json: true, pathMode: pathAbsolute},
+			expected: `{"path":"` + absDir + `/test1.txt","count":2}` + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bytes.Buffer
+			tc.input.output = &got
+			run(os.DirFS("/"), tc.input)
+			if got.String() != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, got.String())
+			}
+			if tc.input.pathMode == pathAbsolute && !strings.HasPrefix(strings.TrimPrefix(got.String(), `{"path":"`), string(filepath.Separator)) {
+				t.Errorf("Expected absolute path but got %q", got.String())
+			}
+		})
+	}
+}
+
+func TestRunDirectories(t *testing.T) {
+	testCases := []struct {
+		name        string
+		directories string
+		expected    string
+		expStatus   int
+	}{
+		{
+			name:        "read",
+			directories: directoriesRead,
+			expected:    "../testdata/cmd_test/inner: is a directory\n",
+			expStatus:   exitError,
+		},
+		{
+			name:        "skip",
+			directories: directoriesSkip,
+			expected:    "",
+			expStatus:   exitNoMatch,
+		},
+		{
+			name:        "recurse",
+			directories: directoriesRecurse,
+			expected:    "../testdata/cmd_test/inner/test2.txt:this file contains a test line\n",
+			expStatus:   exitMatch,
+		},
+		{
+			name:        "invalid action",
+			directories: "vibgyor",
+			expected:    "vibgyor: " + errInvalidDirectories.Error() + "\n",
+			expStatus:   exitError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bytes.Buffer
+			status := run(os.DirFS("/"), input{output: &got, keyword: "test", path: "../testdata/cmd_test/inner", directories: tc.directories})
+			if got.String() != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, got.String())
+			}
+			if status != tc.expStatus {
+				t.Errorf("Expected status %v but got %v", tc.expStatus, status)
+			}
+		})
+	}
+}
+
+func TestRunExactOutput(t *testing.T) {
+	namedReplace := "${val}:${key} costs $$1"
+	testCases := []struct {
+		name     string
+		input    input
+		stdin    string
+		expected string
+	}{
+		{
+			name:     "single file",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/test1.txt"},
+			expected: "this is a test file\none can test a program by running test cases\n",
+		},
+		{
+			name:     "single file without matches",
+			input:    input{keyword: "vibgyor", path: "../testdata/cmd_test/test1.txt"},
+			expected: "",
+		},
+		{
+			name:     "single file with line count",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/test1.txt", lineCount: true},
+			expected: "2\n",
+		},
+		{
+			name:     "stdin with empty matched line",
+			input:    input{keyword: ""},
+			stdin:    "line1\n\nline3\n",
+			expected: "line1\n\nline3\n",
+		},
+		{
+			name:     "directory with -r",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true},
+			expected: "../testdata/cmd_test/inner/test2.txt:this file contains a test line\n../testdata/cmd_test/test1.txt:this is a test file\n../testdata/cmd_test/test1.txt:one can test a program by running test cases\n",
+		},
+		{
+			name:     "directory with -r with line count",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, lineCount: true},
+			expected: "../testdata/cmd_test/inner/test2.txt:1\n../testdata/cmd_test/test1.txt:2\n",
+		},
+		{
+			name:     "multiline match spanning lines",
+			input:    input{keyword: "file.one", path: "../testdata/cmd_test/test1.txt", regexp: true, multiline: true},
+			expected: "file\none\n",
+		},
+		{
+			name:     "multiline match spanning lines with files with matches",
+			input:    input{keyword: "file.one", path: "../testdata/cmd_test/test1.txt", regexp: true, multiline: true, filesWithMatches: true},
+			expected: "../testdata/cmd_test/test1.txt\n",
+		},
+		{
+			name:     "multiline match spanning lines with files with matches in -r",
+			input:    input{keyword: "file.one", path: "../testdata/cmd_test", searchDir: true, regexp: true, multiline: true, filesWithMatches: true},
+			expected: "../testdata/cmd_test/test1.txt\n",
+		},
+		{
+			name:     "stdin with trim",
+			input:    input{keyword: "  return", trim: true, lineNumber: true},
+			stdin:    "func main() {\n\t  return nil  \n}\n",
+			expected: "2:return nil\n",
+		},
+		{
+			name:     "stdin with custom group separator",
+			input:    input{keyword: "match", linesAfterMatch: 1, groupSeparator: "=="},
+			stdin:    "match1\nline2\nline3\nmatch4\nline5\nmatch6\nline7\n",
+			expected: "match1\nline2\n==\nmatch4\nline5\nmatch6\nline7\n",
+		},
+		{
+			name:     "stdin with no group separator",
+			input:    input{keyword: "match", linesBeforeMatch: 1, groupSeparator: "--", noGroupSeparator: true},
+			stdin:    "line1\nmatch2\nline3\nline4\nmatch5\n",
+			expected: "line1\nmatch2\nline4\nmatch5\n",
+		},
+		{
+			name:     "stdin with matches per line capped",
+			input:    input{keyword: "ab", onlyMatching: true, maxMatchesPerLine: 2, lineNumber: true},
+			stdin:    "ab ab ab ab\nab\n",
+			expected: "1:ab\n1:ab\n2:ab\n",
+		},
+		{
+			name:     "stdin with all keywords",
+			input:    input{keyword: "error", allKeywords: []string{"timeout"}, ignoreCase: true},
+			stdin:    "error: read timeout\nerror: not found\ntimeout reached\nTIMEOUT, ERROR\n",
+			expected: "error: read timeout\nTIMEOUT, ERROR\n",
+		},
+		{
+			name:     "stdin with lines excluded by pattern",
+			input:    input{keyword: "error", butNot: "known", lineNumber: true},
+			stdin:    "error: known issue\nerror: disk full\nerror: known bug\nno issue\n",
+			expected: "2:error: disk full\n",
+		},
+		{
+			name:     "stdin with head lines",
+			input:    input{keyword: "match", head: 2, lineNumber: true},
+			stdin:    "match one\nnone\nmatch three\n",
+			expected: "1:match one\n",
+		},
+		{
+			name:     "stdin with named groups in replace",
+			input:    input{keyword: `(?P<key>\w+)=(?P<val>\w+)`, regexp: true, replace: &namedReplace},
+			stdin:    "level=info\nnone\n",
+			expected: "info:level costs $1\n",
+		},
+		{
+			name:     "stdin with a binary match",
+			input:    input{keyword: "match"},
+			stdin:    "a\x00b\nmatch\n",
+			expected: "Binary file (standard input) matches\n",
+		},
+		{
+			name:     "stdin with a binary match in json",
+			input:    input{keyword: "match", json: true},
+			stdin:    "a\x00b\nmatch\n",
+			expected: "{\"binary\":true}\n",
+		},
+		{
+			name:     "stdin with a binary match as text in json",
+			input:    input{keyword: "match", json: true, text: true},
+			stdin:    "a\x00b\nmatch\n",
+			expected: "{\"line_number\":2,\"line\":\"match\"}\n",
+		},
+		{
+			name:     "stdin with binary matches ignored",
+			input:    input{keyword: "match", ignoreBinaryMatches: true},
+			stdin:    "a\x00b\nmatch\n",
+			expected: "",
+		},
+		{
+			name:     "stdin with a binary match as text",
+			input:    input{keyword: "match", text: true, ignoreBinaryMatches: true},
+			stdin:    "a\x00b match\nnone\n",
+			expected: "a\x00b match\n",
+		},
+		{
+			name:     "stdin with plural",
+			input:    input{keyword: "apples", plural: true},
+			stdin:    "an apple\ntwo apples\nit applies\n",
+			expected: "an apple\ntwo apples\n",
+		},
+		{
+			name:     "stdin with a field",
+			input:    input{keyword: "error", field: 2, fieldSep: ",", lineNumber: true},
+			stdin:    "error,ok\nok,error\nok,ok,error\n",
+			expected: "2:ok,error\n",
+		},
+		{
+			name:     "stdin with snippets",
+			input:    input{keyword: "error", snippet: 3, lineNumber: true},
+			stdin:    "aaaaaaaa error bbbbbbbb\nnone\nerror\n",
+			expected: "1:...aa error bb...\n3:error\n",
+		},
+		{
+			name:     "stdin with marked matches",
+			input:    input{keyword: "error", mark: []string{"[[", "]]"}, ignoreCase: true},
+			stdin:    "an error, ERROR\nnone\n",
+			expected: "an [[error]], [[ERROR]]\n",
+		},
+		{
+			name:     "stdin with byte offset",
+			input:    input{keyword: "match", byteOffset: true, lineNumber: true},
+			stdin:    "ab\r\nmatch\nx match",
+			expected: "2:4:match\n3:10:x match\n",
+		},
+		{
+			name:     "stdin with line range",
+			input:    input{keyword: "match", lines: "2:3", lineNumber: true},
+			stdin:    "match one\nnone\nmatch three\nmatch four\n",
+			expected: "3:match three\n",
+		},
+		{
+			name:     "stdin with tail lines",
+			input:    input{keyword: "match", tail: 2, lineNumber: true},
+			stdin:    "match one\nnone\nmatch three\n",
+			expected: "3:match three\n",
+		},
+		{
+			name:     "stdin with blank lines skipped",
+			input:    input{keyword: "", skipBlank: true, lineCount: true},
+			stdin:    "one\n\n   \ntwo\n\t\n",
+			expected: "2\n",
+		},
+		{
+			name:     "stdin with literal and regexp patterns",
+			input:    input{keyword: "panic", patterns: []string{"a.b"}, regexPatterns: []string{"time(out|d out)"}, onlyMatching: true},
+			stdin:    "a.b timed out\naxb\npanic: timeout\nok\n",
+			expected: "a.b\ntimed out\npanic\ntimeout\n",
+		},
+		{
+			name:     "stdin with ignore case of ASCII only",
+			input:    input{keyword: "café", ignoreCase: true, noUnicode: true},
+			stdin:    "CAFÉ\nCAFé\ncafé\n",
+			expected: "CAFé\ncafé\n",
+		},
+		{
+			name:     "stdin with context joined",
+			input:    input{keyword: "match", linesBeforeMatch: 1, linesAfterMatch: 1, groupSeparator: "--", join: " | "},
+			stdin:    "line1\nmatch2\nline3\nline4\nline5\nmatch6\nline7\nmatch8\n",
+			expected: "line1 | match2 | line3\nline5 | match6 | line7 | match8\n",
+		},
+		{
+			name:     "directory with -r with context joined",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, linesAfterMatch: 1, join: " | ", lineNumber: true},
+			expected: "../testdata/cmd_test/inner/test2.txt:1:this file contains a test line | 2:nothing here\n" +
+				"../testdata/cmd_test/test1.txt:2:this is a test file | 3:one can test a program by running test cases | 4:something here\n",
+		},
+		{
+			name:     "directory with -r with count of all files",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, countAll: true},
+			expected: "../testdata/cmd_test/inner/test1.txt:0\n../testdata/cmd_test/inner/test2.txt:1\n../testdata/cmd_test/test1.txt:2\n../testdata/cmd_test/test2.txt:0\n",
+		},
+		{
+			name:     "single file without matches with count of all files",
+			input:    input{keyword: "vibgyor", path: "../testdata/cmd_test/test1.txt", countAll: true},
+			expected: "0\n",
+		},
+		{
+			name:     "directory with -r with report",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, report: true, excludeDir: []string{"inner"}},
+			expected: "../testdata/cmd_test/test1.txt:matched\n../testdata/cmd_test/test2.txt:not matched\n",
+		},
+		{
+			name:     "directory with -r with report in json",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, report: true, json: true, excludeDir: []string{"inner"}},
+			expected: "{\"path\":\"../testdata/cmd_test/test1.txt\",\"matched\":true}\n{\"path\":\"../testdata/cmd_test/test2.txt\",\"matched\":false}\n",
+		},
+		{
+			name:     "directory with -r with total limit above the matches",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, maxTotal: 5, lineCount: true},
+			expected: "../testdata/cmd_test/inner/test2.txt:1\n../testdata/cmd_test/test1.txt:2\n",
+		},
+		{
+			name:     "directory with -r sorted by count in reverse",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, sort: "count", sortReverse: true, lineCount: true},
+			expected: "../testdata/cmd_test/test1.txt:2\n../testdata/cmd_test/inner/test2.txt:1\n",
+		},
+		{
+			name:     "directory with -r with group separator between files",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, linesAfterMatch: 1, groupSeparator: "--"},
+			expected: "../testdata/cmd_test/inner/test2.txt:this file contains a test line\n" +
+				"../testdata/cmd_test/inner/test2.txt:nothing here\n" +
+				"--\n" +
+				"../testdata/cmd_test/test1.txt:this is a test file\n" +
+				"../testdata/cmd_test/test1.txt:one can test a program by running test cases\n" +
+				"../testdata/cmd_test/test1.txt:something here\n",
+		},
+		{
+			name:     "stdin with line delimiter",
+			input:    input{keyword: "match", lineDelim: ";", lineNumber: true},
+			stdin:    "a;match;b;match again",
+			expected: "2:match;4:match again;",
+		},
+		{
+			name:     "single file with preprocessor",
+			input:    input{keyword: "TEST", path: "../testdata/cmd_test/test1.txt", pre: "sed s/test/TEST/g"},
+			expected: "this is a TEST file\none can TEST a program by running TEST cases\n",
+		},
+		{
+			name:     "stdin with invalid UTF-8 replaced",
+			input:    input{keyword: "match", encodingErrorMode: "replace", lineNumber: true},
+			stdin:    "caf\xe9 match\nno match \xff\xfe\nmatch\n",
+			expected: "1:caf\ufffd match\n2:no match \ufffd\n3:match\n",
+		},
+		{
+			name:     "stdin with invalid UTF-8 skipped",
+			input:    input{keyword: "match", encodingErrorMode: "skip", lineNumber: true},
+			stdin:    "caf\xe9 match\nno match \xff\xfe\nmatch\n",
+			expected: "3:match\n",
+		},
+		{
+			name:     "stdin with expand tabs",
+			input:    input{keyword: "apples-\t", expandTabs: 8},
+			stdin:    "apples-\tmangoes\ngrapes\n",
+			expected: "apples- mangoes\n",
+		},
+		{
+			name:     "directory with -r with heading",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, heading: true},
+			expected: "../testdata/cmd_test/inner/test2.txt:\n1:this file contains a test line\n\n../testdata/cmd_test/test1.txt:\n2:this is a test file\n3:one can test a program by running test cases\n",
+		},
+		{
+			name:     "single file with heading",
+			input:    input{keyword: "test", path: "../testdata/cmd_test/test1.txt", heading: true},
+			expected: "this is a test file\none can test a program by running test cases\n",
+		},
+		{
+			name:     "directory with -r with path filter",
+			input:    input{keyword: "test", path: "../testdata/cmd_test", searchDir: true, pathFilter: "^inner/"},
+			expected: "../testdata/cmd_test/inner/test2.txt:this file contains a test line\n",
+		},
+		{
+			name:     "directory with name only",
+			input:    input{keyword: "^inner/.*2", path: "../testdata/cmd_test", regexp: true, nameOnly: true},
+			expected: "../testdata/cmd_test/inner/test2.txt\n",
+		},
+		{
+			name:     "files from stdin separated by NUL",
+			input:    input{keyword: "test", filesFrom: "-"},
+			stdin:    "../testdata/cmd_test/test1.txt\x00../testdata/cmd_test/inner/test2.txt\x00",
+			expected: "../testdata/cmd_test/test1.txt:this is a test file\n../testdata/cmd_test/test1.txt:one can test a program by running test cases\n../testdata/cmd_test/inner/test2.txt:this file contains a test line\n",
+		},
+		{
+			name:     "files from stdin separated by new line",
+			input:    input{keyword: "test", filesFrom: "-", lineCount: true},
+			stdin:    "../testdata/cmd_test/test1.txt\n../testdata/cmd_test/inner/test2.txt\n",
+			expected: "../testdata/cmd_test/test1.txt:2\n../testdata/cmd_test/inner/test2.txt:1\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bytes.Buffer
+			tc.input.output = &got
+			tc.input.stdin = strings.NewReader(tc.stdin)
+			run(os.DirFS("/"), tc.input)
+			if got.String() != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, got.String())
+			}
+
+			// same output is expected when writing to file
+			var gotStdout bytes.Buffer
+			tc.input.output = &gotStdout
+			tc.input.stdin = strings.NewReader(tc.stdin)
+			tc.input.fileWName = filepath.Join(t.TempDir(), "output.txt")
+			run(os.DirFS("/"), tc.input)
+			data, err := os.ReadFile(tc.input.fileWName)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(data) != tc.expected {
+				t.Errorf("Expected %q in file but got %q", tc.expected, string(data))
+			}
+		})
+	}
+}
+
+func TestRunJSON(t *testing.T) {
+	testCases := []struct {
+		name      string
+		path      string
+		keyword   string
+		searchDir bool
+		lineCount bool
+		matches   []jsonMatch
+		counts    []jsonCount
+	}{
+		{
+			name:    "greps on a multi-line file",
+			path:    "../testdata/cmd_test/test1.txt",
+			keyword: "test",
+			matches: []jsonMatch{
+				{Path: "../testdata/cmd_test/test1.txt", LineNumber: 2, Line: "this is a test file"},
+				{Path: "../testdata/cmd_test/test1.txt", LineNumber: 3, Line: "one can test a program by running test cases"},
+			},
+		},
+		{
+			name:      "greps inside a directory with -r",
+			path:      "../testdata/cmd_test",
+			keyword:   "test",
+			searchDir: true,
+			matches: []jsonMatch{
+				{Path: "../testdata/cmd_test/test1.txt", LineNumber: 2, Line: "this is a test file"},
+				{Path: "../testdata/cmd_test/test1.txt", LineNumber: 3, Line: "one can test a program by running test cases"},
+				{Path: "../testdata/cmd_test/inner/test2.txt", LineNumber: 1, Line: "this file contains a test line"},
+			},
+		},
+		{
+			name:      "greps inside a directory with -r with line count option",
+			path:      "../testdata/cmd_test",
+			keyword:   "test",
+			searchDir: true,
+			lineCount: true,
+			counts: []jsonCount{
+				{Path: "../testdata/cmd_test/test1.txt", Count: 2},
+				{Path: "../testdata/cmd_test/inner/test2.txt", Count: 1},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bytes.Buffer
+			run(os.DirFS("/"), input{
+				output: &got,
+				keyword: tc.keyword,
+				path: tc.path,
+				searchDir: tc.searchDir,
+				lineCount: tc.lineCount,
+				json: true,
+			})
+
+			lines := strings.Split(strings.TrimSpace(got.String()), "\n")
+			if len(lines) != len(tc.matches)+len(tc.counts) {
+				t.Fatalf("Expected %d json lines but got %q", len(tc.matches)+len(tc.counts), got.String())
+			}
+
+			// parsing each line back and checking if it was expected
+			for _, line := range lines {
+				if tc.lineCount {
+					var c jsonCount
+					if err := json.Unmarshal([]byte(line), &c); err != nil {
+						t.Fatalf("Unexpected error while parsing %q: %v", line, err)
+					}
+					if !slices.Contains(tc.counts, c) {
+						t.Errorf("Unexpected record %+v in output %q", c, got.String())
+					}
+					continue
+				}
+
+				var m jsonMatch
+				if err := json.Unmarshal([]byte(line), &m); err != nil {
+					t.Fatalf("Unexpected error while parsing %q: %v", line, err)
+				}
+				if !slices.Contains(tc.matches, m) {
+					t.Errorf("Unexpected record %+v in output %q", m, got.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWriteToFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filePath string
+		existing string
+		content  string
+		mode     writeMode
+		expected string
+		expErr   error
+	}{
+		{name: "write to file", filePath: "test.txt", content: "test only", expected: "test only", expErr: nil},
+		{name: "write to already created file", filePath: "test.txt", existing: "old content", content: "test only", expErr: os.ErrExist},
+		{name: "write to already created file with force", filePath: "test.txt", existing: "old content which is longer", content: "test only", mode: overwriteMode, expected: "test only", expErr: nil},
+		{name: "append to file", filePath: "test.txt", content: "test only", mode: appendMode, expected: "test only", expErr: nil},
+		{name: "append to already created file", filePath: "test.txt", existing: "old content\n", content: "test only", mode: appendMode, expected: "old content\ntest only", expErr: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// creates the file with existing content beforehand
+			if tc.existing != "" {
+				if err := os.WriteFile(tc.filePath, []byte(tc.existing), 0644); err != nil {
+					t.Fatalf("Unexpected error while setting up test: %v", err)
+				}
+			}
+
+			err := writeToFile(tc.filePath, tc.content, tc.mode)
+			defer os.Remove(tc.filePath)
+
+			if tc.expErr != nil {
+				if err == nil {
+					t.Fatalf("Expected error but didn't got one")
+				}
+
+				if !errors.Is(err, tc.expErr) {
+					t.Errorf("Expected error %v but got %v", tc.expErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			data, err := os.ReadFile(tc.filePath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if string(data) != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, string(data))
+			}
+		})
+	}
+}
+
+func TestWriteToFileNestedPath(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "results", "today", "matches.txt")
+
+	if err := writeToFile(filePath, "test only", createMode); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// checking the parent directories
+	for _, d := range []string{filepath.Join(dir, "results"), filepath.Join(dir, "results", "today")} {
+		info, err := os.Stat(d)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !info.IsDir() {
+			t.Errorf("Expected %s to be a directory", d)
+		}
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != "test only" {
+		t.Errorf("Expected %q but got %q", "test only", string(data))
+	}
+}
+
+func TestEditInPlace(t *testing.T) {
+	testCases := []struct {
+		name         string
+		keyword      string
+		regexp       bool
+		backupSuffix string
+		expected     string
+		expErr       bool
+	}{
+		{name: "edits the file", keyword: "apple", expected: "mango pie\nno match\nmango juice\n"},
+		{name: "edits the file with backup", keyword: "apple", backupSuffix: ".bak", expected: "mango pie\nno match\nmango juice\n"},
+		{name: "fails and leaves the file intact", keyword: "apple(", regexp: true, expErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filePath := filepath.Join(dir, "test.txt")
+			original := "apple pie\nno match\napple juice\n"
+			if err := os.WriteFile(filePath, []byte(original), 0640); err != nil {
+				t.Fatalf("Unexpected error while setting up test: %v", err)
+			}
+
+			replace := "mango"
+			err := editInPlace(filePath, grep.GrepOptions{Keyword: tc.keyword, Regexp: tc.regexp, Replace: &replace}, tc.backupSuffix)
+
+			data, readErr := os.ReadFile(filePath)
+			if readErr != nil {
+				t.Fatalf("Unexpected error: %v", readErr)
+			}
+			entries, readErr := os.ReadDir(dir)
+			if readErr != nil {
+				t.Fatalf("Unexpected error: %v", readErr)
+			}
+
+			if tc.expErr {
+				if err == nil {
+					t.Fatalf("Expected error but didn't got one")
+				}
+				if string(data) != original {
+					t.Errorf("Expected original content %q but got %q", original, string(data))
+				}
+				if len(entries) != 1 {
+					t.Errorf("Expected temp file to be removed but found %d entries", len(entries))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(data) != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, string(data))
+			}
+
+			// checking the permission is preserved
+			info, err := os.Stat(filePath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if info.Mode().Perm() != 0640 {
+				t.Errorf("Expected permission %v but got %v", fs.FileMode(0640), info.Mode().Perm())
+			}
+
+			if tc.backupSuffix == "" {
+				if len(entries) != 1 {
+					t.Errorf("Expected only the edited file but found %d entries", len(entries))
+				}
+				return
+			}
+			backup, err := os.ReadFile(filePath + tc.backupSuffix)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(backup) != original {
+				t.Errorf("Expected backup content %q but got %q", original, string(backup))
+			}
+		})
+	}
+}
+
+func TestRunInPlace(t *testing.T) {
+	replace := "mango"
+	testCases := []struct {
+		name   string
+		input  input
+		expErr error
+	}{
+		{name: "refuses stdin", input: input{stdin: strings.NewReader("apple"), keyword: "apple", replace: &replace, inPlace: true}, expErr: errInPlaceStdin},
+		{name: "refuses directory without -r", input: input{path: "../testdata/cmd_test", keyword: "apple", replace: &replace, inPlace: true}, expErr: grep.ErrIsDirectory},
+		{name: "refuses without replace", input: input{path: "../testdata/cmd_test/test1.txt", keyword: "apple", inPlace: true}, expErr: grep.ErrNoReplace},
+		{name: "refuses encoding", input: input{path: "../testdata/cmd_test/test1.txt", keyword: "test", replace: &replace, inPlace: true, encoding: "utf-16le"}, expErr: errInPlaceDecoded},
+		{name: "refuses preprocessor", input: input{path: "../testdata/cmd_test/test1.txt", keyword: "test", replace: &replace, inPlace: true, pre: "cat"}, expErr: errInPlaceDecoded},
+		{name: "refuses multiline", input: input{path: "../testdata/cmd_test/test1.txt", keyword: "test", regexp: true, replace: &replace, inPlace: true, multiline: true}, expErr: errInPlaceDecoded},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bytes.Buffer
+			tc.input.output = &got
+			run(os.DirFS("/"), tc.input)
+			if !strings.Contains(got.String(), tc.expErr.Error()) {
+				t.Errorf("Expected error %q not found in the final output %q", tc.expErr.Error(), got.String())
+			}
+		})
+	}
+}
+
+func TestRunInPlaceSelection(t *testing.T) {
+	replace := "Y"
+	testCases := []struct {
+		name     string
+		input    input
+		content  string
+		expected string
+	}{
+		{name: "only the lines in range", input: input{keyword: "x", lines: "2:2"}, expected: "a x\nb Y\nc x\n"},
+		{name: "only the first lines", input: input{keyword: "x", head: 1}, expected: "a Y\nb x\nc x\n"},
+		{name: "only the last lines", input: input{keyword: "x", tail: 2}, expected: "a x\nb Y\nc Y\n"},
+		{name: "tail longer than the file", input: input{keyword: "x", tail: 5}, expected: "a Y\nb Y\nc Y\n"},
+		{name: "only the field", input: input{keyword: "x", field: 2, fieldSep: ","}, content: "x,a\nx,x\na,bxb,x\n", expected: "x,a\nx,Y\na,bYb,x\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.content == "" {
+				tc.content = "a x\nb x\nc x\n"
+			}
+			filePath := filepath.Join(t.TempDir(), "test.txt")
+			if err := os.WriteFile(filePath, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("Unexpected error while setting up test: %v", err)
+			}
+
+			var got bytes.Buffer
+			tc.input.output, tc.input.path, tc.input.replace, tc.input.inPlace = &got, filePath, &replace, true
+			run(os.DirFS("/"), tc.input)
+			if got.Len() != 0 {
+				t.Fatalf("Expected no output but got %q", got.String())
+			}
+
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(data) != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, string(data))
+			}
+		})
+	}
+}
+
+func TestRunInPlaceRecursive(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"a.txt": "apple pie\n", "b.txt": "no match\n"}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+	}
+
+	var got bytes.Buffer
+	replace := "mango"
+	run(os.DirFS("/"), input{output: &got, keyword: "apple", path: dir, searchDir: true, replace: &replace, inPlace: true})
+	if got.Len() != 0 {
+		t.Fatalf("Expected no output but got %q", got.String())
+	}
+
+	expected := map[string]string{"a.txt": "mango pie\n", "b.txt": "no match\n"}
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(data) != content {
+			t.Errorf("Expected %q in %s but got %q", content, name, string(data))
+		}
+	}
+
+	// file which couldn't be searched is an error, others are still edited
+	if err := os.WriteFile(filepath.Join(dir, "c.txt"), []byte("apple \xff\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "d.txt"), []byte("apple tart\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	got.Reset()
+	status := run(os.DirFS("/"), input{output: &got, keyword: "apple", path: dir, searchDir: true, replace: &replace, inPlace: true, encodingErrorMode: "strict"})
+	if status != exitError {
+		t.Errorf("Expected status %v but got %v", exitError, status)
+	}
+	if !strings.Contains(got.String(), grep.ErrInvalidUTF8.Error()) {
+		t.Errorf("Expected error %q not found in the final output %q", grep.ErrInvalidUTF8.Error(), got.String())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "d.txt"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != "mango tart\n" {
+		t.Errorf("Expected %q but got %q", "mango tart\n", string(data))
+	}
+}
+
+// returns one line per read after a pause, like a slow pipe
+type slowReader struct {
+	lines []string
+	pause time.Duration
+}
+
+func(r *slowReader) Read(p []byte) (int, error) {
+	if len(r.lines) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.pause)
+	n := copy(p, r.lines[0])
+	r.lines = r.lines[1:]
+	return n, nil
+}
+
+func TestRunTimeout(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("line%d match\n", i))
+	}
+
+	var output, errOutput bytes.Buffer
+	got := run(os.DirFS("/"), input{
+		stdin: &slowReader{lines: lines, pause: 5 * time.Millisecond},
+		output: &output,
+		errOutput: &errOutput,
+		keyword: "match",
+		timeout: 50 * time.Millisecond,
+	})
+	if got != exitTimeout {
+		t.Errorf("Expected %v but got %v", exitTimeout, got)
+	}
+
+	// lines matched before the timeout are printed
+	printed := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if output.Len() == 0 || len(printed) >= len(lines) {
+		t.Fatalf("Expected partial output but got %d of %d lines", len(printed), len(lines))
+	}
+	for i, line := range printed {
+		if want := strings.TrimSuffix(lines[i], "\n"); line != want {
+			t.Errorf("Expected %q at index %d but got %q", want, i, line)
+		}
+	}
+
+	if !strings.Contains(errOutput.String(), "timed out after 50ms") {
+		t.Errorf("Expected timeout message but got %q", errOutput.String())
+	}
+}
+
+func TestRunFilesFromOrder(t *testing.T) {
+	// fewer workers than files, so that files wait for a free worker
+	defer func(n int) { filesFromWorkers = n }(filesFromWorkers)
+	filesFromWorkers = 3
+
+	// earlier files are larger, so they finish later than the ones after them
+	dir := t.TempDir()
+	var list, expected strings.Builder
+	for i := 0; i < 10; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("file%d.txt", i))
+		content := strings.Repeat("filler line\n", (10-i)*1000) + fmt.Sprintf("match %d\n", i)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+		fmt.Fprintf(&list, "%s\n", path)
+		fmt.Fprintf(&expected, "%s:match %d\n", path, i)
+	}
+	// missing file in between doesn't shift the results after it
+	list.WriteString(filepath.Join(dir, "missing.txt") + "\n")
+	path := filepath.Join(dir, "file10.txt")
+	if err := os.WriteFile(path, []byte("match 10\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	fmt.Fprintf(&list, "%s\n", path)
+	fmt.Fprintf(&expected, "%s:match 10\n", path)
+
+	var output, errOutput bytes.Buffer
+	got := run(os.DirFS("/"), input{
+		stdin: strings.NewReader(list.String()),
+		output: &output,
+		errOutput: &errOutput,
+		keyword: "match",
+		filesFrom: "-",
+		noMessages: true,
+	})
+	if got != exitError {
+		t.Errorf("Expected %v but got %v", exitError, got)
+	}
+	if output.String() != expected.String() {
+		t.Errorf("Expected %q but got %q", expected.String(), output.String())
+	}
+}
+
+// blocks on opening the file at path till release is closed, / is the root like os.DirFS("/")
+type blockingFS struct {
+	fs.FS
+	path string
+	release chan struct{}
+}
+
+func(f blockingFS) Open(name string) (fs.File, error) {
+	if name == f.path {
+		<-f.release
+	}
+	return f.FS.Open(name)
+}
+
+func(f blockingFS) String() string {
+	return "/"
+}
+
+// closes written on the first write
+type signalWriter struct {
+	mu sync.Mutex
+	buf bytes.Buffer
+	once sync.Once
+	written chan struct{}
+}
+
+func(w *signalWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	defer w.once.Do(func() { close(w.written) })
+	return w.buf.Write(p)
+}
+
+func(w *signalWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestRunStream(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "z.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("test line in "+name), 0644); err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+	}
+	blocked, err := getFullPath(os.DirFS("/"), filepath.Join(dir, "z.txt"))
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	fSys := blockingFS{FS: os.DirFS("/"), path: blocked, release: make(chan struct{})}
+	output := &signalWriter{written: make(chan struct{})}
+
+	status := make(chan int)
+	go func() {
+		status <- run(fSys, input{output: output, errOutput: io.Discard, keyword: "test", path: dir, searchDir: true, flushInterval: 10 * time.Millisecond})
+	}()
+
+	// lines of a.txt are printed while z.txt is still being opened
+	select {
+	case <-output.written:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected output before the search is done")
+	}
+	if want := filepath.Join(dir, "a.txt") + ":test line in a.txt\n"; output.String() != want {
+		t.Errorf("Expected %q but got %q", want, output.String())
+	}
+
+	close(fSys.release)
+	if got := <-status; got != exitMatch {
+		t.Errorf("Expected status %v but got %v", exitMatch, got)
+	}
+	want := filepath.Join(dir, "a.txt") + ":test line in a.txt\n" + filepath.Join(dir, "z.txt") + ":test line in z.txt\n"
+	if output.String() != want {
+		t.Errorf("Expected %q but got %q", want, output.String())
+	}
+}
+
+func TestFlushWriter(t *testing.T) {
+	var got bytes.Buffer
+	w := newFlushWriter(&got, time.Hour)
+	io.WriteString(w, "line1\n")
+	if got.Len() != 0 {
+		t.Errorf("Expected nothing before the flush but got %q", got.String())
+	}
+	// final flush writes what's buffered, without waiting for the interval
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.String() != "line1\n" {
+		t.Errorf("Expected %q but got %q", "line1\n", got.String())
+	}
+
+	// zero interval flushes on every write
+	got.Reset()
+	w = newFlushWriter(&got, 0)
+	io.WriteString(w, "line2\n")
+	if got.String() != "line2\n" {
+		t.Errorf("Expected %q but got %q", "line2\n", got.String())
+	}
+}
+
+func TestRunTar(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, member := range [][2]string{{"app.log", "line1\nline2 error"}, {"db.log", "line1"}} {
+		if err := tw.WriteHeader(&tar.Header{Name: member[0], Mode: 0644, Size: int64(len(member[1]))}); err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+		if _, err := tw.Write([]byte(member[1])); err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	archive := filepath.Join(t.TempDir(), "logs.tar")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+
+	var got bytes.Buffer
+	status := run(os.DirFS("/"), input{output: &got, keyword: "error", path: archive, tar: true})
+	if want := archive + ":app.log:line2 error\n"; got.String() != want {
+		t.Errorf("Expected %q but got %q", want, got.String())
+	}
+	if status != exitMatch {
+		t.Errorf("Expected status %v but got %v", exitMatch, status)
+	}
+}
+
+func TestRunZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, member := range [][2]string{{"app.log", "line1\nline2 error"}, {"db.log", "line1"}} {
+		w, err := zw.Create(member[0])
+		if err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+		if _, err := w.Write([]byte(member[1])); err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	archive := filepath.Join(t.TempDir(), "logs.zip")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+
+	var got bytes.Buffer
+	status := run(os.DirFS("/"), input{output: &got, keyword: "error", path: archive, zip: true})
+	if want := archive + ":app.log:line2 error\n"; got.String() != want {
+		t.Errorf("Expected %q but got %q", want, got.String())
+	}
+	if status != exitMatch {
+		t.Errorf("Expected status %v but got %v", exitMatch, status)
+	}
+}
+
+func TestStripComponents(t *testing.T) {
+	testCases := []struct {
+		path     string
+		n        int
+		expected string
+	}{
+		{path: "../testdata/a.txt", n: 0, expected: "../testdata/a.txt"},
+		{path: "../testdata/a.txt", n: 1, expected: "testdata/a.txt"},
+		{path: "../testdata/a.txt", n: 2, expected: "a.txt"},
+		{path: "../testdata/a.txt", n: 5, expected: "a.txt"},
+		{path: "/home/user/a.txt", n: 1, expected: "home/user/a.txt"},
+		{path: "a//b.txt", n: 1, expected: "/b.txt"},
+		{path: "a.txt", n: 1, expected: "a.txt"},
+	}
+
+	for _, tc := range testCases {
+		got := stripComponents(tc.path, tc.n)
+		if got != tc.expected {
+			t.Errorf("Expected %q for %q with %d but got %q", tc.expected, tc.path, tc.n, got)
+		}
+	}
+}
+
+func TestExpandTabs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		line     string
+		tabWidth int
+		expected string
+	}{
+		{name: "tab at the start", line: "\tline", tabWidth: 8, expected: "        line"},
+		{name: "tab just before the tab stop", line: "apples-\tx", tabWidth: 8, expected: "apples- x"},
+		{name: "tab at the tab stop", line: "abcdefgh\tx", tabWidth: 8, expected: "abcdefgh        x"},
+		{name: "consecutive tabs", line: "ab\t\tx", tabWidth: 4, expected: "ab      x"},
+		{name: "multi byte runes before tab", line: "café\tx", tabWidth: 8, expected: "café    x"},
+		{name: "without tabs", line: "no tabs", tabWidth: 8, expected: "no tabs"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := expandTabs(tc.line, tc.tabWidth)
+			if got != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestGetWriteMode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    input
+		expected writeMode
+	}{
+		{name: "default", input: input{}, expected: createMode},
+		{name: "force", input: input{force: true}, expected: overwriteMode},
+		{name: "append", input: input{append: true}, expected: appendMode},
+		{name: "append with force", input: input{force: true, append: true}, expected: appendMode},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := getWriteMode(tc.input); got != tc.expected {
+				t.Errorf("Expected mode %d but got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunWriteToFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "output.txt")
+	var got bytes.Buffer
+	run(os.DirFS("/"), input{
+		output: &got,
+		keyword: "test",
+		path: "../testdata/cmd_test",
+		fileWName: filePath,
+		searchDir: true,
+		lineNumber: true,
+	})
+	if got.Len() != 0 {
+		t.Fatalf("Expected nothing to be written on output but got %q", got.String())
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []string{
+		"../testdata/cmd_test/test1.txt:2:this is a test file",
+		"../testdata/cmd_test/test1.txt:3:one can test a program by running test cases",
+		"../testdata/cmd_test/inner/test2.txt:1:this file contains a test line",
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d lines but got %q", len(want), string(data))
+	}
+	for _, w := range want {
+		if !slices.Contains(lines, w) {
+			t.Errorf("Expected string %q was not found in file content %q", w, string(data))
+		}
+	}
+}
+
+func getExpectedOutput(t *testing.T, result [][]string) string {
+	t.Helper()
+	var wantArr []string
+	for _, res := range result {
+		wantArr = append(wantArr, strings.Join(res, "\n"))
+	}
+	return strings.Join(wantArr, "\n")
+}
+
+func setTestForPermissonCase(t *testing.T, filePath, content string) (func() error, error) {
+	t.Helper()
+	
+	// creating the parent directory, since git doesn't track empty directories
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, err
+	}
+
+	// creating file
+    file, err := os.Create(filePath)
+    if err != nil {
+        return nil, err
+    }
+
+	// writing to file
+    if _, err := file.WriteString(content); err != nil {
+        return nil, err
+    }
+
+	// setting permisson to 0000
+    if err := os.Chmod(filePath, 0000); err != nil {
+        return nil, err
+    }
+
+    // Define the cleanup function
+    cleanup := func() error {
+		file.Close()
+        if err := os.Remove(filePath); err != nil {
+            return err
+        }
+        return os.Remove(filepath.Dir(filePath))
+    }
+
+    return cleanup, nil
+}
@@ -0,0 +1,94 @@
+//go:build unix
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestRunNotRegularFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "test.txt"), []byte("test line"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	// fifo without a writer blocks on open, so it'd hang the search if it's read
+	if err := syscall.Mkfifo(filepath.Join(dir, "fifo"), 0644); err != nil {
+		t.Skipf("Can't create fifo: %v", err)
+	}
+
+	testCases := []struct {
+		name       string
+		noMessages bool
+		expErr     string
+	}{
+		{name: "warns about fifo", expErr: filepath.Join(dir, "fifo") + ": not a regular file, skipped\n"},
+		{name: "doesn't warn with noMessages", noMessages: true, expErr: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got, gotErr bytes.Buffer
+			status := run(os.DirFS("/"), input{output: &got, errOutput: &gotErr, keyword: "test", path: dir, searchDir: true, noMessages: tc.noMessages})
+			if want := filepath.Join(dir, "test.txt") + ":test line\n"; got.String() != want {
+				t.Errorf("Expected %q but got %q", want, got.String())
+			}
+			if gotErr.String() != tc.expErr {
+				t.Errorf("Expected %q but got %q", tc.expErr, gotErr.String())
+			}
+			if status != exitMatch {
+				t.Errorf("Expected status %v but got %v", exitMatch, status)
+			}
+		})
+	}
+}
+
+func TestIsTerminalInputNullDevice(t *testing.T) {
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Skipf("Can't open %s: %v", os.DevNull, err)
+	}
+	defer null.Close()
+
+	if isTerminalInput(null) {
+		t.Errorf("Expected %s to not be a terminal", os.DevNull)
+	}
+}
+
+func TestRunNoFollowSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "test.txt")
+	if err := os.WriteFile(target, []byte("test line\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("Can't create symlink: %v", err)
+	}
+
+	testCases := []struct {
+		name            string
+		noFollowSymlink bool
+		expStatus       int
+		expOutput       string
+	}{
+		{name: "follows symlink", noFollowSymlink: false, expStatus: exitMatch, expOutput: "test line\n"},
+		{name: "reports symlink", noFollowSymlink: true, expStatus: exitError, expOutput: link + ": is a symbolic link\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bytes.Buffer
+			status := run(os.DirFS("/"), input{output: &got, keyword: "test", path: link, noFollowSymlink: tc.noFollowSymlink})
+			if status != tc.expStatus {
+				t.Errorf("Expected status %v but got %v", tc.expStatus, status)
+			}
+			if got.String() != tc.expOutput {
+				t.Errorf("Expected %q but got %q", tc.expOutput, got.String())
+			}
+		})
+	}
+}
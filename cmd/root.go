@@ -16,10 +16,16 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -29,6 +35,82 @@ var (
 	linesBeforeMatchFlag = "linesBeforeMatch"
 	linesAfterMatchFlag = "linesAfterMatch"
 	lineCountFlag = "lineCount"
+	countMatchesFlag = "countMatches"
+	onlyMatchingFlag = "onlyMatching"
+	regexpFlag = "regexp"
+	lineNumberFlag = "lineNumber"
+	jsonFlag = "json"
+	forceFlag = "force"
+	appendFlag = "append"
+	withFileNameFlag = "withFileName"
+	nullFlag = "null"
+	encodingFlag = "encoding"
+	excludeDirFlag = "excludeDir"
+	noDefaultExcludesFlag = "noDefaultExcludes"
+	listFilesFlag = "files"
+	includeExtFlag = "include"
+	excludeExtFlag = "exclude"
+	filesWithMatchesFlag = "filesWithMatches"
+	quietFlag = "quiet"
+	statsFlag = "stats"
+	multilineFlag = "multiline"
+	replaceFlag = "replace"
+	inPlaceFlag = "inPlace"
+	backupSuffixFlag = "backup"
+	countFilesFlag = "countFiles"
+	filesFromFlag = "filesFrom"
+	noMessagesFlag = "noMessages"
+	directoriesFlag = "directories"
+	parallelFileFlag = "parallelFile"
+	nameOnlyFlag = "nameOnly"
+	headingFlag = "heading"
+	trimFlag = "trim"
+	expandTabsFlag = "expandTabs"
+	pathFilterFlag = "pathFilter"
+	timeoutFlag = "timeout"
+	tarFlag = "tar"
+	zipFlag = "zip"
+	groupSeparatorFlag = "groupSeparator"
+	noGroupSeparatorFlag = "noGroupSeparator"
+	lineDelimFlag = "lineDelim"
+	sortFlag = "sort"
+	sortReverseFlag = "sortReverse"
+	maxTotalFlag = "maxTotal"
+	reportFlag = "report"
+	progressFlag = "progress"
+	countAllFlag = "countAll"
+	pathModeFlag = "path"
+	preFlag = "pre"
+	encodingErrorModeFlag = "encodingErrorMode"
+	excludeEmptyFlag = "excludeEmpty"
+	joinFlag = "join"
+	noUnicodeFlag = "noUnicode"
+	allKeywordsFlag = "all"
+	butNotFlag = "butNot"
+	flushIntervalFlag = "flushInterval"
+	maxMatchesPerLineFlag = "maxMatchesPerLine"
+	patternFlag = "pattern"
+	regexPatternFlag = "eregex"
+	skipBlankFlag = "skipBlank"
+	headFlag = "head"
+	tailFlag = "tail"
+	linesFlag = "lines"
+	byteOffsetFlag = "byteOffset"
+	pathSeparatorFlag = "pathSeparator"
+	markFlag = "mark"
+	noFollowSymlinkFlag = "noFollowSymlink"
+	snippetFlag = "snippet"
+	fieldFlag = "field"
+	summaryFlag = "summary"
+	byExtensionFlag = "byExtension"
+	fieldSepFlag = "fieldSep"
+	patternStdinFlag = "patternStdin"
+	colorColumnsFlag = "colorColumns"
+	followFlag = "follow"
+	stripPrefixFlag = "stripPrefix"
+	pluralFlag = "plural"
+	ignoreBinaryMatchesFlag = "ignoreBinaryMatches"
+	textFlag = "text"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -36,14 +118,32 @@ var rootCmd = &cobra.Command{
 	Use:   "grep",
 	Short: "command line program that implements Unix grep like functionality",
 	Run: func(cmd *cobra.Command, args []string) {
-		a := os.Args[1:]
-		if len(a) < 2 {
+		filesFrom, err := cmd.Flags().GetString(filesFromFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		patternStdin, err := cmd.Flags().GetBool(patternStdinFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		// keyword is read from stdin in run, so the only argument is the path
+		if patternStdin {
+			args = append([]string{""}, args...)
+		}
+
+		// path isn't required, stdin is searched without it (or the files of list if it's passed)
+		if len(args) < 1 {
 			fmt.Println("error: Missing required arguments")
 			cmd.Usage()
-			os.Exit(1)
+			status = exitError
+			return
+		}
+		keyword := args[0]
+		path := ""
+		if len(args) > 1 {
+			path = args[1]
 		}
-		keyword := a[0]
-		path := a[1]
 
 		fileWriteName, err := cmd.Flags().GetString(fileNameFlag)
 		if err != nil {
@@ -69,19 +169,615 @@ var rootCmd = &cobra.Command{
 		if err != nil {
 			fmt.Fprintln(cmd.OutOrStdout(), err)
 		}
+		countMatches, err := cmd.Flags().GetBool(countMatchesFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		onlyMatching, err := cmd.Flags().GetBool(onlyMatchingFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		regexp, err := cmd.Flags().GetBool(regexpFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		lineNumber, err := cmd.Flags().GetBool(lineNumberFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		json, err := cmd.Flags().GetBool(jsonFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		force, err := cmd.Flags().GetBool(forceFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		appendToFile, err := cmd.Flags().GetBool(appendFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		withFileName, err := cmd.Flags().GetBool(withFileNameFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		null, err := cmd.Flags().GetBool(nullFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		encoding, err := cmd.Flags().GetString(encodingFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		excludeDir, err := cmd.Flags().GetStringSlice(excludeDirFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		noDefaultExcludes, err := cmd.Flags().GetBool(noDefaultExcludesFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		listFiles, err := cmd.Flags().GetBool(listFilesFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		includeExt, err := cmd.Flags().GetStringSlice(includeExtFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		excludeExt, err := cmd.Flags().GetStringSlice(excludeExtFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		filesWithMatches, err := cmd.Flags().GetBool(filesWithMatchesFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		quiet, err := cmd.Flags().GetBool(quietFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		stats, err := cmd.Flags().GetBool(statsFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		summary, err := cmd.Flags().GetBool(summaryFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		byExtension, err := cmd.Flags().GetBool(byExtensionFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		multiline, err := cmd.Flags().GetBool(multilineFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		// replace can be empty, so checking if it was passed
+		var replace *string
+		if cmd.Flags().Changed(replaceFlag) {
+			r, err := cmd.Flags().GetString(replaceFlag)
+			if err != nil {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+			}
+			replace = &r
+		}
+		inPlace, err := cmd.Flags().GetBool(inPlaceFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		backupSuffix, err := cmd.Flags().GetString(backupSuffixFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+		countFiles, err := cmd.Flags().GetBool(countFilesFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		noMessages, err := cmd.Flags().GetBool(noMessagesFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		directories, err := cmd.Flags().GetString(directoriesFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		parallelFile, err := cmd.Flags().GetBool(parallelFileFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		nameOnly, err := cmd.Flags().GetBool(nameOnlyFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		heading, err := cmd.Flags().GetBool(headingFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		trim, err := cmd.Flags().GetBool(trimFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		expandTabs, err := cmd.Flags().GetInt(expandTabsFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		pathFilter, err := cmd.Flags().GetString(pathFilterFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		timeout, err := cmd.Flags().GetDuration(timeoutFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		tar, err := cmd.Flags().GetBool(tarFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		zip, err := cmd.Flags().GetBool(zipFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
 
-		run(os.DirFS("/"), cmd.InOrStdin(), cmd.OutOrStdout(), keyword, path, fileWriteName, linesBeforeMatch, linesAfterMatch, ignoreCase, searchDir, lineCount)
-		os.Exit(0)
+		groupSeparator, err := cmd.Flags().GetString(groupSeparatorFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		noGroupSeparator, err := cmd.Flags().GetBool(noGroupSeparatorFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		lineDelim, err := cmd.Flags().GetString(lineDelimFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		sort, err := cmd.Flags().GetString(sortFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		sortReverse, err := cmd.Flags().GetBool(sortReverseFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		maxTotal, err := cmd.Flags().GetInt(maxTotalFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		report, err := cmd.Flags().GetBool(reportFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		progress, err := cmd.Flags().GetBool(progressFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		countAll, err := cmd.Flags().GetBool(countAllFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		pathMode, err := cmd.Flags().GetString(pathModeFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		pre, err := cmd.Flags().GetString(preFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		encodingErrorMode, err := cmd.Flags().GetString(encodingErrorModeFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		excludeEmpty, err := cmd.Flags().GetBool(excludeEmptyFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		join, err := cmd.Flags().GetString(joinFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		noUnicode, err := cmd.Flags().GetBool(noUnicodeFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		allKeywords, err := cmd.Flags().GetStringSlice(allKeywordsFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		butNot, err := cmd.Flags().GetString(butNotFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		patterns, err := cmd.Flags().GetStringArray(patternFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		regexPatterns, err := cmd.Flags().GetStringArray(regexPatternFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		skipBlank, err := cmd.Flags().GetBool(skipBlankFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		head, err := cmd.Flags().GetInt(headFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		tail, err := cmd.Flags().GetInt(tailFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		lines, err := cmd.Flags().GetString(linesFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		byteOffset, err := cmd.Flags().GetBool(byteOffsetFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		pathSeparator, err := cmd.Flags().GetString(pathSeparatorFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		mark, err := cmd.Flags().GetStringSlice(markFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		noFollowSymlink, err := cmd.Flags().GetBool(noFollowSymlinkFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		snippet, err := cmd.Flags().GetInt(snippetFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		field, err := cmd.Flags().GetInt(fieldFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		fieldSep, err := cmd.Flags().GetString(fieldSepFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		text, err := cmd.Flags().GetBool(textFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		ignoreBinaryMatches, err := cmd.Flags().GetBool(ignoreBinaryMatchesFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		plural, err := cmd.Flags().GetBool(pluralFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		stripPrefix, err := cmd.Flags().GetInt(stripPrefixFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		follow, err := cmd.Flags().GetBool(followFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		colorColumns, err := cmd.Flags().GetString(colorColumnsFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		flushInterval, err := cmd.Flags().GetDuration(flushIntervalFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		maxMatchesPerLine, err := cmd.Flags().GetInt(maxMatchesPerLineFlag)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+		}
+
+		status = run(os.DirFS("/"), input{
+			stdin: cmd.InOrStdin(),
+			output: cmd.OutOrStdout(),
+			errOutput: cmd.ErrOrStderr(),
+			keyword: keyword,
+			path: path,
+			fileWName: fileWriteName,
+			linesBeforeMatch: linesBeforeMatch,
+			linesAfterMatch: linesAfterMatch,
+			ignoreCase: ignoreCase,
+			searchDir: searchDir,
+			lineCount: lineCount,
+			countMatches: countMatches,
+			onlyMatching: onlyMatching,
+			regexp: regexp,
+			lineNumber: lineNumber,
+			json: json,
+			force: force,
+			append: appendToFile,
+			withFileName: withFileName,
+			null: null,
+			encoding: encoding,
+			encodingErrorMode: encodingErrorMode,
+			excludeDir: excludeDir,
+			noDefaultExcludes: noDefaultExcludes,
+			listFiles: listFiles,
+			includeExt: includeExt,
+			excludeExt: excludeExt,
+			filesWithMatches: filesWithMatches,
+			quiet: quiet,
+			stats: stats,
+			summary: summary,
+			byExtension: byExtension,
+			multiline: multiline,
+			replace: replace,
+			inPlace: inPlace,
+			backupSuffix: backupSuffix,
+			countFiles: countFiles,
+			filesFrom: filesFrom,
+			noMessages: noMessages,
+			directories: directories,
+			parallelFile: parallelFile,
+			nameOnly: nameOnly,
+			heading: heading,
+			trim: trim,
+			expandTabs: expandTabs,
+			pathFilter: pathFilter,
+			timeout: timeout,
+			tar: tar,
+			zip: zip,
+			groupSeparator: groupSeparator,
+			noGroupSeparator: noGroupSeparator,
+			lineDelim: lineDelim,
+			sort: sort,
+			sortReverse: sortReverse,
+			maxTotal: maxTotal,
+			report: report,
+			progress: progress,
+			countAll: countAll,
+			pathMode: pathMode,
+			pre: pre,
+			excludeEmpty: excludeEmpty,
+			join: join,
+			noUnicode: noUnicode,
+			allKeywords: allKeywords,
+			butNot: butNot,
+			patterns: patterns,
+			regexPatterns: regexPatterns,
+			skipBlank: skipBlank,
+			head: head,
+			tail: tail,
+			lines: lines,
+			byteOffset: byteOffset,
+			pathSeparator: pathSeparator,
+			mark: mark,
+			noFollowSymlink: noFollowSymlink,
+			snippet: snippet,
+			field: field,
+			fieldSep: fieldSep,
+			patternStdin: patternStdin,
+			colorColumns: colorColumns,
+			follow: follow,
+			stripPrefix: stripPrefix,
+			plural: plural,
+			ignoreBinaryMatches: ignoreBinaryMatches,
+			text: text,
+			flushInterval: flushInterval,
+			maxMatchesPerLine: maxMatchesPerLine,
+		})
 	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	args, err := withEnvOptions(os.Args[1:])
 	if err != nil {
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
+	}
+	os.Exit(execute(args))
+}
+
+// env var with the default flags, like GREP_OPTIONS of GNU grep
+const optionsEnv = "GO_GREP_OPTIONS"
+
+var errUnterminatedQuote = errors.New("unterminated quote or escape")
+
+// prepends the flags in optionsEnv to args, so that the ones passed in args override them
+// flags of env which are passed in args are dropped, since the values of slice flags like --include would add up otherwise
+func withEnvOptions(args []string) ([]string, error) {
+	envArgs, err := splitArgs(os.Getenv(optionsEnv))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", optionsEnv, err)
+	}
+
+	passed := map[string]bool{}
+	for _, group := range groupFlagArgs(args) {
+		for _, name := range group.names {
+			passed[name] = true
+		}
+	}
+	var kept []string
+	for _, group := range groupFlagArgs(envArgs) {
+		// combined shorthands like -nH are dropped together, if any of them is passed
+		if !slices.ContainsFunc(group.names, func(name string) bool { return passed[name] }) {
+			kept = append(kept, group.args...)
+		}
+	}
+	return append(kept, args...), nil
+}
+
+// args setting the flags, along with their values
+type flagArgs struct {
+	names []string		// names of the flags, none for a positional arg
+	args []string
+}
+
+// groups args by the flags of rootCmd they set, so that a flag can be dropped along with its value
+// shorthands and aliases are resolved to the names of the flags, unknown flags are kept by the name passed
+func groupFlagArgs(args []string) []flagArgs {
+	var groups []flagArgs
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		group := flagArgs{args: []string{arg}}
+		switch {
+		case arg == "--":
+			// rest of args are positional
+			return append(groups, flagArgs{args: args[i:]})
+		case strings.HasPrefix(arg, "--"):
+			name, _, hasValue := strings.Cut(arg[2:], "=")
+			flag := rootCmd.Flags().Lookup(name)
+			if flag == nil {
+				group.names = []string{name}
+				break
+			}
+			group.names = []string{flag.Name}
+			// value is the next arg, unless it's passed with = or it's optional like of a bool flag
+			if !hasValue && flag.NoOptDefVal == "" && i+1 < len(args) {
+				i++
+				group.args = append(group.args, args[i])
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			shorthands := arg[1:]
+			for j := 0; j < len(shorthands); j++ {
+				flag := rootCmd.Flags().ShorthandLookup(shorthands[j : j+1])
+				if flag == nil {
+					group.names = append(group.names, shorthands[j:j+1])
+					continue
+				}
+				group.names = append(group.names, flag.Name)
+				if flag.NoOptDefVal != "" {
+					continue
+				}
+				// value is the rest of arg, or the next arg
+				if j+1 == len(shorthands) && i+1 < len(args) {
+					i++
+					group.args = append(group.args, args[i])
+				}
+				break
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// splits s at white space like a shell, a quoted part (in ' or ") is a part of the arg as is
+// backslash escapes the next character, except within single quotes
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false		// so that an empty quoted arg like "" is kept
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errUnterminatedQuote
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// exit status of the command, set by the Run of rootCmd
+var status = exitMatch
+
+// runs the root command with args, returns the exit status
+// invalid flags are usage errors, so they exit with exitError as well
+func execute(args []string) int {
+	status = exitMatch
+	rootCmd.SetArgs(args)
+	if err := rootCmd.Execute(); err != nil {
+		return exitError
+	}
+	return status
+}
+
+// long names of GNU grep, mapped to the flags of same behaviour so that its scripts work as is
+// --context isn't mapped, since -C is the line count here instead of the context
+var flagAliases = map[string]string{
+	"after-context": linesAfterMatchFlag,
+	"before-context": linesBeforeMatchFlag,
+	"group-separator": groupSeparatorFlag,
+	"no-group-separator": noGroupSeparatorFlag,
+}
+
+func normaliseFlagName(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if alias, ok := flagAliases[name]; ok {
+		name = alias
 	}
+	return pflag.NormalizedName(name)
 }
 
 func init() {
@@ -93,10 +789,91 @@ func init() {
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
+	rootCmd.Flags().SetNormalizeFunc(normaliseFlagName)
 	rootCmd.Flags().StringP(fileNameFlag, "o", "", "writes output to the file")
 	rootCmd.Flags().BoolP(ignoreCaseFlag, "i", false, "ignores case")
+	rootCmd.Flags().String(butNotFlag, "", "skips the matched lines which have the pattern as well, eg: \"known error\"")
+	rootCmd.Flags().StringArrayP(patternFlag, "e", nil, "matches the lines which have the literal pattern too, along with the ones having the keyword, can be repeated")
+	rootCmd.Flags().StringArray(regexPatternFlag, nil, "matches the lines which have the regular expression too, along with the ones having the keyword, can be repeated")
+	rootCmd.Flags().Int(headFlag, 0, "searches only the first n lines of each file")
+	rootCmd.Flags().String(linesFlag, "", "matches only the lines in the range start:end, inclusive, either end can be left out, eg: 10:20")
+	rootCmd.Flags().Int(tailFlag, 0, "searches only the last n lines of each file, with line numbers as in the file")
+	rootCmd.Flags().Bool(skipBlankFlag, false, "skips the blank and white space only lines, so they neither match nor count")
+	rootCmd.Flags().StringSlice(allKeywordsFlag, nil, "matches only the lines which have the keyword(s) as well, in any order, eg: timeout,retry")
+	rootCmd.Flags().Bool(noUnicodeFlag, false, "ignores the case of ASCII letters only in -i, faster for ASCII input")
+	rootCmd.Flags().Bool(followFlag, false, "keeps searching the lines appended to the file like tail -f, till interrupted")
+	rootCmd.Flags().Bool(patternStdinFlag, false, "reads the keyword from the first line of stdin, the only argument is the path then")
+	rootCmd.Flags().String(filesFromFlag, "", "reads the list of files to search from the file (- for stdin), separated by new line or NUL")
 	rootCmd.Flags().BoolP(searchDirFlag, "r", false, "searches directory")
-	rootCmd.Flags().IntP(linesAfterMatchFlag, "A", 0, "includes the line(s) after the match")
-	rootCmd.Flags().IntP(linesBeforeMatchFlag, "B", 0, "includes the line(s) before the match")
+	rootCmd.Flags().StringP(directoriesFlag, "d", directoriesRead, "action on a directory path without -r, one of read, skip and recurse")
+	rootCmd.Flags().IntP(linesAfterMatchFlag, "A", 0, "includes the line(s) after the match, same as --after-context")
+	rootCmd.Flags().IntP(linesBeforeMatchFlag, "B", 0, "includes the line(s) before the match, same as --before-context")
+	rootCmd.Flags().String(groupSeparatorFlag, "--", "prints the string between the groups of lines in -A and -B, same as --group-separator")
+	rootCmd.Flags().Bool(noGroupSeparatorFlag, false, "prints nothing between the groups of lines in -A and -B, same as --no-group-separator")
+	rootCmd.Flags().String(joinFlag, "", "prints each group of lines in -A and -B as a single line, joined by the string, eg: \" | \"")
 	rootCmd.Flags().BoolP(lineCountFlag, "C", false, "includes the line count")
+	rootCmd.Flags().Bool(countAllFlag, false, "includes the line count of every searched file in -r, 0 for the ones without matches")
+	rootCmd.Flags().Bool(countFilesFlag, false, "includes only the count of files with matches")
+	rootCmd.Flags().Bool(countMatchesFlag, false, "includes the count of matches instead of matched lines")
+	rootCmd.Flags().Bool(onlyMatchingFlag, false, "includes only the matched part of the line")
+	rootCmd.Flags().Int(maxMatchesPerLineFlag, 0, "includes at most n matched parts of each line in --onlyMatching")
+	rootCmd.Flags().BoolP(regexpFlag, "E", false, "treats the keyword as a regular expression")
+	rootCmd.Flags().String(replaceFlag, "", "prints the matched lines with matches replaced, supports $1 and ${name} of the groups in -E, $$ for a literal $")
+	rootCmd.Flags().Bool(inPlaceFlag, false, "rewrites the file(s) with matches replaced, needs --replace")
+	rootCmd.Flags().String(backupSuffixFlag, "", "saves a copy of the original file with the suffix in --inPlace, eg: .bak")
+	rootCmd.Flags().Bool(multilineFlag, false, "matches the regexp across lines, reads the whole file in memory")
+	rootCmd.Flags().Bool(parallelFileFlag, false, "searches a large file in chunks in parallel, ignored with context and --multiline")
+	rootCmd.Flags().BoolP(lineNumberFlag, "n", false, "includes the line number of each line")
+	rootCmd.Flags().Bool(ignoreBinaryMatchesFlag, false, "treats the files with a NUL byte as without matches, instead of printing that they match")
+	rootCmd.Flags().BoolP(textFlag, "a", false, "searches the files with a NUL byte as text, overrides --ignoreBinaryMatches")
+	rootCmd.Flags().Bool(pluralFlag, false, "matches the plural of the keyword as well, or the singular if it's a plural, eg: apple and apples")
+	rootCmd.Flags().Int(fieldFlag, 0, "matches only the nth field of each line (from 1), prints the whole line")
+	rootCmd.Flags().String(fieldSepFlag, "", "separator of the fields in --field, runs of white space if not passed")
+	rootCmd.Flags().Int(snippetFlag, 0, "prints each match with up to n characters around it instead of the line, for long lines")
+	rootCmd.Flags().StringSlice(markFlag, nil, "wraps each match in the matched lines with the markers before and after it, eg: \"[[,]]\"")
+	rootCmd.Flags().BoolP(byteOffsetFlag, "b", false, "includes the byte offset of each line, or of the matched part in --onlyMatching")
+	rootCmd.Flags().BoolP(filesWithMatchesFlag, "l", false, "includes only the name of files with matches")
+	rootCmd.Flags().BoolP(quietFlag, "q", false, "prints nothing, stops at the first match")
+	rootCmd.Flags().BoolP(noMessagesFlag, "s", false, "suppresses the errors about files which couldn't be read, exits with 2 still")
+	rootCmd.Flags().Bool(summaryFlag, false, "prints the total of matches, matched files and searched files instead of the lines")
+	rootCmd.Flags().Bool(byExtensionFlag, false, "includes the matches by extension of the file in --summary")
+	rootCmd.Flags().Bool(statsFlag, false, "prints the summary of files scanned, skipped and matches in -r to stderr")
+	rootCmd.Flags().Bool(jsonFlag, false, "writes output as one json object per line")
+	rootCmd.Flags().Bool(forceFlag, false, "overwrites the output file if it already exists")
+	rootCmd.Flags().Bool(appendFlag, false, "appends to the output file if it already exists")
+	rootCmd.Flags().Bool(trimFlag, false, "strips the leading and trailing white space from the lines in output")
+	rootCmd.Flags().Int(expandTabsFlag, 0, "expands the tabs in output lines to spaces with the tab stops n columns apart, 8 if n is not passed")
+	// tab width is optional, but has to be passed as --expandTabs=n in that case
+	rootCmd.Flags().Lookup(expandTabsFlag).NoOptDefVal = "8"
+	rootCmd.Flags().String(colorColumnsFlag, "", "colors the file name, line number, separator and match, with the colors in GREP_COLORS form, eg: ms=01;31:fn=35")
+	// colors are optional, but have to be passed as --colorColumns=spec in that case
+	rootCmd.Flags().Lookup(colorColumnsFlag).NoOptDefVal = defaultColors
+	rootCmd.Flags().Bool(headingFlag, false, "groups the matched lines under the file name in -r, with line numbers")
+	rootCmd.Flags().Int(stripPrefixFlag, 0, "removes the first n components from the paths in output, like -p of patch")
+	rootCmd.Flags().String(pathModeFlag, "relative", "form of the paths in output, relative (as passed) or absolute")
+	rootCmd.Flags().Bool(noFollowSymlinkFlag, false, "reports the path (or a file of --filesFrom) which is a symlink as an error, instead of searching its target")
+	rootCmd.Flags().String(pathSeparatorFlag, "", "separator of the paths in output, eg: \\ for Windows tools, as they are by default")
+	rootCmd.Flags().BoolP(withFileNameFlag, "H", false, "includes the file name for a single file")
+	rootCmd.Flags().BoolP(nullFlag, "Z", false, "separates the file name and line number from line with a NUL byte")
+	rootCmd.Flags().StringSlice(includeExtFlag, nil, "searches only the files with the extension(s), eg: txt,.md")
+	rootCmd.Flags().StringSlice(excludeExtFlag, nil, "skips the files with the extension(s), eg: log,.png")
+	rootCmd.Flags().Duration(flushIntervalFlag, 100*time.Millisecond, "prints the lines found in -r within the duration, 0 prints each file as soon as it's searched")
+	rootCmd.Flags().Bool(progressFlag, false, "shows the count of files scanned and matches in -r on stderr, if it's a terminal")
+	rootCmd.Flags().Bool(excludeEmptyFlag, false, "skips the zero byte files in -r, so they aren't in --report and --countAll")
+	rootCmd.Flags().Bool(reportFlag, false, "lists every file searched in -r with whether it matched, to debug the filters")
+	rootCmd.Flags().Int(maxTotalFlag, 0, "stops the search in -r after the count of matched lines across files reaches it")
+	rootCmd.Flags().String(sortFlag, "path", "sorts the files in -r by path, modified (time) or count (of matched lines), ascending")
+	rootCmd.Flags().Bool(sortReverseFlag, false, "reverses the order of --sort")
+	rootCmd.Flags().String(pathFilterFlag, "", "searches only the files whose path in -r matches the regexp")
+	rootCmd.Flags().Bool(tarFlag, false, "searches the files inside the tar archive, like the files of a directory in -r")
+	rootCmd.Flags().Bool(zipFlag, false, "searches the files inside the zip archive, like the files of a directory in -r")
+	rootCmd.Flags().Duration(timeoutFlag, 0, "stops the search after the duration and prints the results found till then, eg: 5s")
+	rootCmd.Flags().StringSlice(excludeDirFlag, nil, "skips the directories matching the glob pattern(s) in -r")
+	rootCmd.Flags().Bool(noDefaultExcludesFlag, false, "searches .git, .svn, node_modules and vendor directories in -r")
+	rootCmd.Flags().Bool(nameOnlyFlag, false, "lists the files whose path matches the keyword, without opening them")
+	rootCmd.Flags().Bool(listFilesFlag, false, "lists the files which would be searched, without searching them")
+	rootCmd.Flags().String(preFlag, "", "runs each file through the command with its path, its output is searched instead, eg: \"gunzip -c\"")
+	rootCmd.Flags().String(lineDelimFlag, "", "splits the input in lines at the byte instead of new line, output lines end with it too")
+	rootCmd.Flags().String(encodingFlag, "", "encoding of the input (utf-8, utf-16le, utf-16be, latin1), detects utf-16 from BOM by default")
+	rootCmd.Flags().String(encodingErrorModeFlag, "", "handling of the lines with invalid UTF-8, one of strict (error), replace (with U+FFFD) and skip")
 }
\ No newline at end of file
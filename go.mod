@@ -2,9 +2,10 @@ module github.com/one2n-go-bootcamp/go-grep
 
 go 1.21.3
 
-require github.com/spf13/cobra v1.8.1
-
 require (
-	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/spf13/cobra v1.8.1
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/text v0.14.0
 )
+
+require github.com/inconshreveable/mousetrap v1.1.0 // indirect
@@ -2,16 +2,48 @@ package grep
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
+// buffers for the line scanners, shared by the workers of GrepR so that each file doesn't allocate its own
+// holds pointers, since putting a slice in the pool allocates
+var scanBufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 4096)
+		return &buf
+	},
+}
+
+// if scanners take their buffers from scanBufferPool, only turned off by the benchmarks to compare with a new buffer for each file
+var poolScanBuffers = true
+
+// directories skipped in recursive search unless NoDefaultExcludes is passed
+var defaultExcludeDir = []string{".git", ".svn", "node_modules", "vendor"}
+
 var (
 	ErrIsDirectory = errors.New("is a directory")
+	ErrInvalidEncoding = errors.New("invalid encoding")
+	ErrNoReplace = errors.New("replace is not passed")
+	ErrEmptyPre = errors.New("preprocessor command is empty")
+	ErrInvalidUTF8 = errors.New("invalid UTF-8")
+	ErrSymlink = errors.New("is a symbolic link")
+	ErrReplaceDecoded = errors.New("replace can't rewrite the decoded or preprocessed content, like of Encoding, Pre, Multiline and UTF-16 with a BOM")
 )
 
 type GrepOptions struct {
@@ -19,37 +51,386 @@ type GrepOptions struct {
 	Path string
 	Stdin io.Reader
 	Keyword string
+	AllKeywords []string		// keywords which must be in the line along with Keyword, in any order, only Keyword is in the matched parts, ignored in Multiline
+	ButNot string		// lines matching it are excluded even if they match Keyword, ignored in Multiline
+	Patterns []Pattern		// patterns matched along with Keyword, line matches if any of them does, Keyword is left out if empty
+	SkipBlank bool		// blank and white space only lines never match, so they aren't counted either, even with an empty Keyword
+	HeadLines int		// stops reading each file after the first n lines, whole file is searched if it's 0, ignored in Multiline
+	TailLines int		// searches only the last n lines of each file, whole file is searched if it's 0, ignored in Multiline
+	LineRange [2]int		// matches only the lines from the first to the second line number, inclusive, 0 leaves that end open, ignored in Multiline
+	ByteOffset bool		// returns the offset of each line (or matched part in OnlyMatching) in ByteOffsets, counted in the decoded content, ignored in Multiline
+	MarkBefore string		// inserted before each match in the matched lines, like the color codes but plain, ignored with Replace and in Multiline
+	MarkAfter string		// inserted after each match in the matched lines
+	SnippetRadius int		// saves each match with up to n runes around it (and ... where the line is cut) instead of the line, like OnlyMatching
+	IgnoreBinaryMatches bool		// file with a NUL byte never matches, like -I of GNU grep, so it's read in full even in FilesWithMatches
+	Text bool		// file with a NUL byte is searched as text, like -a of GNU grep, so Binary is never set and IgnoreBinaryMatches is ignored
+	Plural bool		// matches the plural of Keyword as well (or the singular if it's a plural), by simple rules of English, ignored with Regexp
+	FieldNum int		// matches only the nth field of the line (from 1), whole line is still saved, ignored in Multiline
+	FieldSep string		// separator of the fields in FieldNum, runs of white space if not passed
 	FileWName string
 	IgnoreCase bool
 	LinesBeforeMatch int
 	LinesAfterMatch int
 	SearchDir bool
 	LineCount bool
+	CountMatches bool
+	OnlyMatching bool
+	MaxMatchesPerLine int		// stops saving the matched parts of a line in OnlyMatching after it, all of them are saved if it's 0
+	Regexp bool
+	Encoding string
+	EncodingErrorMode string		// handling of the lines with invalid UTF-8, one of the EncodingError constants, searched as is if not passed
+	ExcludeDir []string
+	NoDefaultExcludes bool
+	ListFiles bool
+	IncludeExt []string
+	ExcludeExt []string
+	FilesWithMatches bool
+	Multiline bool
+	Replace *string
+	ParallelFile bool		// searches a large file in chunks in parallel, only without context
+	NameOnly bool		// matches the keyword against the path of files in GrepR, instead of content
+	PathFilter string		// regexp for the path of files to be searched in GrepR, relative to the root
+	Context context.Context		// stops the search once done, results found till then are returned with its error
+	LineDelim byte		// delimiter of the lines (records), new line if not passed
+	SortBy string		// key to sort the results of GrepR by, one of the Sort constants, path if not passed
+	SortReverse bool
+	TotalLimit int		// stops GrepR once the count of matched lines across files reaches it, results are cut to it
+	Report bool		// returns a result for every file searched by GrepR, even without a match
+	ExcludeEmpty bool		// skips the zero byte files in GrepR, so they aren't in Report or counts
+	ASCII bool		// folds only the ASCII letters in IgnoreCase, faster for ASCII input, regexp is unaffected
+	Structured bool		// returns a MatchGroup for each matched line in Groups along with the flat MatchedLines, except in OnlyMatching and Multiline
+	MatchStart bool		// matches the keyword only at the start of line, with MatchEnd the whole line has to match
+	MatchEnd bool		// matches the keyword only at the end of line
+	Pre string		// command to run each file through before searching, like "gunzip -c"
+	NoFollowSymlink bool		// reports the file at Path as ErrSymlink if it's a symlink, instead of searching its target, files in the walk of GrepR are unaffected
+	Cache Cache		// results of the files unchanged since they were put in it are returned from it, instead of searching them again
+	ProgressFunc func(scanned, matched int)		// called by GrepR after each file is searched, with the count of files searched and lines matched till then
+	lineOffset int		// count of lines before the first one read, so that the tail is numbered as in the file
+	lineStarts []int64		// byte offset of each line read, in place of the ones counted while reading, for the tail
 }
 
 type GrepResult struct {
 	Path string
 	MatchedLines []string
+	LineNumbers []int
 	LineCount int
+	MatchCount int
+	Matched bool
 	Error error
+	Skipped string		// reason the file wasn't searched, one of the SkipReason constants
+	Groups []MatchGroup		// matched lines with their context, only if Structured is passed
+	BytesScanned int64		// count of bytes read from the file, including the ones read ahead of the first match in FilesWithMatches
+	Binary bool		// content has a NUL byte, so the matched lines may not be text, not checked in FilesWithMatches unless IgnoreBinaryMatches is passed
+	ByteOffsets []int64		// byte offset of each of MatchedLines, only if ByteOffset is passed
+	matchedLineCount int		// count of matched lines irrespective of options, for stats
+	modTime time.Time		// modification time of file, only for sorting by it
+}
+
+// matched line along with the lines of context before and after it
+// context of nearby matches overlaps, so a line may be in more than one group, or be a match itself
+type MatchGroup struct {
+	Before []string		// up to LinesBeforeMatch lines just before the match, starting at line LineNumber-len(Before)
+	Match string		// matched line, with the matches replaced if Replace is passed
+	After []string		// up to LinesAfterMatch lines just after the match
+	LineNumber int		// line number of the match
+}
+
+// pattern to be matched as an alternative to the keyword
+// each pattern is literal or regexp on its own, irrespective of Regexp in options
+type Pattern struct {
+	Text string
+	Regexp bool
+}
+
+// keys to sort the results of GrepR by, ascending unless SortReverse is passed
+const (
+	SortPath = "path"
+	SortModified = "modified"
+	SortCount = "count"		// count of matched lines
+)
+
+// reasons for skipping files in recursive search
+const (
+	SkipReasonExtension = "extension"
+	SkipReasonExcludedDir = "excluded directory"
+	SkipReasonPathFilter = "path filter"
+	SkipReasonNotRegular = "not a regular file"
+	SkipReasonEmpty = "empty"
+)
+
+// types of files skipped in recursive search, since reading them may block forever (like a fifo without writer)
+// symlinks aren't in it, since they are checked on open like any other file
+const notRegularMode = fs.ModeNamedPipe | fs.ModeSocket | fs.ModeDevice | fs.ModeCharDevice | fs.ModeIrregular
+
+// summary of a recursive search
+type GrepStats struct {
+	FilesScanned int
+	FilesSkipped map[string]int		// count of skipped files (or directories) by reason
+	Matches int
+	FilesMatched int
+	MatchesByExt map[string]int		// count of matches by extension of the file (with the dot), "" for the files without one
+	BytesScanned int64		// total of BytesScanned of every searched file, including the ones without matches
+	Errors int		// count of files (or directories) which couldn't be read
+	NotRegular []string		// path of the skipped sockets, fifos and devices, for warning about them
+	Elapsed time.Duration
 }
 
 func GrepR(fSys fs.FS, parentOption GrepOptions) []GrepResult {
-	var wg sync.WaitGroup
-	var outputChans []chan GrepResult
+	results, _ := GrepRStats(fSys, parentOption)
+	return results
+}
+
+// GrepRStats is same as GrepR, but also returns the summary of the search
+func GrepRStats(fSys fs.FS, parentOption GrepOptions) ([]GrepResult, GrepStats) {
+	var results []GrepResult
+	stats, _ := grepRWalk(fSys, parentOption, false, func(result GrepResult) error {
+		results = append(results, result)
+		return nil
+	})
+
+	// sorting, since SortBy may differ from the order of walk
+	sortResults(results, parentOption)
+	return results, stats
+}
+
+// GrepRStream is same as GrepR, but sends each result on the channel as soon as it's found, instead of after the search
+// results are in the order of walk, which is same as sorting by path, so SortBy and SortReverse are ignored
+// channel is closed once the search is done, the returned func waits for it and returns the summary
+// channel has to be read till it's closed, since the search waits for the results to be read
+func GrepRStream(fSys fs.FS, parentOption GrepOptions) (<-chan GrepResult, func() GrepStats) {
+	results := make(chan GrepResult)
+	done := make(chan struct{})
+	var stats GrepStats
+	go func() {
+			defer close(done)
+			defer close(results)
+			stats, _ = grepRWalk(fSys, parentOption, false, func(result GrepResult) error {
+				results <- result
+				return nil
+			})
+	}()
+	return results, func() GrepStats {
+		<-done
+		return stats
+	}
+}
+
+// event of GrepREvents, either Result or Err is set
+type StreamEvent struct {
+	Result *GrepResult		// result with matches (or a listed file), same as the ones of GrepRStream
+	Err error		// error of a file (or directory) which couldn't be read, the search goes on after it
+	Path string		// path of the file (or directory) of Err, empty for the errors before the walk
+}
+
+// GrepREvents is same as GrepRStream, but also sends the error of each file which couldn't be read, in the order of walk
+// errors are only counted in the summary of the others, so this tells them apart from the results without checking Error
+// results cut short by Context keep its error in Result.Error, like the ones of GrepRStream, since they have the lines found till then
+func GrepREvents(fSys fs.FS, parentOption GrepOptions) (<-chan StreamEvent, func() GrepStats) {
+	events := make(chan StreamEvent)
+	done := make(chan struct{})
+	var stats GrepStats
+	go func() {
+			defer close(done)
+			defer close(events)
+			stats, _ = grepRWalk(fSys, parentOption, true, func(result GrepResult) error {
+				if result.Error != nil && !isContextError(result.Error) {
+					events <- StreamEvent{Err: result.Error, Path: result.Path}
+					return nil
+				}
+				events <- StreamEvent{Result: &result}
+				return nil
+			})
+	}()
+	return events, func() GrepStats {
+		<-done
+		return stats
+	}
+}
+
+// GrepRFunc is same as GrepR, but calls handle with each result in the order of walk, instead of returning them
+// results aren't collected, and the search waits for handle once the files searched ahead of it reach maxPendingFiles
+// search stops once handle returns an error, which is returned as is, SortBy and SortReverse are ignored like GrepRStream
+func GrepRFunc(fSys fs.FS, parentOption GrepOptions, handle func(GrepResult) error) error {
+	// walk and the workers are cancelled with a context of their own, once handle fails
+	ctx := parentOption.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	parentOption.Context = ctx
+
+	_, err := grepRWalk(fSys, parentOption, false, func(result GrepResult) error {
+		if err := handle(result); err != nil {
+			cancel()
+			return err
+		}
+		return nil
+	})
+	return err
+}
+
+// ResultStats returns the summary of the results of Grep, like the one of GrepRStats for the searches other than GrepR
+// files are counted from the results, so skipped counts and elapsed time aren't there
+func ResultStats(results []GrepResult) GrepStats {
+	stats := GrepStats{FilesSkipped: make(map[string]int), MatchesByExt: make(map[string]int)}
+	for _, result := range results {
+		if result.Error != nil {
+			stats.Errors++
+			continue
+		}
+		if result.Skipped != "" {
+			stats.FilesSkipped[result.Skipped]++
+			continue
+		}
+		stats.FilesScanned++
+		stats.BytesScanned += result.BytesScanned
+		stats.addMatches(result)
+	}
+	return stats
+}
+
+// adds the matches of result to the stats
+func(stats *GrepStats) addMatches(result GrepResult) {
+	stats.Matches += result.matchedLineCount
+	if result.Matched {
+		stats.FilesMatched++
+	}
+	if result.matchedLineCount > 0 {
+		stats.MatchesByExt[path.Ext(result.Path)] += result.matchedLineCount
+	}
+}
+
+// count of files searched at once in GrepR, beyond it the walk waits for the results before it to be collated
+const maxPendingFiles = 1024
+
+// walks the files of GrepR and searches them in parallel, emit is called with each result in the order of walk
+// files which couldn't be read are only counted in the summary, unless withErrors is passed to emit their results as well
+// returns the summary once all the results are emitted, and the error of emit if it failed
+// results after the failed one are read only to let the workers finish, they aren't emitted or counted
+func grepRWalk(fSys fs.FS, parentOption GrepOptions, withErrors bool, emit func(GrepResult) error) (GrepStats, error) {
+	start := time.Now()
+	stats := GrepStats{FilesSkipped: make(map[string]int), MatchesByExt: make(map[string]int)}
+
+	// errors before the walk fail the whole search, they are emitted like the ones of files if asked for
+	fail := func(err error) (GrepStats, error) {
+		stats.Errors++
+		if withErrors {
+			return stats, emit(GrepResult{Error: err})
+		}
+		return stats, nil
+	}
+
+	// invalid options would fail for every file alike, so nothing is walked
+	if err := parentOption.validate(); err != nil {
+		return fail(err)
+	}
+
+	// matcher for the paths in NameOnly, compiled once for all the files
+	var nameMatcher matcher
+	if parentOption.NameOnly {
+		m, err := newMatcher(parentOption)
+		if err != nil {
+			return fail(err)
+		}
+		nameMatcher = m
+	}
+
+	// files are searched only if their path matches the path filter
+	var pathFilter *regexp.Regexp
+	if parentOption.PathFilter != "" {
+		re, err := regexp.Compile(parentOption.PathFilter)
+		if err != nil {
+			return fail(err)
+		}
+		pathFilter = re
+	}
+
+	// workers and the walk are cancelled once the total limit is reached, with a context of their own
+	userContext := parentOption.Context
+	var total atomic.Int64
+	var bytesScanned atomic.Int64
+	cancel := func() {}
+	if parentOption.TotalLimit > 0 {
+		ctx := userContext
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		parentOption.Context, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	// progress is reported under a lock, so that the func is never called concurrently and the counts only go up
+	var progressMu sync.Mutex
+	progressScanned, progressMatched := 0, 0
+	progress := func(result GrepResult) {
+		if parentOption.ProgressFunc == nil {
+			return
+		}
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		progressScanned++
+		progressMatched += result.matchedLineCount
+		parentOption.ProgressFunc(progressScanned, progressMatched)
+	}
 
-	// walks over files in the directory
+	// walks over files in the directory, while the results are collated in the order of walk
+	// walk fills the skipped counts and collation fills the rest of stats, so they don't write the same fields
+	outputChans := make(chan chan GrepResult, maxPendingFiles)
+	done := contextDone(parentOption)
+	go func() {
+	defer close(outputChans)
 	fs.WalkDir(fSys, parentOption.Path, func(path string, d fs.DirEntry, err error) error {
+		// stops the walk once context is done, files found till then are still collated
+		select {
+		case <-done:
+			return fs.SkipAll
+		default:
+		}
+
+		// skips the excluded directories along with everything inside them
+		if err == nil && d.IsDir() && path != parentOption.Path && isExcludedDir(d.Name(), parentOption) {
+			stats.FilesSkipped[SkipReasonExcludedDir]++
+			return fs.SkipDir
+		}
+
+		// skips the files filtered by extension
+		if err == nil && !d.IsDir() && !shouldSearch(d.Name(), parentOption) {
+			stats.FilesSkipped[SkipReasonExtension]++
+			return nil
+		}
+
+		// skips the sockets, fifos and devices without opening them
+		if err == nil && d.Type()&notRegularMode != 0 {
+			stats.FilesSkipped[SkipReasonNotRegular]++
+			stats.NotRegular = append(stats.NotRegular, normalisePathFromRoot(path, parentOption.OrigPath))
+			return nil
+		}
+
+		// skips the files filtered by path, before opening them
+		if err == nil && !d.IsDir() && pathFilter != nil && !pathFilter.MatchString(relativePath(path, parentOption.Path)) {
+			stats.FilesSkipped[SkipReasonPathFilter]++
+			return nil
+		}
+
+		// skips the zero byte files, size is read only if they are to be skipped
+		if err == nil && !d.IsDir() && parentOption.ExcludeEmpty && isEmpty(d) {
+			stats.FilesSkipped[SkipReasonEmpty]++
+			return nil
+		}
+
+		if err == nil && !d.IsDir() {
+			stats.FilesScanned++
+		}
+
 		outputChan := make(chan GrepResult)
-		outputChans = append(outputChans, outputChan)
+		outputChans <- outputChan
 
-		wg.Add(1)
 		go func(outputChan chan GrepResult) {
-			defer wg.Done()
 			defer close(outputChan)
 
 			if err != nil {
-				outputChan <- GrepResult{Error: err}
+				outputChan <- GrepResult{Path: normalisePathFromRoot(path, parentOption.OrigPath), Error: err}
 				return
 			}
 
@@ -57,48 +438,137 @@ func GrepR(fSys fs.FS, parentOption GrepOptions) []GrepResult {
 				return
 			}
 
-			// prepares the options for grep
-			grepOption := GrepOptions{
-				Path: path, 
-				OrigPath: parentOption.Path, 
-				Keyword: parentOption.Keyword, 
-				IgnoreCase: parentOption.IgnoreCase, 
-				LinesBeforeMatch: parentOption.LinesBeforeMatch, 
-				LinesAfterMatch: parentOption.LinesAfterMatch, 
-				LineCount: parentOption.LineCount,
+			// modification time is read only to sort by it
+			var modTime time.Time
+			if parentOption.SortBy == SortModified {
+				if info, err := d.Info(); err == nil {
+					modTime = info.ModTime()
+				}
+			}
+
+			// lists the file without searching it
+			if parentOption.ListFiles {
+				outputChan <- GrepResult{Path: normalisePathFromRoot(path, parentOption.OrigPath), modTime: modTime}
+				return
 			}
+
+			// matches the path without opening the file
+			if parentOption.NameOnly {
+				if nameMatcher.match(relativePath(path, parentOption.Path)) {
+					outputChan <- GrepResult{Path: normalisePathFromRoot(path, parentOption.OrigPath), Matched: true, modTime: modTime}
+				}
+				return
+			}
+
+			// prepares the options for grep, all of them apply to each file except the ones of the walk itself
+			grepOption := parentOption
+			grepOption.Path = path
+			grepOption.OrigPath = normalisePathFromRoot(path, parentOption.OrigPath)
+			grepOption.Stdin = nil
+			grepOption.SearchDir = false
+			grepOption.FileWName = ""
+			grepOption.ExcludeDir = nil
+			grepOption.NoDefaultExcludes = false
+			grepOption.ListFiles = false
+			grepOption.IncludeExt = nil		// files are filtered by the walk already
+			grepOption.ExcludeExt = nil
+			grepOption.NameOnly = false
+			grepOption.PathFilter = ""
+			grepOption.SortBy = ""
+			grepOption.SortReverse = false
+			grepOption.TotalLimit = 0
+			grepOption.Report = false
+			grepOption.ExcludeEmpty = false
+			grepOption.NoFollowSymlink = false		// applies to the path passed, not the files found by walk
+			grepOption.ProgressFunc = nil
 			result := Grep(fSys, grepOption)
-			if result.Error != nil {
+			progress(result)
+			bytesScanned.Add(result.BytesScanned)
+
+			// result cut short by the context still has the lines found till then
+			if result.Error != nil && !isContextError(result.Error) {
+				result.Path = normalisePathFromRoot(path, parentOption.OrigPath)		// path of file which couldn't be read
 				outputChan <- result
 				return
 			}
 			
+			if parentOption.TotalLimit > 0 && total.Add(int64(result.matchedLineCount)) >= int64(parentOption.TotalLimit) {
+				cancel()
+			}
+
 			// if no match found, then return
-			if len(result.MatchedLines) == 0 && result.LineCount == 0 {
+			if !hasResult(result) && !parentOption.Report {
 				return
 			}
 
 			// setting the path of file (from the user provided path)
 			result.Path = normalisePathFromRoot(path, parentOption.OrigPath)
+			result.modTime = modTime
 			outputChan <- result
 		} (outputChan)
 
 		return nil
 	})
+	}()
 
-	var results []GrepResult	// to save the final output
+	remaining := parentOption.TotalLimit
+	var emitErr error
 	// collates the results from all the output channels
-	for _, outputChan := range outputChans {
-		result := <-outputChan
-		if len(result.MatchedLines) == 0 && result.LineCount == 0 {
+	// workers send only the results with matches (or listed files) and errors, unless Report is passed
+	for outputChan := range outputChans {
+		result, ok := <-outputChan
+		if !ok || emitErr != nil {
 			continue
 		}
-		results = append(results, result)
+		if result.Error != nil && !isContextError(result.Error) {
+			stats.Errors++
+			if withErrors {
+				emitErr = emit(result)
+			}
+			continue
+		}
+
+		// results are cut to the total limit in the order of walk, files cut short by it aren't errors
+		if parentOption.TotalLimit > 0 && result.matchedLineCount > 0 {
+			if userContext == nil || userContext.Err() == nil {
+				result.Error = nil
+			}
+			if remaining <= 0 {
+				continue
+			}
+			result = limitResult(result, remaining, parentOption)
+			remaining -= result.matchedLineCount
+		}
+		if err := emit(result); err != nil {
+			emitErr = err
+			continue
+		}
+		stats.addMatches(result)
 	}
-	return results
+
+	stats.BytesScanned = bytesScanned.Load()
+	stats.Elapsed = time.Since(start)
+	return stats, emitErr
 }
 
 func Grep(fSys fs.FS, option GrepOptions) GrepResult {
+	if err := option.validate(); err != nil {
+		return GrepResult{Error: err}
+	}
+	m, err := newMatcher(option)
+	if err != nil {
+		return GrepResult{Error: err}
+	}
+	return grepFile(fSys, m, option)
+}
+
+// greps the file in option.Path with the matcher, which is built by the caller
+// file filtered out by extension isn't opened, same as in GrepR
+func searchFile(fSys fs.FS, m matcher, option GrepOptions) GrepResult {
+	if option.Path != "" && !shouldSearch(path.Base(option.Path), option) {
+		return GrepResult{Path: option.Path, Skipped: SkipReasonExtension}
+	}
+
 	// gets the reader for file after validity checks
 	r, cleanup, err := getReader(fSys, option)
 	if err != nil {
@@ -106,34 +576,196 @@ func Grep(fSys fs.FS, option GrepOptions) GrepResult {
 	}
 	defer cleanup()
 
-	// searches for string
-	result, err := searchString(r, option)
+	// output of the preprocessor is searched instead of file
+	if option.Pre != "" && option.Path != "" {
+		pr, preCleanup, err := preprocess(r, option)
+		if err != nil {
+			return GrepResult{Error: err}
+		}
+		defer preCleanup()
+		return grepReader(pr, option.Path, m, option)
+	}
+
+	// chunks can be read independently only if file supports reading at an offset
+	if ra, ok := r.(io.ReaderAt); ok && option.ParallelFile && canSearchParallel(option) {
+		if info, err := fs.Stat(fSys, option.Path); err == nil {
+			return grepParallel(ra, info.Size(), option.Path, m, option)
+		}
+	}
+	return grepReader(r, option.Path, m, option)
+}
+
+// GrepReader greps the lines read from r, just like Grep does for a file
+// returns the result with path set to name, for content that doesn't come from a file system
+func GrepReader(r io.Reader, name string, option GrepOptions) GrepResult {
+	m, err := newMatcher(option)
 	if err != nil {
 		return GrepResult{Error: err}
 	}
+	return grepReader(r, name, m, option)
+}
+
+// GrepReader with the matcher built by the caller
+func grepReader(r io.Reader, name string, m matcher, option GrepOptions) GrepResult {
+	bc := &byteCounter{r: r}
+
+	// only checks for a match, stops reading at the first one
+	if option.FilesWithMatches {
+		matched, err := hasMatchWith(bc, m, option)
+		if err != nil {
+			return GrepResult{Error: err}
+		}
+		return GrepResult{Path: name, Matched: matched, BytesScanned: bc.n}
+	}
+
+	// searches for string
+	result, err := searchWith(bc, m, option)
+	if err != nil && !isContextError(err) {
+		return GrepResult{Error: err}
+	}
+
+	// result cut short by the context has the lines found till then, along with the error
+	res := newResult(name, result, option)
+	res.Error = err
+	res.BytesScanned = bc.n
+	return res
+}
+
+// counts the bytes read through it
+type byteCounter struct {
+	r io.Reader
+	n int64
+}
+
+func(bc *byteCounter) Read(p []byte) (int, error) {
+	n, err := bc.r.Read(p)
+	bc.n += int64(n)
+	return n, err
+}
 
-	// prepares the result of string search
+// prepares the result of string search on the basis of options
+func newResult(name string, result GrepResult, option GrepOptions) GrepResult {
+	// text takes precedence over both ways of handling a binary file
+	if option.Text {
+		result.Binary = false
+	}
+	// binary file is same as a file without matches
+	if option.IgnoreBinaryMatches && result.Binary {
+		return GrepResult{Path: name, Binary: true}
+	}
 	res := GrepResult{
-		Path: option.Path,
+		Path: name,
+		Matched: result.LineCount > 0,
+		matchedLineCount: result.LineCount,
+		Binary: result.Binary,
 	}
-	if option.LineCount {
-		res.LineCount = len(result)
+	if option.LineCount && option.OnlyMatching {
+		// each matched part is a line of output in OnlyMatching, so they are counted instead of lines
+		res.LineCount = result.MatchCount
+	} else if option.LineCount {
+		res.LineCount = result.LineCount
+	} else if option.CountMatches {
+		res.MatchCount = result.MatchCount
 	} else {
-		res.MatchedLines = result
+		res.MatchedLines = result.MatchedLines
+		res.LineNumbers = result.LineNumbers
+		res.Groups = result.Groups
+		res.ByteOffsets = result.ByteOffsets
 	}
 
 	return res
 }
 
+// Search is the lowest-level entry point, it greps the lines read from r without any file system
+// returns the matched lines (with context) on the basis of options, path and stdin in options are ignored
+func Search(r io.Reader, option GrepOptions) ([]string, error) {
+	result, err := searchString(r, option)
+	if err != nil {
+		return nil, err
+	}
+	return result.MatchedLines, nil
+}
+
+// Replace copies the lines read from r to w, with the matches replaced in the matched lines
+// unlike Search, every line is written along with its original line ending, so that it can be used to rewrite a file
+// lines out of LineRange, HeadLines and TailLines are copied as they are, like the ones without a match
+// content is read in memory with TailLines, since the last lines can't be known till the end
+// only the field is matched and replaced with FieldNum, rest of the line is kept as is
+// raw lines are matched and written, so the options which change the content searched by Grep are rejected
+func Replace(r io.Reader, w io.Writer, option GrepOptions) error {
+	if option.Replace == nil {
+		return ErrNoReplace
+	}
+	if option.Encoding != "" || option.Pre != "" || option.Multiline {
+		return ErrReplaceDecoded
+	}
+	m, err := newMatcher(option)
+	if err != nil {
+		return err
+	}
+
+	delim := lineDelim(option)
+	// lines up to firstTail are before the last TailLines lines
+	firstTail := 0
+	if option.TailLines > 0 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		total := bytes.Count(data, []byte{delim})
+		if len(data) > 0 && data[len(data)-1] != delim {
+			total++
+		}
+		firstTail = total - option.TailLines
+		r = bytes.NewReader(data)
+	}
+
+	br := bufio.NewReader(r)
+	// UTF-16 is decoded by default if it has a BOM, so its lines aren't the ones matched
+	if bom, _ := br.Peek(2); hasUTF16BOM(bom) {
+		return ErrReplaceDecoded
+	}
+	lineNum := 0
+	for {
+		line, err := br.ReadString(delim)
+		if len(line) > 0 {
+			lineNum++
+			// separating the line ending, so that it's written back as is
+			content := strings.TrimSuffix(line, string(delim))
+			if delim == '\n' {
+				content = strings.TrimSuffix(content, "\r")
+			}
+			ending := line[len(content):]
+
+			selected := inLineRange(lineNum, option.LineRange) && (option.HeadLines == 0 || lineNum <= option.HeadLines) && lineNum > firstTail
+			if text, textStart, hasText := matchedText(content, option); selected && hasText && m.match(text) {
+				content = content[:textStart] + m.replaceAll(text, *option.Replace) + content[textStart+len(text):]
+			}
+			if _, err := io.WriteString(w, content+ending); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// checks if result has anything to output
+func hasResult(result GrepResult) bool {
+	return result.Matched || len(result.MatchedLines) != 0 || result.LineCount != 0 || result.MatchCount != 0
+}
+
 // gets reader for the file
 func getReader(fSys fs.FS, option GrepOptions) (io.Reader, func(), error) {
 	if option.Path != "" {
-		err := isValid(fSys, option.Path, option.OrigPath)
-		if err != nil {
-			return nil, nil, err
+		if option.NoFollowSymlink && isSymlink(fSys, option.Path) {
+			return nil, nil, fmt.Errorf("%s: %w", option.OrigPath, ErrSymlink)
 		}
-
-		file, err := fSys.Open(option.Path)
+		file, err := openFile(fSys, option.Path, option.OrigPath)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -143,88 +775,711 @@ func getReader(fSys fs.FS, option GrepOptions) (io.Reader, func(), error) {
 }
 
 // main logic of string search
-func searchString(r io.Reader, options GrepOptions) ([]string, error) {
+// returns the matched lines (with context) along with their line numbers, count of matched lines and count of matches
+func searchString(r io.Reader, options GrepOptions) (GrepResult, error) {
+	// init matcher for the keyword
+	m, err := newMatcher(options)
+	if err != nil {
+		return GrepResult{}, err
+	}
+	return searchWith(r, m, options)
+}
+
+// searchString with the matcher built by the caller, so that it can be reused across readers
+func searchWith(r io.Reader, m matcher, options GrepOptions) (GrepResult, error) {
+	// decodes the content to UTF-8 before scanning
+	r, err := decodeReader(r, options.Encoding)
+	if err != nil {
+		return GrepResult{}, err
+	}
+	// regexp may span lines, so can't be scanned line by line
+	if options.Multiline && options.Regexp {
+		return searchMultiline(r, m)
+	}
+	// last lines can't be known till the end, so they are kept aside and searched once it's read
+	if options.TailLines > 0 {
+		return searchTail(r, m, options)
+	}
 	// init buffer
 	grepBuffer := NewGrepBuffer(options.LinesBeforeMatch)	
 	// counter for lines to save after match
 	afterMatchCount := 0
-	
-	keyword := options.Keyword
-	if options.IgnoreCase {		// normalising keyword if ignoreCase was passed
-		keyword = strings.ToLower(options.Keyword)
-	}
 
 	var result []string		// to save final output
-	scanner := bufio.NewScanner(r)
-	scanner.Split(bufio.ScanLines)
+	var lineNumbers []int	// to save line number of each line in output
+	var groups []MatchGroup		// to save the structured output, if asked for
+	var pending []int		// index of the groups whose lines after match aren't complete yet
+	var byteOffsets []int64		// to save byte offset of each line in output, if asked for
+	var beforeOffsets []int64		// byte offset of each line in buffer
+	lineNum, lineCount, matchCount := options.lineOffset, 0, 0
+	lastEmitted := 0		// line number of the last line in output, so that context of nearby matches isn't repeated
+	binary := false		// if any line read has a NUL byte
+	done := contextDone(options)
+	scanner, buf := newScanner(r, options.LineDelim)
+	defer scanBufferPool.Put(buf)
+	offsets := &offsetSplit{split: splitFunc(options.LineDelim)}
+	if options.ByteOffset {
+		scanner.Split(offsets.scan)
+	}
 	for scanner.Scan() {
-		line := scanner.Text()
-		
-		// saves lines after match in output
-		if afterMatchCount > 0 {
-			result = append(result, scanner.Text())
-			afterMatchCount--
+		// returns what's found till now if context is done
+		select {
+		case <-done:
+			return GrepResult{MatchedLines: result, LineNumbers: lineNumbers, LineCount: lineCount, MatchCount: matchCount, Groups: groups, ByteOffsets: byteOffsets, Binary: binary}, options.Context.Err()
+		default:
+		}
+
+		// rest of the lines aren't read once the head is searched
+		if options.HeadLines > 0 && lineNum >= options.HeadLines {
+			break
+		}
+		lineNum++
+		// lines past the range are read only for the context of the matches in it
+		if pastLineRange(lineNum, options.LineRange) && afterMatchCount == 0 && len(pending) == 0 {
+			break
+		}
+		line, ok, err := checkUTF8(scanner.Text(), lineNum, options.EncodingErrorMode)
+		if err != nil {
+			return GrepResult{}, err
+		}
+		if !ok {
+			continue
+		}
+		binary = binary || strings.IndexByte(line, 0) >= 0
+		// offset of the line is the count of bytes consumed before it, so the delimiter (and \r before it) is counted only if it's there
+		lineStart := offsets.start
+		if options.lineStarts != nil {
+			lineStart = options.lineStarts[lineNum-options.lineOffset-1]
 		}
 
-		// normalising line if ignoreCase
-		if options.IgnoreCase {
-			line = strings.ToLower(scanner.Text())
+		// saving the line after the previous matches in their groups, before it's checked for a match itself
+		if options.Structured && !options.OnlyMatching && options.SnippetRadius == 0 {
+			pending = appendAfter(groups, pending, line, options.LinesAfterMatch)
 		}
+		
+		// part of line to be matched, index of matches in it are shifted to the ones in line
+		text, textStart, hasText := matchedText(line, options)
 
 		// comparison and saving lines if matched
-		if strings.Contains(line, keyword) {
+		if inLineRange(lineNum, options.LineRange) && hasText && m.match(text) {
+			lineCount++
+			matches := m.findAll(text)
+			for _, loc := range matches {
+				loc[0], loc[1] = loc[0]+textStart, loc[1]+textStart
+			}
+
+			// saving only the matched parts of line (or their snippets), context is ignored in this case
+			// empty matches aren't in output, so they aren't counted either, nor are the ones after the limit per line
+			if options.OnlyMatching || options.SnippetRadius > 0 {
+				saved := 0
+				for _, loc := range matches {
+					if options.MaxMatchesPerLine > 0 && saved == options.MaxMatchesPerLine {
+						break
+					}
+					if loc[0] == loc[1] {
+						continue
+					}
+					part := options.MarkBefore+line[loc[0]:loc[1]]+options.MarkAfter
+					if options.SnippetRadius > 0 {
+						part = snippetBefore(line[:loc[0]], options.SnippetRadius)+part+snippetAfter(line[loc[1]:], options.SnippetRadius)
+					}
+					result = append(result, part)
+					lineNumbers = append(lineNumbers, lineNum)
+					if options.ByteOffset {
+						byteOffsets = append(byteOffsets, lineStart+int64(loc[0]))
+					}
+					matchCount++
+					saved++
+				}
+				continue
+			}
+			matchCount += len(matches)
+
 			// saving lines if before match was passed
 			if options.LinesBeforeMatch > 0 {
-				result = append(result, grepBuffer.Dump()...)
+				before := grepBuffer.Dump()
+				// buffer holds the lines just before the current one
+				for i, beforeLine := range before {
+					beforeNum := lineNum-len(before)+i
+					// skips the lines already in output as context or match of the previous match
+					if beforeNum <= lastEmitted {
+						continue
+					}
+					result = append(result, beforeLine)
+					lineNumbers = append(lineNumbers, beforeNum)
+					if options.ByteOffset {
+						byteOffsets = append(byteOffsets, beforeOffsets[i])
+					}
+				}
+			}
+
+			// saving the matched line, with the matches replaced if replace was passed, or marked
+			matched := line
+			if options.Replace != nil {
+				matched = line[:textStart] + m.replaceAll(text, *options.Replace) + line[textStart+len(text):]
+			} else if options.MarkBefore != "" || options.MarkAfter != "" {
+				matched = markAll(line, matches, options.MarkBefore, options.MarkAfter)
+			}
+			result = append(result, matched)
+			lineNumbers = append(lineNumbers, lineNum)
+			if options.ByteOffset {
+				byteOffsets = append(byteOffsets, lineStart)
 			}
 
-			// saving the matched line
-			result = append(result, scanner.Text())
+			// saving the group of match with the lines before it, lines after it are saved as they are read
+			if options.Structured {
+				groups = append(groups, MatchGroup{Before: slices.Clone(grepBuffer.Dump()), Match: matched, LineNumber: lineNum})
+				if options.LinesAfterMatch > 0 {
+					pending = append(pending, len(groups)-1)
+				}
+			}
+			lastEmitted = lineNum
 			
 			// saving lines if after match was passed
+			// a match within the lines after the previous one restarts the count from itself
 			if options.LinesAfterMatch > 0 {
 				afterMatchCount = options.LinesAfterMatch
 			}
+		} else if afterMatchCount > 0 {
+			// saves lines after match in output, only if it isn't a match itself
+			result = append(result, line)
+			lineNumbers = append(lineNumbers, lineNum)
+			if options.ByteOffset {
+				byteOffsets = append(byteOffsets, lineStart)
+			}
+			lastEmitted = lineNum
+			afterMatchCount--
 		}
 		
 		// save lines to buffer
 		if options.LinesBeforeMatch > 0 {
-			grepBuffer.Push(scanner.Text())
+			grepBuffer.Push(line)
+			if options.ByteOffset {
+				beforeOffsets = pushOffset(beforeOffsets, lineStart, options.LinesBeforeMatch)
+			}
 		}
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return GrepResult{}, err
+	}
+
+	return GrepResult{MatchedLines: result, LineNumbers: lineNumbers, LineCount: lineCount, MatchCount: matchCount, Groups: groups, ByteOffsets: byteOffsets, Binary: binary}, nil
+}
+
+// searches the last TailLines lines of the decoded r, rest of the lines are only read
+// head in HeadLines is counted from the start of the file, so only the lines in both of them are searched
+func searchTail(r io.Reader, m matcher, options GrepOptions) (GrepResult, error) {
+	tail := NewGrepBuffer(options.TailLines)
+	var starts []int64		// byte offset of each line in tail
+	skipped := 0
+	done := contextDone(options)
+	scanner, buf := newScanner(r, options.LineDelim)
+	defer scanBufferPool.Put(buf)
+	offsets := &offsetSplit{split: splitFunc(options.LineDelim)}
+	if options.ByteOffset {
+		scanner.Split(offsets.scan)
+	}
+	for scanner.Scan() {
+		select {
+		case <-done:
+			return GrepResult{}, options.Context.Err()
+		default:
+		}
+
+		if len(tail.Dump()) == options.TailLines {
+			skipped++
+		}
+		tail.Push(scanner.Text())
+		if options.ByteOffset {
+			starts = pushOffset(starts, offsets.start, options.TailLines)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return GrepResult{}, err
+	}
+
+	// tail is already decoded, so it's searched as is
+	options.TailLines = 0
+	options.Encoding = ""
+	options.lineOffset = skipped
+	options.lineStarts = starts
+	var content strings.Builder
+	for _, line := range tail.Dump() {
+		content.WriteString(line)
+		content.WriteByte(lineDelim(options))
+	}
+	return searchWith(strings.NewReader(content.String()), m, options)
+}
+
+// checks if the line number is within the range of LineRange, every line is if the range is zero
+func inLineRange(lineNum int, lineRange [2]int) bool {
+	return lineNum >= lineRange[0] && !pastLineRange(lineNum, lineRange)
+}
+
+// checks if the line number is after the end of range, never if the range has no end
+func pastLineRange(lineNum int, lineRange [2]int) bool {
+	return lineRange[1] > 0 && lineNum > lineRange[1]
+}
+
+// returns the part of line to be matched with its start index in line, which is the field in FieldNum if passed
+// reports false if line doesn't have the field, so that it doesn't match even an empty keyword
+func matchedText(line string, options GrepOptions) (string, int, bool) {
+	if options.FieldNum <= 0 {
+		return line, 0, true
+	}
+	if options.FieldSep == "" {
+		return spaceField(line, options.FieldNum)
+	}
+
+	start := 0
+	for n := 1; n < options.FieldNum; n++ {
+		i := strings.Index(line[start:], options.FieldSep)
+		if i < 0 {
+			return "", 0, false
+		}
+		start += i + len(options.FieldSep)
+	}
+	if end := strings.Index(line[start:], options.FieldSep); end >= 0 {
+		return line[start:start+end], start, true
+	}
+	return line[start:], start, true
+}
+
+// returns the nth field of line separated by runs of white space, like awk, with its start index in line
+func spaceField(line string, n int) (string, int, bool) {
+	count, start := 0, -1
+	for i, r := range line {
+		if unicode.IsSpace(r) {
+			if start >= 0 && count == n {
+				return line[start:i], start, true
+			}
+			start = -1
+			continue
+		}
+		if start < 0 {
+			start = i
+			count++
+		}
+	}
+	if start >= 0 && count == n {
+		return line[start:], start, true
+	}
+	return "", 0, false
+}
+
+// returns the last n runes of s, with ... before them if s is longer
+func snippetBefore(s string, n int) string {
+	i := len(s)
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:i])
+		i -= size
+	}
+	if i > 0 {
+		return "..." + s[i:]
+	}
+	return s
+}
+
+// returns the first n runes of s, with ... after them if s is longer
+func snippetAfter(s string, n int) string {
+	i := 0
+	for ; n > 0 && i < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	if i < len(s) {
+		return s[:i] + "..."
+	}
+	return s
+}
+
+// wraps each match in line with before and after, at the start and end index in matches
+// empty matches aren't marked, as there's nothing to wrap
+func markAll(line string, matches [][]int, before, after string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range matches {
+		if loc[0] == loc[1] {
+			continue
+		}
+		b.WriteString(line[last:loc[0]])
+		b.WriteString(before)
+		b.WriteString(line[loc[0]:loc[1]])
+		b.WriteString(after)
+		last = loc[1]
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
+
+// appends the line to the lines after match of each pending group, returns the groups which are still pending
+// groups are pending in the order of their matches, so the ones completed by the line are always at the start
+func appendAfter(groups []MatchGroup, pending []int, line string, linesAfterMatch int) []int {
+	for _, i := range pending {
+		groups[i].After = append(groups[i].After, line)
+	}
+	for len(pending) > 0 && len(groups[pending[0]].After) >= linesAfterMatch {
+		pending = pending[1:]
+	}
+	return pending
+}
+
+// returns a line scanner over r with the buffer from pool, lines are split at delim (new line if it's zero)
+// buffer has to be put back in the pool once scanning is done, and the scanner must not be used after it
+// lines from scanner.Text() are copies, so they are safe to use after that
+func newScanner(r io.Reader, delim byte) (*bufio.Scanner, *[]byte) {
+	var buf *[]byte
+	if poolScanBuffers {
+		buf = scanBufferPool.Get().(*[]byte)
+	} else {
+		newBuf := make([]byte, 4096)
+		buf = &newBuf
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(*buf, bufio.MaxScanTokenSize)
+	scanner.Split(splitFunc(delim))
+	return scanner, buf
+}
+
+// returns the split function for the lines ending with delim
+func splitFunc(delim byte) bufio.SplitFunc {
+	if delim == 0 || delim == '\n' {
+		return bufio.ScanLines
+	}
+	return scanDelim(delim)
+}
+
+// split function which keeps the byte offset of the last line returned, around the split function of the lines
+// offsets are counted from the bytes consumed by the split, so the line isn't assumed to end with a delimiter
+// last line without one is then at the right offset, and so is the line after \r\n
+type offsetSplit struct {
+	split bufio.SplitFunc
+	start int64		// offset of the last line
+	next int64		// offset of the next line, after the delimiter of the last one if it had it
+}
+
+func(o *offsetSplit) scan(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := o.split(data, atEOF)
+	if token != nil {
+		o.start = o.next
+	}
+	o.next += int64(advance)
+	return advance, token, err
+}
+
+// appends the offset to offsets, keeping the last n of them like grepBuffer
+func pushOffset(offsets []int64, offset int64, n int) []int64 {
+	if len(offsets) == n {
+		offsets = offsets[1:]
+	}
+	return append(offsets, offset)
+}
+
+// split function for the lines ending with delim, same as bufio.ScanLines except that \r isn't dropped
+// last line is returned even if it doesn't end with delim
+func scanDelim(delim byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.IndexByte(data, delim); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// returns the delimiter of lines in options
+func lineDelim(options GrepOptions) byte {
+	if options.LineDelim == 0 {
+		return '\n'
+	}
+	return options.LineDelim
+}
+
+// multiline version of searchString, runs the regexp over the full content
+// reads the whole content in memory, so it's only used if Multiline is passed
+// returns the matched spans along with the line number where each one starts
+func searchMultiline(r io.Reader, m matcher) (GrepResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return GrepResult{}, err
+	}
+	content := string(data)
+
+	var result []string
+	var lineNumbers []int
+	for _, loc := range m.findAll(content) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		result = append(result, content[loc[0]:loc[1]])
+		lineNumbers = append(lineNumbers, strings.Count(content[:loc[0]], "\n")+1)
 	}
+	return GrepResult{MatchedLines: result, LineNumbers: lineNumbers, LineCount: len(result), MatchCount: len(result), Binary: bytes.IndexByte(data, 0) >= 0}, nil
+}
 
-	return result, nil
+// short-circuiting version of searchString
+// returns as soon as the first matching line is found, without reading the rest
+func hasMatch(r io.Reader, options GrepOptions) (bool, error) {
+	m, err := newMatcher(options)
+	if err != nil {
+		return false, err
+	}
+	return hasMatchWith(r, m, options)
 }
 
-// checks if file is valid for reading
-func isValid(fSys fs.FS, path, origPath string) error {
-	// gets the file details
-	fileInfo, err := fs.Stat(fSys, path)
+// hasMatch with the matcher built by the caller
+func hasMatchWith(r io.Reader, m matcher, options GrepOptions) (bool, error) {
+	// whole file has to be read for the tail anyway, for the regexp spanning lines, and to know that there's no NUL byte after the match
+	ignoreBinary := options.IgnoreBinaryMatches && !options.Text
+	if options.TailLines > 0 || (options.Multiline && options.Regexp) || ignoreBinary {
+		result, err := searchWith(r, m, options)
+		return result.LineCount > 0 && !(ignoreBinary && result.Binary), err
+	}
+
+	r, err := decodeReader(r, options.Encoding)
+	if err != nil {
+		return false, err
+	}
+
+	lineNum := 0
+	done := contextDone(options)
+	scanner, buf := newScanner(r, options.LineDelim)
+	defer scanBufferPool.Put(buf)
+	for scanner.Scan() {
+		select {
+		case <-done:
+			return false, options.Context.Err()
+		default:
+		}
+
+		if options.HeadLines > 0 && lineNum >= options.HeadLines {
+			break
+		}
+		lineNum++
+		if pastLineRange(lineNum, options.LineRange) {
+			break
+		}
+		line, ok, err := checkUTF8(scanner.Text(), lineNum, options.EncodingErrorMode)
+		if err != nil {
+			return false, err
+		}
+		if !ok || !inLineRange(lineNum, options.LineRange) {
+			continue
+		}
+		if text, _, hasText := matchedText(line, options); hasText && m.match(text) {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// returns the done channel of context in options, nil (which is never done) if there's no context
+// checking it in select is cheaper than ctx.Err(), so it's fine for every line
+func contextDone(options GrepOptions) <-chan struct{} {
+	if options.Context == nil {
+		return nil
+	}
+	return options.Context.Done()
+}
+
+// checks if the search was stopped by the context
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// opens the file for reading, maps the errors to the ones with path in them
+// permissions are checked by the open itself, since mode bits can't tell the access of current user (eg: root or ACLs)
+func openFile(fSys fs.FS, path, origPath string) (fs.File, error) {
+	file, err := fSys.Open(path)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			return fmt.Errorf("%s: %w", origPath, fs.ErrNotExist)
+			return nil, fmt.Errorf("%s: %w", origPath, fs.ErrNotExist)
 		}
-		return fmt.Errorf("%s: %w", path, err)
+		if errors.Is(err, fs.ErrPermission) {
+			return nil, fmt.Errorf("%s: %w", path, fs.ErrPermission)
+		}
+		return nil, err
 	}
 
-	// checks for directory
+	// checks for directory, which can be opened but not read
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
 	if fileInfo.IsDir() {
-		return fmt.Errorf("%s: %w", origPath, ErrIsDirectory)
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", origPath, ErrIsDirectory)
+	}
+
+	return file, nil
+}
+
+// file system which can stat a symlink itself, like os.DirFS and fstest.MapFS
+type lstatFS interface {
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// checks if the file at path is a symlink, it's never one if fSys can't tell
+func isSymlink(fSys fs.FS, path string) bool {
+	lfs, ok := fSys.(lstatFS)
+	if !ok {
+		return false
+	}
+	info, err := lfs.Lstat(path)
+	return err == nil && info.Mode()&fs.ModeSymlink != 0
+}
+
+// cuts the result to its first n matched lines
+// context lines can't be told apart from the matched ones, so the lines are kept as is with context
+func limitResult(result GrepResult, n int, option GrepOptions) GrepResult {
+	if result.matchedLineCount <= n {
+		return result
+	}
+	result.matchedLineCount = n
+	if option.LineCount && !option.OnlyMatching {
+		result.LineCount = n
+	}
+	if len(result.Groups) > n {
+		result.Groups = result.Groups[:n]
+	}
+	if option.LinesBeforeMatch > 0 || option.LinesAfterMatch > 0 {
+		return result
 	}
 
-	// checks for permissions
-	// looks hacky, might have to change later
-	if fileInfo.Mode().Perm()&400 == 0 {
-		return fmt.Errorf("%s: %w", path, fs.ErrPermission)
+	// keeps the entries of first n lines, OnlyMatching has an entry for each matched part of line
+	lines, last := 0, 0
+	for i, num := range result.LineNumbers {
+		if num != last {
+			lines++
+			last = num
+		}
+		if lines > n {
+			result.MatchedLines = result.MatchedLines[:i]
+			result.LineNumbers = result.LineNumbers[:i]
+			if len(result.ByteOffsets) > i {
+				result.ByteOffsets = result.ByteOffsets[:i]
+			}
+			break
+		}
 	}
+	return result
+}
+
+// sorts the results by the key in option, path breaks the ties so that the order is deterministic
+// unknown key is same as path
+func sortResults(results []GrepResult, option GrepOptions) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if option.SortReverse {
+			a, b = b, a
+		}
+		switch option.SortBy {
+		case SortModified:
+			if !a.modTime.Equal(b.modTime) {
+				return a.modTime.Before(b.modTime)
+			}
+		case SortCount:
+			if a.matchedLineCount != b.matchedLineCount {
+				return a.matchedLineCount < b.matchedLineCount
+			}
+		}
+		return lessPath(a.Path, b.Path)
+	})
+}
 
-	return nil
+// compares the paths an element at a time, so that the order is same as the walk
+// eg: "dir/a.txt" comes before "dir.txt", since the directory "dir" comes before the file "dir.txt"
+func lessPath(a, b string) bool {
+	for a != "" && b != "" {
+		aElem, aRest, _ := strings.Cut(a, "/")
+		bElem, bRest, _ := strings.Cut(b, "/")
+		if aElem != bElem {
+			return aElem < bElem
+		}
+		a, b = aRest, bRest
+	}
+	return a == "" && b != ""
+}
+
+// checks if the file has zero bytes, a file whose size can't be read isn't empty so that its error is reported on open
+func isEmpty(d fs.DirEntry) bool {
+	info, err := d.Info()
+	return err == nil && info.Size() == 0
+}
+
+// checks if directory is excluded by user provided or default patterns
+// both apply, default ones can be turned off with NoDefaultExcludes
+func isExcludedDir(name string, option GrepOptions) bool {
+	if matchesAny(name, option.ExcludeDir) {
+		return true
+	}
+	return !option.NoDefaultExcludes && matchesAny(name, defaultExcludeDir)
+}
+
+// checks if file should be searched on the basis of include and exclude extensions
+// precedence is as follows:
+//   - exclude wins over include, so a file matching both is not searched
+//   - if any include is passed, file must match at least one of them
+//   - if nothing is passed, every file is searched
+func shouldSearch(name string, option GrepOptions) bool {
+	ext := normaliseExt(filepath.Ext(name))
+	if containsExt(option.ExcludeExt, ext) {
+		return false
+	}
+	if len(option.IncludeExt) > 0 {
+		return containsExt(option.IncludeExt, ext)
+	}
+	return true
+}
+
+// checks if ext is present in the user provided extensions
+func containsExt(exts []string, ext string) bool {
+	for _, e := range exts {
+		if normaliseExt(e) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// strips the leading dot, so that both ".txt" and "txt" work
+// and lowercases it, so that "README.TXT" matches "txt"
+func normaliseExt(ext string) string {
+	return strings.ToLower(strings.TrimPrefix(ext, "."))
+}
+
+// checks if name matches any of the glob patterns
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
 }
 
 // returns the file path from user provided path
+// returns the path relative to the root of walk, or the name of file if root is the file itself
+// so that the root doesn't make every path match in NameOnly and PathFilter
+func relativePath(filePath, root string) string {
+	if filePath == root {
+		return path.Base(filePath)
+	}
+	if root == "." {
+		return filePath
+	}
+	return strings.TrimPrefix(filePath, root+"/")
+}
+
 func normalisePathFromRoot(rootPath, userPath string) string {
 	userPathClean := strings.TrimPrefix(userPath, "../")
     idx := strings.Index(rootPath, userPathClean)
@@ -0,0 +1,125 @@
+package grep
+
+import (
+	"container/list"
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// Cache keeps the results of searched files, so that a file which didn't change since isn't searched again
+// it's consulted by Grep, GrepR and Engine before opening each file, if it's passed in options
+// results put in it are shared with the caller, so they must not be modified by either of them
+type Cache interface {
+	Get(key CacheKey) (GrepResult, bool)
+	Put(key CacheKey, result GrepResult)
+}
+
+// key of a file in Cache, result of a file changes with any of them
+type CacheKey struct {
+	Path string
+	ModTime int64		// modification time of file in unix nanoseconds
+	Size int64
+	Options string		// rest of the options of search, so that the same cache can be used for different keywords
+}
+
+// searches the file like searchFile, but returns the result from cache if the file is unchanged since it was put
+// results with an error aren't put, so that they are tried again, and so aren't the ones of stdin
+func grepFile(fSys fs.FS, m matcher, option GrepOptions) GrepResult {
+	if option.Cache == nil || option.Path == "" {
+		return searchFile(fSys, m, option)
+	}
+	info, err := fs.Stat(fSys, option.Path)
+	if err != nil {
+		return searchFile(fSys, m, option)
+	}
+
+	key := CacheKey{Path: option.Path, ModTime: info.ModTime().UnixNano(), Size: info.Size(), Options: optionsKey(option)}
+	if result, ok := option.Cache.Get(key); ok {
+		// nothing is read from the file this time
+		result.BytesScanned = 0
+		return result
+	}
+	result := searchFile(fSys, m, option)
+	if result.Error == nil {
+		option.Cache.Put(key, result)
+	}
+	return result
+}
+
+// returns the options which change the result of a file as a string, path is in the key on its own
+// fields are listed one by one, so that the ones of walk, callbacks and the like don't split the cache
+// a new option which changes the result has to be added here as well
+func optionsKey(option GrepOptions) string {
+	replace := ""
+	if option.Replace != nil {
+		replace = *option.Replace
+	}
+	fields := []any{
+		option.Keyword, option.AllKeywords, option.ButNot, option.Patterns, option.SkipBlank,
+		option.HeadLines, option.TailLines, option.LineRange, option.ByteOffset, option.MarkBefore, option.MarkAfter,
+		option.SnippetRadius, option.IgnoreBinaryMatches, option.Text, option.Plural, option.FieldNum, option.FieldSep,
+		option.IgnoreCase, option.LinesBeforeMatch, option.LinesAfterMatch, option.LineCount, option.CountMatches,
+		option.OnlyMatching, option.MaxMatchesPerLine, option.Regexp, option.Encoding, option.EncodingErrorMode,
+		option.FilesWithMatches, option.Multiline, option.Replace != nil, replace, option.ParallelFile, option.LineDelim,
+		option.ASCII, option.Structured, option.MatchStart, option.MatchEnd, option.Pre,
+	}
+	return fmt.Sprintf("%#v", fields)
+}
+
+// LRUCache is a Cache in memory, which keeps the results of the files used most recently
+// it's safe for concurrent use, so that it can be shared by the workers of GrepR
+type LRUCache struct {
+	mu sync.Mutex
+	size int
+	entries map[CacheKey]*list.Element
+	order *list.List		// entries from the most recently used one to the least
+}
+
+type lruEntry struct {
+	key CacheKey
+	result GrepResult
+}
+
+// cache of the results of up to size files, least recently used one is dropped beyond it
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size: size,
+		entries: make(map[CacheKey]*list.Element),
+		order: list.New(),
+	}
+}
+
+func(c *LRUCache) Get(key CacheKey) (GrepResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return GrepResult{}, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry).result, true
+}
+
+func(c *LRUCache) Put(key CacheKey, result GrepResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*lruEntry).result = result
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, result: result})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// count of results in cache
+func(c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,140 @@
+package grep
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestGrepRCache(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	testFS["testdata/file1.txt"] = &fstest.MapFile{Data: []byte("foo\nbar"), Mode: 0755, ModTime: modTime}
+	testFS["testdata/file2.txt"] = &fstest.MapFile{Data: []byte("foo foo"), Mode: 0755, ModTime: modTime}
+	testFS["testdata/file3.txt"] = &fstest.MapFile{Data: []byte("baz"), Mode: 0755, ModTime: modTime}
+	countFS := countingFS{MapFS: testFS, opened: &atomic.Int64{}}
+	cache := NewLRUCache(10)
+
+	search := func(keyword string) []string {
+		countFS.opened.Store(0)
+		var got []string
+		for _, res := range GrepR(countFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: keyword, Cache: cache}) {
+			got = append(got, fmt.Sprintf("%s:%v", res.Path, res.MatchedLines))
+		}
+		return got
+	}
+
+	testCases := []struct {
+		name     string
+		keyword  string
+		modify   bool
+		expected []string
+		opened   int64
+	}{
+		{name: "first search reads every file", keyword: "foo", expected: []string{"testdata/file1.txt:[foo]", "testdata/file2.txt:[foo foo]"}, opened: 3},
+		{name: "same search is from cache", keyword: "foo", expected: []string{"testdata/file1.txt:[foo]", "testdata/file2.txt:[foo foo]"}, opened: 0},
+		{name: "another keyword isn't from cache", keyword: "bar", expected: []string{"testdata/file1.txt:[bar]"}, opened: 3},
+		{name: "modified file is read again", keyword: "foo", modify: true, expected: []string{"testdata/file1.txt:[foo foo]", "testdata/file2.txt:[foo foo]"}, opened: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.modify {
+				testFS["testdata/file1.txt"] = &fstest.MapFile{Data: []byte("foo foo\nbar"), Mode: 0755, ModTime: modTime.Add(time.Second)}
+			}
+			got := search(tc.keyword)
+			if !slices.Equal(got, tc.expected) {
+				t.Errorf("Expected %v but got %v", tc.expected, got)
+			}
+			if opened := countFS.opened.Load(); opened != tc.opened {
+				t.Errorf("Expected %d files to be read but got %d", tc.opened, opened)
+			}
+		})
+	}
+}
+
+func TestEngineCache(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata/file1.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+	countFS := countingFS{MapFS: testFS, opened: &atomic.Int64{}}
+
+	engine, err := NewEngine(GrepOptions{Keyword: "foo", Cache: NewLRUCache(10)})
+	if err != nil {
+		t.Fatalf("Didn't expected an error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		got := engine.Grep(countFS, "testdata/file1.txt")
+		if !slices.Equal(got.MatchedLines, []string{"foo"}) {
+			t.Errorf("Expected %v but got %v", []string{"foo"}, got.MatchedLines)
+		}
+	}
+	if opened := countFS.opened.Load(); opened != 1 {
+		t.Errorf("Expected the file to be read once but got %d", opened)
+	}
+
+	// missing file isn't put in cache
+	for i := 0; i < 2; i++ {
+		if got := engine.Grep(countFS, "testdata/missing.txt"); got.Error == nil {
+			t.Errorf("Expected an error but didn't got one")
+		}
+	}
+}
+
+func TestOptionsKey(t *testing.T) {
+	empty := ""
+	base := GrepOptions{Keyword: "foo"}
+
+	// options of walk and callbacks don't change the result of a file
+	same := []GrepOptions{
+		{Keyword: "foo", Path: "a.txt", OrigPath: "a.txt"},
+		{Keyword: "foo", Context: context.Background(), ProgressFunc: func(int, int) {}},
+		{Keyword: "foo", SortBy: SortModified, ExcludeDir: []string{"dir"}, Report: true},
+	}
+	for _, option := range same {
+		if got, expected := optionsKey(option), optionsKey(base); got != expected {
+			t.Errorf("Expected %q but got %q", expected, got)
+		}
+	}
+
+	different := []GrepOptions{
+		{Keyword: "bar"},
+		{Keyword: "foo", IgnoreCase: true},
+		{Keyword: "foo", Replace: &empty},
+		{Keyword: "foo", Patterns: []Pattern{{Text: "bar"}}},
+		{Keyword: "foo", LineDelim: 0x1e},
+	}
+	for _, option := range different {
+		if got := optionsKey(option); got == optionsKey(base) {
+			t.Errorf("Expected key of %+v to differ from %q", option, got)
+		}
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	cache := NewLRUCache(2)
+	keys := []CacheKey{{Path: "a"}, {Path: "b"}, {Path: "c"}}
+	cache.Put(keys[0], GrepResult{Path: "a"})
+	cache.Put(keys[1], GrepResult{Path: "b"})
+
+	// a is used after b, so b is the least recently used one when c is put
+	if res, ok := cache.Get(keys[0]); !ok || res.Path != "a" {
+		t.Errorf("Expected %q in cache but got %v", "a", res)
+	}
+	cache.Put(keys[2], GrepResult{Path: "c"})
+
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 results in cache but got %d", cache.Len())
+	}
+	if _, ok := cache.Get(keys[1]); ok {
+		t.Errorf("Expected %q to be dropped from cache", "b")
+	}
+	for _, key := range []CacheKey{keys[0], keys[2]} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Expected %q in cache", key.Path)
+		}
+	}
+}
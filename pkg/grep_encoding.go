@@ -0,0 +1,63 @@
+package grep
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// handling of the lines with invalid UTF-8 after decoding, they are searched as is if not passed
+const (
+	EncodingErrorStrict = "strict"		// stops the search with ErrInvalidUTF8
+	EncodingErrorReplace = "replace"	// replaces each invalid byte sequence with U+FFFD
+	EncodingErrorSkip = "skip"		// skips the line, it's still counted for the line numbers
+)
+
+// checks if data starts with the BOM of UTF-16, which is decoded by default
+func hasUTF16BOM(data []byte) bool {
+	return len(data) >= 2 && (data[0] == 0xFF && data[1] == 0xFE || data[0] == 0xFE && data[1] == 0xFF)
+}
+
+// wraps the reader with a decoder to UTF-8 on the basis of encoding
+// if encoding is empty, UTF-8 and UTF-16 are detected from BOM, and anything else is read as is
+func decodeReader(r io.Reader, enc string) (io.Reader, error) {
+	var decoder transform.Transformer
+	switch strings.ToLower(enc) {
+	case "":
+		decoder = unicode.BOMOverride(encoding.Nop.NewDecoder())
+	case "utf-8", "utf8":
+		decoder = unicode.UTF8BOM.NewDecoder()
+	case "utf-16le":
+		decoder = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder()
+	case "utf-16be":
+		decoder = unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewDecoder()
+	case "latin1", "iso-8859-1":
+		decoder = charmap.ISO8859_1.NewDecoder()
+	default:
+		return nil, fmt.Errorf("%s: %w", enc, ErrInvalidEncoding)
+	}
+	return transform.NewReader(r, decoder), nil
+}
+
+// applies the encoding error mode to the line with invalid UTF-8, reports false if the line is to be skipped
+// valid lines are returned as is, so the check costs nothing more for them
+func checkUTF8(line string, lineNum int, mode string) (string, bool, error) {
+	if mode == "" || utf8.ValidString(line) {
+		return line, true, nil
+	}
+	switch mode {
+	case EncodingErrorStrict:
+		return "", false, fmt.Errorf("line %d: %w", lineNum, ErrInvalidUTF8)
+	case EncodingErrorReplace:
+		return strings.ToValidUTF8(line, string(utf8.RuneError)), true, nil
+	case EncodingErrorSkip:
+		return "", false, nil
+	}
+	return line, true, nil
+}
@@ -0,0 +1,60 @@
+package grep
+
+import (
+	"io"
+	"io/fs"
+)
+
+// Engine greps many inputs with the same options
+// the keyword is compiled and the options are validated once in NewEngine, instead of on every call
+// it's safe for concurrent use, since nothing is modified after NewEngine
+type Engine struct {
+	option GrepOptions
+	m matcher
+}
+
+func NewEngine(option GrepOptions) (*Engine, error) {
+	// invalid encoding and the like are otherwise reported only when the first input is read
+	m, err := option.validateMatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{option: option, m: m}, nil
+}
+
+// Search is same as the free function Search, with the options of engine
+func(e *Engine) Search(r io.Reader) ([]string, error) {
+	result, err := searchWith(r, e.m, e.option)
+	if err != nil {
+		return nil, err
+	}
+	return result.MatchedLines, nil
+}
+
+// Grep is same as the free function Grep for the file at path, with the options of engine
+func(e *Engine) Grep(fSys fs.FS, path string) GrepResult {
+	option := e.option
+	option.Path = path
+	option.OrigPath = path
+	return grepFile(fSys, e.m, option)
+}
+
+// position of a match in the line, as byte offsets, End is exclusive
+type MatchPos struct {
+	Start int
+	End int
+}
+
+// MatchLine checks the line against the options of engine, without any IO
+// returns the position of each non-overlapping match, including the empty ones of an empty or regexp keyword
+// line is matched as is, so the Encoding and LineDelim of options don't apply to it
+func(e *Engine) MatchLine(line string) (bool, []MatchPos) {
+	if !e.m.match(line) {
+		return false, nil
+	}
+	var positions []MatchPos
+	for _, loc := range e.m.findAll(line) {
+		positions = append(positions, MatchPos{Start: loc[0], End: loc[1]})
+	}
+	return true, positions
+}
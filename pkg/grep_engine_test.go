@@ -0,0 +1,126 @@
+package grep
+
+import (
+	"errors"
+	"io/fs"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEngineSearch(t *testing.T) {
+	engine, err := NewEngine(GrepOptions{Keyword: "match[0-9]", Regexp: true, IgnoreCase: true})
+	if err != nil {
+		t.Fatalf("Didn't expected an error: %v", err)
+	}
+
+	// same engine is reused across readers
+	testCases := []struct {
+		name   string
+		input  string
+		result []string
+	}{
+		{name: "reader with matches", input: "line1\nline2 MATCH1\nline3 match2", result: []string{"line2 MATCH1", "line3 match2"}},
+		{name: "reader without matches", input: "line1\nline2 match", result: nil},
+		{name: "another reader with matches", input: "match3", result: []string{"match3"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := engine.Search(strings.NewReader(tc.input))
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if !slices.Equal(got, tc.result) {
+				t.Errorf("Expected %v but got %v", tc.result, got)
+			}
+		})
+	}
+}
+
+func TestEngineGrep(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["file1.txt"] = &fstest.MapFile{Data: []byte("line1\nline2 match"), Mode: 0755}
+	testFS["file2.txt"] = &fstest.MapFile{Data: []byte("match\nmatch again"), Mode: 0755}
+
+	engine, err := NewEngine(GrepOptions{Keyword: "match", LineCount: true})
+	if err != nil {
+		t.Fatalf("Didn't expected an error: %v", err)
+	}
+
+	// concurrent use of the same engine, as in a server
+	expected := map[string]int{"file1.txt": 1, "file2.txt": 2}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		for path, count := range expected {
+			wg.Add(1)
+			go func(path string, count int) {
+				defer wg.Done()
+				got := engine.Grep(testFS, path)
+				if got.Error != nil {
+					t.Errorf("Didn't expected an error: %v", got.Error)
+					return
+				}
+				if got.Path != path || got.LineCount != count {
+					t.Errorf("Expected %s with count %d but got %s with count %d", path, count, got.Path, got.LineCount)
+				}
+			}(path, count)
+		}
+	}
+	wg.Wait()
+
+	if got := engine.Grep(testFS, "missing.txt"); !errors.Is(got.Error, fs.ErrNotExist) {
+		t.Errorf("Expected error %v but got %v", fs.ErrNotExist, got.Error)
+	}
+}
+
+func TestNewEngineInvalidOptions(t *testing.T) {
+	_, err := NewEngine(GrepOptions{Keyword: "line(", Regexp: true})
+	var syntaxErr *syntax.Error
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("Expected error %T but got %v", syntaxErr, err)
+	}
+
+	_, err = NewEngine(GrepOptions{Keyword: "line", Encoding: "ebcdic"})
+	if !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("Expected error %v but got %v", ErrInvalidEncoding, err)
+	}
+}
+
+func TestEngineMatchLine(t *testing.T) {
+	testCases := []struct {
+		name      string
+		option    GrepOptions
+		line      string
+		matched   bool
+		positions []MatchPos
+	}{
+		{name: "literal", option: GrepOptions{Keyword: "ab"}, line: "ab cab", matched: true, positions: []MatchPos{{0, 2}, {4, 6}}},
+		{name: "literal without match", option: GrepOptions{Keyword: "ab"}, line: "AB", matched: false},
+		{name: "regexp", option: GrepOptions{Keyword: "[0-9]+", Regexp: true}, line: "a1 b22", matched: true, positions: []MatchPos{{1, 2}, {4, 6}}},
+		{name: "ignore case", option: GrepOptions{Keyword: "straße", IgnoreCase: true}, line: "STRAßE", matched: true, positions: []MatchPos{{0, 7}}},
+		{name: "whole line", option: GrepOptions{Keyword: "ab", MatchStart: true, MatchEnd: true}, line: "ab", matched: true, positions: []MatchPos{{0, 2}}},
+		{name: "whole line without match", option: GrepOptions{Keyword: "ab", MatchStart: true, MatchEnd: true}, line: "ab ab", matched: false},
+		{name: "empty keyword", option: GrepOptions{Keyword: ""}, line: "ab", matched: true, positions: []MatchPos{{0, 0}}},
+		{name: "excluded by but not", option: GrepOptions{Keyword: "ab", ButNot: "cab"}, line: "ab cab", matched: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			engine, err := NewEngine(tc.option)
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			matched, positions := engine.MatchLine(tc.line)
+			if matched != tc.matched {
+				t.Errorf("Expected matched %v but got %v", tc.matched, matched)
+			}
+			if !slices.Equal(positions, tc.positions) {
+				t.Errorf("Expected %v but got %v", tc.positions, positions)
+			}
+		})
+	}
+}
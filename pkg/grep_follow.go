@@ -0,0 +1,119 @@
+package grep
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrFollowUTF16 = errors.New("can't follow UTF-16 input, since the appended content is split in lines before it's decoded")
+
+// Follow searches the file at path of the OS like Grep, then keeps searching the lines appended to it, like tail -f
+// handle is called with the result of existing content and then of each batch of appended lines, only if they matched
+// file is polled every interval once it's read till the end, since fs.FS has no way to wait for the writes
+// returns nil once option.Context is done, the error of handle once it fails, or the error of reading the file
+// only complete lines are searched, the last one waits for its delimiter, and context isn't carried across the batches
+// TailLines applies to the existing content only, which is read till the end in memory before it's searched
+// Multiline is ignored since a batch may end within a match
+// each batch is decoded on its own, so UTF-16 (passed in Encoding or detected from BOM) fails with ErrFollowUTF16
+func Follow(path string, option GrepOptions, interval time.Duration, handle func(GrepResult) error) error {
+	if err := option.validate(); err != nil {
+		return err
+	}
+	if strings.HasPrefix(strings.ToLower(option.Encoding), "utf-16") {
+		return fmt.Errorf("%s: %w", option.Encoding, ErrFollowUTF16)
+	}
+	m, err := newMatcher(option)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	delim := option.LineDelim
+	if delim == 0 {
+		delim = '\n'
+	}
+	done := contextDone(option)
+	// batches are searched in full, context is checked only between them
+	search := option
+	search.Context = nil
+	search.Multiline = false
+
+	var pending []byte		// lines read but not searched yet, ending with a partial line
+	var consumed int64		// count of bytes searched in the batches before, for the byte offsets
+	// searches the complete lines in pending, partial one stays in it
+	flush := func() error {
+		// BOM is only in the first batch, later ones would be read as is
+		if consumed == 0 && hasUTF16BOM(pending) {
+			return fmt.Errorf("%s: %w", path, ErrFollowUTF16)
+		}
+		i := bytes.LastIndexByte(pending, delim)
+		if i < 0 {
+			return nil
+		}
+		batch := pending[:i+1]
+		result, err := searchWith(bytes.NewReader(batch), m, search)
+		if err != nil {
+			return err
+		}
+		for j := range result.ByteOffsets {
+			result.ByteOffsets[j] += consumed
+		}
+		search.lineOffset += bytes.Count(batch, []byte{delim})
+		consumed += int64(len(batch))
+		pending = append(pending[:0], pending[i+1:]...)
+
+		if res := newResult(path, result, search); res.Matched {
+			return handle(res)
+		}
+		return nil
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		// stops between the reads as well, in case the file keeps growing
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+
+		n, err := file.Read(buf)
+		if n > 0 {
+			pending = append(pending, buf[:n]...)
+			// last lines of the existing content can't be known till its end
+			if search.TailLines == 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			// rest of the content is read without waiting
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		// existing content is read, so the lines after it are searched in full
+		if search.TailLines > 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			search.TailLines = 0
+		}
+
+		// waits for the lines to be appended, unless the context is done
+		select {
+		case <-done:
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package grep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("error: first\ninfo\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make(chan GrepResult)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- Follow(path, GrepOptions{Keyword: "error", Context: ctx, ByteOffset: true}, 10*time.Millisecond, func(res GrepResult) error {
+			results <- res
+			return nil
+		})
+	}()
+
+	expect := func(lines []string, numbers []int, offsets []int64) {
+		t.Helper()
+		select {
+		case res := <-results:
+			if !slices.Equal(res.MatchedLines, lines) || !slices.Equal(res.LineNumbers, numbers) || !slices.Equal(res.ByteOffsets, offsets) {
+				t.Errorf("Expected %q at %v (offsets %v) but got %q at %v (offsets %v)", lines, numbers, offsets, res.MatchedLines, res.LineNumbers, res.ByteOffsets)
+			}
+			if res.Path != path {
+				t.Errorf("Expected %v but got %v", path, res.Path)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %q but got nothing", lines)
+		}
+	}
+	// existing content is searched first
+	expect([]string{"error: first"}, []int{1}, []int64{0})
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	defer file.Close()
+
+	// appended line without a match isn't handled, and a partial line waits for its new line
+	file.WriteString("debug\nerror: sec")
+	time.Sleep(50 * time.Millisecond)
+	file.WriteString("ond\n")
+	expect([]string{"error: second"}, []int{4}, []int64{24})
+
+	cancel()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("Didn't expected an error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected follow to stop once context is cancelled")
+	}
+}
+
+func TestFollowTail(t *testing.T) {
+	// content larger than a single read, so that the tail is of the whole of it
+	path := filepath.Join(t.TempDir(), "app.log")
+	var content []byte
+	for i := 1; i <= 20000; i++ {
+		content = fmt.Appendf(content, "match %d\n", i)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make(chan GrepResult, 1)
+	go Follow(path, GrepOptions{Keyword: "match", Context: ctx, TailLines: 2}, 10*time.Millisecond, func(res GrepResult) error {
+		results <- res
+		cancel()
+		return nil
+	})
+
+	select {
+	case res := <-results:
+		expected := []string{"match 19999", "match 20000"}
+		if !slices.Equal(res.MatchedLines, expected) || !slices.Equal(res.LineNumbers, []int{19999, 20000}) {
+			t.Errorf("Expected %q at %v but got %q at %v", expected, []int{19999, 20000}, res.MatchedLines, res.LineNumbers)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the last lines but got nothing")
+	}
+}
+
+func TestFollowHandleError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("error\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+
+	errHandle := errors.New("sink is closed")
+	err := Follow(path, GrepOptions{Keyword: "error"}, 10*time.Millisecond, func(res GrepResult) error {
+		return errHandle
+	})
+	if !errors.Is(err, errHandle) {
+		t.Errorf("Expected error %v but got %v", errHandle, err)
+	}
+
+	// batches can't be decoded on their own
+	err = Follow(path, GrepOptions{Keyword: "error", Encoding: "UTF-16LE"}, 10*time.Millisecond, func(res GrepResult) error {
+		return nil
+	})
+	if !errors.Is(err, ErrFollowUTF16) {
+		t.Errorf("Expected error %v but got %v", ErrFollowUTF16, err)
+	}
+	bomPath := filepath.Join(t.TempDir(), "bom.log")
+	if err := os.WriteFile(bomPath, []byte("\xff\xfee\x00\n\x00"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	err = Follow(bomPath, GrepOptions{Keyword: "e"}, 10*time.Millisecond, func(res GrepResult) error {
+		return nil
+	})
+	if !errors.Is(err, ErrFollowUTF16) {
+		t.Errorf("Expected error %v but got %v", ErrFollowUTF16, err)
+	}
+
+	err = Follow(filepath.Join(t.TempDir(), "missing.log"), GrepOptions{Keyword: "error"}, 10*time.Millisecond, func(res GrepResult) error {
+		return nil
+	})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected error %v but got %v", os.ErrNotExist, err)
+	}
+}
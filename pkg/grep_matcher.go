@@ -0,0 +1,509 @@
+package grep
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type matcher struct {
+	keyword string
+	ignoreCase bool
+	matchStart bool
+	matchEnd bool
+	ascii bool
+	re *regexp.Regexp
+	all []matcher		// matchers for AllKeywords, each of them has to match along with the keyword
+	butNot *matcher		// matcher for ButNot, the line must not match it
+	patterns []matcher		// matchers for Patterns, the line matches if the keyword or any of them does
+	noKeyword bool		// keyword is left out, only the patterns are matched
+	skipBlank bool		// blank lines don't match
+}
+
+// matcher to test lines against the keyword
+// compiles the keyword if regexp was passed
+func newMatcher(options GrepOptions) (matcher, error) {
+	m := matcher{
+		keyword: options.Keyword,
+		ignoreCase: options.IgnoreCase,
+		matchStart: options.MatchStart,
+		matchEnd: options.MatchEnd,
+		ascii: options.ASCII,
+		skipBlank: options.SkipBlank,
+	}
+	for _, keyword := range options.AllKeywords {
+		am, err := newSecondaryMatcher(options, keyword)
+		if err != nil {
+			return matcher{}, err
+		}
+		m.all = append(m.all, am)
+	}
+	if options.ButNot != "" {
+		bm, err := newSecondaryMatcher(options, options.ButNot)
+		if err != nil {
+			return matcher{}, err
+		}
+		m.butNot = &bm
+	}
+	for _, p := range options.Patterns {
+		pm, err := newPatternMatcher(options, p)
+		if err != nil {
+			return matcher{}, err
+		}
+		m.patterns = append(m.patterns, pm)
+	}
+	// singular (or plural) of the keyword is an alternative to it, like the Patterns
+	if options.Plural && !options.Regexp {
+		for _, variant := range pluralVariants(options.Keyword) {
+			pm, err := newPatternMatcher(options, Pattern{Text: variant})
+			if err != nil {
+				return matcher{}, err
+			}
+			m.patterns = append(m.patterns, pm)
+		}
+	}
+	m.noKeyword = options.Keyword == "" && len(options.Patterns) > 0
+	if !options.Regexp {
+		return m, nil
+	}
+
+	expr := options.Keyword
+	if options.MatchStart {
+		expr = "^(?:" + expr + ")"
+	}
+	if options.MatchEnd {
+		expr = "(?:" + expr + ")$"
+	}
+	if options.IgnoreCase {		// (?i) flag folds case the same way as containsFold
+		expr = "(?i)" + expr
+	}
+	if options.Multiline {		// (?s) flag lets . match the new line as well
+		expr = "(?s)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return matcher{}, err
+	}
+	m.re = re
+	return m, nil
+}
+
+// matcher for a keyword other than the main one, like the ones in AllKeywords and ButNot
+// anchors apply only to the main keyword, others can be anywhere in the line
+func newSecondaryMatcher(options GrepOptions, keyword string) (matcher, error) {
+	options.Keyword = keyword
+	options.AllKeywords = nil
+	options.ButNot = ""
+	options.Patterns = nil
+	options.Plural = false
+	options.MatchStart, options.MatchEnd = false, false
+	return newMatcher(options)
+}
+
+// matcher for one of the Patterns, compiled as regexp only if the pattern says so
+// anchors apply to it the same as the main keyword, as it's an alternative to it
+func newPatternMatcher(options GrepOptions, p Pattern) (matcher, error) {
+	options.Keyword = p.Text
+	options.Regexp = p.Regexp
+	options.AllKeywords = nil
+	options.ButNot = ""
+	options.Patterns = nil
+	options.Plural = false
+	return newMatcher(options)
+}
+
+// returns the plural of keyword, or the singular if it looks like a plural, for Plural
+// it's the simple rules of English instead of a real stemmer: apple and apples, box and boxes, city and cities
+// suffix is in upper case for an upper case keyword, so that it matches without IgnoreCase
+func pluralVariants(keyword string) []string {
+	if keyword == "" {
+		return nil
+	}
+	lower := strings.ToLower(keyword)
+	// the rules are for ASCII suffixes, so the keyword is checked as is if lower case changes its length
+	if len(lower) != len(keyword) {
+		lower = keyword
+	}
+	suffix := func(s string) string {
+		if lower != keyword && strings.ToUpper(keyword) == keyword {
+			return strings.ToUpper(s)
+		}
+		return s
+	}
+	sibilant := func(s string) bool {
+		for _, end := range []string{"s", "x", "z", "ch", "sh"} {
+			if strings.HasSuffix(s, end) {
+				return true
+			}
+		}
+		return false
+	}
+	n := len(keyword)
+
+	switch {
+	case n > 3 && strings.HasSuffix(lower, "ies"):
+		return []string{keyword[:n-3] + suffix("y")}
+	case n > 2 && strings.HasSuffix(lower, "es") && sibilant(lower[:n-2]):
+		return []string{keyword[:n-2]}
+	case n > 1 && strings.HasSuffix(lower, "s") && !strings.HasSuffix(lower, "ss"):
+		return []string{keyword[:n-1]}
+	case n > 1 && strings.HasSuffix(lower, "y") && !strings.ContainsRune("aeiou", rune(lower[n-2])):
+		return []string{keyword[:n-1] + suffix("ies")}
+	case sibilant(lower):
+		return []string{keyword + suffix("es")}
+	}
+	return []string{keyword + suffix("s")}
+}
+
+// checks if line matches the keyword or any of the Patterns, and each of AllKeywords if passed
+// line matching ButNot doesn't match even if it has all the keywords
+// blank (white space only) line doesn't match if skipBlank is set
+func(m matcher) match(line string) bool {
+	if m.skipBlank && strings.TrimSpace(line) == "" {
+		return false
+	}
+	if !m.matchAny(line) {
+		return false
+	}
+	for _, am := range m.all {
+		if !am.matchKeyword(line) {
+			return false
+		}
+	}
+	return m.butNot == nil || !m.butNot.matchKeyword(line)
+}
+
+// checks if line matches the keyword or any of the Patterns
+func(m matcher) matchAny(line string) bool {
+	if !m.noKeyword && m.matchKeyword(line) {
+		return true
+	}
+	for _, pm := range m.patterns {
+		if pm.matchKeyword(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// checks if line matches the keyword alone
+func(m matcher) matchKeyword(line string) bool {
+	if m.re != nil {
+		return m.re.MatchString(line)
+	}
+	if m.matchStart || m.matchEnd {
+		_, ok := m.anchored(line)
+		return ok
+	}
+	if m.ignoreCase && m.ascii {
+		return containsFoldASCII(line, m.keyword)
+	}
+	if m.ignoreCase {
+		return containsFold(line, m.keyword)
+	}
+	return strings.Contains(line, m.keyword)
+}
+
+// gets the start and end index of the keyword anchored to the start and (or) end of line
+func(m matcher) anchored(line string) ([]int, bool) {
+	if m.matchStart {
+		size, ok := m.prefix(line)
+		if !ok || (m.matchEnd && size != len(line)) {
+			return nil, false
+		}
+		return []int{0, size}, true
+	}
+	size, ok := m.suffix(line)
+	if !ok {
+		return nil, false
+	}
+	return []int{len(line) - size, len(line)}, true
+}
+
+// gets the start and end index of each non-overlapping match of the keyword or any of the Patterns in line
+func(m matcher) findAll(line string) [][]int {
+	if len(m.patterns) == 0 {
+		return m.findKeyword(line)
+	}
+
+	var locs [][]int
+	if !m.noKeyword {
+		locs = m.findKeyword(line)
+	}
+	for _, pm := range m.patterns {
+		locs = append(locs, pm.findKeyword(line)...)
+	}
+	return mergeLocs(locs)
+}
+
+// sorts the matches of different patterns by start index, and drops the ones overlapping an earlier match
+// longest one is kept of the matches starting at the same index
+func mergeLocs(locs [][]int) [][]int {
+	sort.Slice(locs, func(i, j int) bool {
+		if locs[i][0] != locs[j][0] {
+			return locs[i][0] < locs[j][0]
+		}
+		return locs[i][1] > locs[j][1]
+	})
+
+	merged := locs[:0]
+	end := -1
+	for _, loc := range locs {
+		if loc[0] < end || (len(merged) > 0 && loc[0] == merged[len(merged)-1][0]) {
+			continue
+		}
+		merged = append(merged, loc)
+		end = loc[1]
+	}
+	return merged
+}
+
+// gets the start and end index of each non-overlapping match of the keyword alone in line
+func(m matcher) findKeyword(line string) [][]int {
+	if m.re != nil {
+		return m.re.FindAllStringIndex(line, -1)
+	}
+
+	// anchored keyword can only match once
+	if m.matchStart || m.matchEnd {
+		if loc, ok := m.anchored(line); ok {
+			return [][]int{loc}
+		}
+		return nil
+	}
+
+	// empty keyword matches every line once
+	if m.keyword == "" {
+		return [][]int{{0, 0}}
+	}
+
+	var locs [][]int
+	for i := 0; i < len(line); {
+		size, ok := m.prefix(line[i:])
+		if ok {
+			locs = append(locs, []int{i, i + size})
+			i += size
+			continue
+		}
+		// bytes of a multi-byte rune can't start a match in ASCII, so stepping a byte is same as a rune
+		if m.ascii {
+			i++
+			continue
+		}
+		_, size = utf8.DecodeRuneInString(line[i:])
+		i += size
+	}
+	return locs
+}
+
+// replaces each match in line with repl
+// in regexp mode, repl can refer to the groups like $1, and is inserted as is otherwise
+// with Patterns, repl is inserted as is for every match as they don't share the groups
+func(m matcher) replaceAll(line, repl string) string {
+	if m.re != nil && len(m.patterns) == 0 {
+		return m.re.ReplaceAllString(line, repl)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range m.findAll(line) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		b.WriteString(line[last:loc[0]])
+		b.WriteString(repl)
+		last = loc[1]
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
+
+// checks if s starts with the keyword, returns length of the matched part of s
+func(m matcher) prefix(s string) (int, bool) {
+	if m.ignoreCase && m.ascii {
+		return prefixFoldASCII(s, m.keyword)
+	}
+	if m.ignoreCase {
+		return prefixFold(s, m.keyword)
+	}
+	if strings.HasPrefix(s, m.keyword) {
+		return len(m.keyword), true
+	}
+	return 0, false
+}
+
+// checks if s ends with the keyword, returns length of the matched part of s
+func(m matcher) suffix(s string) (int, bool) {
+	if m.ignoreCase && m.ascii {
+		return suffixFoldASCII(s, m.keyword)
+	}
+	if m.ignoreCase {
+		return suffixFold(s, m.keyword)
+	}
+	if strings.HasSuffix(s, m.keyword) {
+		return len(m.keyword), true
+	}
+	return 0, false
+}
+
+// unicode aware case-insensitive substring search
+// uses simple case folding (like strings.EqualFold), so it also matches
+// runes that strings.ToLower doesn't map to each other (eg: Σ, σ and ς)
+func containsFold(s, substr string) bool {
+	if substr == "" {
+		return true
+	}
+	first := rune(substr[0])
+	for i := 0; i < len(s); {
+		// quick rejection of ASCII bytes which can't start the match, without decoding the rune
+		if c := rune(s[i]); c < utf8.RuneSelf && first < utf8.RuneSelf && toLowerASCII(c) != toLowerASCII(first) {
+			i++
+			continue
+		}
+		if _, ok := prefixFold(s[i:], substr); ok {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return false
+}
+
+// checks if s ends with suffix under simple case folding, same as prefixFold from the end
+func suffixFold(s, suffix string) (int, bool) {
+	n := 0
+	for suffix != "" {
+		if n == len(s) {
+			return 0, false
+		}
+		sr, sSize := utf8.DecodeLastRuneInString(s[:len(s)-n])
+		sfr, sfSize := utf8.DecodeLastRuneInString(suffix)
+		if !equalFoldRune(sr, sfr) {
+			return 0, false
+		}
+		n += sSize
+		suffix = suffix[:len(suffix)-sfSize]
+	}
+	return n, true
+}
+
+// checks if s starts with prefix under simple case folding
+// returns the length in bytes of the matched part of s, which may differ from len(prefix)
+func prefixFold(s, prefix string) (int, bool) {
+	n := 0
+	for prefix != "" {
+		if n == len(s) {
+			return 0, false
+		}
+		sr, sSize := utf8.DecodeRuneInString(s[n:])
+		pr, pSize := utf8.DecodeRuneInString(prefix)
+		if !equalFoldRune(sr, pr) {
+			return 0, false
+		}
+		n += sSize
+		prefix = prefix[pSize:]
+	}
+	return n, true
+}
+
+// checks if two runes are equal under simple case folding
+func equalFoldRune(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	// fast path, ASCII letters only fold between upper and lower case
+	// non ASCII runes like the Kelvin sign can still fold to an ASCII one, so both have to be ASCII
+	if a < utf8.RuneSelf && b < utf8.RuneSelf {
+		return toLowerASCII(a) == toLowerASCII(b)
+	}
+	// walks the fold orbit of a, looking for b
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
+
+// ASCII only version of containsFold, compares the bytes without decoding the runes
+// non ASCII bytes are compared as is, so they match only the same bytes
+func containsFoldASCII(s, substr string) bool {
+	if substr == "" {
+		return true
+	}
+	// finds the next byte which can start the match, in both cases, before comparing the rest
+	lower, upper := lowerASCII(substr[0]), upperASCII(substr[0])
+	for i := 0; i+len(substr) <= len(s); i++ {
+		j := indexEither(s[i:len(s)-len(substr)+1], lower, upper)
+		if j < 0 {
+			return false
+		}
+		i += j
+		if equalFoldASCII(s[i+1:i+len(substr)], substr[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// index of the first byte in s which is either a or b
+func indexEither(s string, a, b byte) int {
+	if a == b {
+		return strings.IndexByte(s, a)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == a || s[i] == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// ASCII only version of prefixFold, the matched part is always as long as prefix
+func prefixFoldASCII(s, prefix string) (int, bool) {
+	if len(s) < len(prefix) || !equalFoldASCII(s[:len(prefix)], prefix) {
+		return 0, false
+	}
+	return len(prefix), true
+}
+
+// ASCII only version of suffixFold
+func suffixFoldASCII(s, suffix string) (int, bool) {
+	if len(s) < len(suffix) || !equalFoldASCII(s[len(s)-len(suffix):], suffix) {
+		return 0, false
+	}
+	return len(suffix), true
+}
+
+// checks if a and b of same length are equal with ASCII letters folded
+func equalFoldASCII(a, b string) bool {
+	for i := 0; i < len(a); i++ {
+		if a[i] != b[i] && lowerASCII(a[i]) != lowerASCII(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func upperASCII(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+func toLowerASCII(r rune) rune {
+	if 'A' <= r && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+	return r
+}
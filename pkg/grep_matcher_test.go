@@ -0,0 +1,464 @@
+package grep
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMatcherFindAll(t *testing.T) {
+	testCases := []struct {
+		name       string
+		keyword    string
+		ignoreCase bool
+		regexp     bool
+		ascii      bool
+		line       string
+		expected   []string
+	}{
+		{
+			name:     "literal with multiple occurrences",
+			keyword:  "ab",
+			line:     "ab cab abab",
+			expected: []string{"ab", "ab", "ab", "ab"},
+		},
+		{
+			name:       "literal text sensitive keeps the case of line",
+			keyword:    "ab",
+			ignoreCase: true,
+			line:       "Ab aB",
+			expected:   []string{"Ab", "aB"},
+		},
+		{
+			name:     "regexp",
+			keyword:  "line[0-9]+",
+			regexp:   true,
+			line:     "line1 and line22",
+			expected: []string{"line1", "line22"},
+		},
+		{
+			name:       "regexp text sensitive",
+			keyword:    "match[0-9]",
+			ignoreCase: true,
+			regexp:     true,
+			line:       "MATCH1 match2",
+			expected:   []string{"MATCH1", "match2"},
+		},
+		{
+			name:     "no match",
+			keyword:  "xyz",
+			line:     "nothing here",
+			expected: nil,
+		},
+		{
+			name:       "ASCII text sensitive",
+			keyword:    "ab",
+			ignoreCase: true,
+			ascii:      true,
+			line:       "Ab é aB",
+			expected:   []string{"Ab", "aB"},
+		},
+		{
+			name:       "ASCII doesn't fold non ASCII letters",
+			keyword:    "λογος",
+			ignoreCase: true,
+			ascii:      true,
+			line:       "ΛΟΓΟΣ λογος",
+			expected:   []string{"λογος"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := newMatcher(GrepOptions{Keyword: tc.keyword, IgnoreCase: tc.ignoreCase, Regexp: tc.regexp, ASCII: tc.ascii})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, loc := range m.findAll(tc.line) {
+				got = append(got, tc.line[loc[0]:loc[1]])
+			}
+			if !slices.Equal(got, tc.expected) {
+				t.Errorf("Expected %v but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestMatcherReplaceAll(t *testing.T) {
+	testCases := []struct {
+		name       string
+		keyword    string
+		ignoreCase bool
+		regexp     bool
+		line       string
+		repl       string
+		expected   string
+	}{
+		{
+			name:     "literal",
+			keyword:  "apple",
+			line:     "apple pie and apple juice",
+			repl:     "mango",
+			expected: "mango pie and mango juice",
+		},
+		{
+			name:       "literal text sensitive",
+			keyword:    "apple",
+			ignoreCase: true,
+			line:       "Apple pie and APPLE juice",
+			repl:       "mango",
+			expected:   "mango pie and mango juice",
+		},
+		{
+			name:     "literal doesn't expand groups",
+			keyword:  "apple",
+			line:     "apple pie",
+			repl:     "$1",
+			expected: "$1 pie",
+		},
+		{
+			name:     "regexp with group",
+			keyword:  `line(\d+)`,
+			regexp:   true,
+			line:     "line6 match1",
+			repl:     "row-${1}",
+			expected: "row-6 match1",
+		},
+		{
+			name:     "regexp swapping groups",
+			keyword:  `(\w+)=(\w+)`,
+			regexp:   true,
+			line:     "key=value",
+			repl:     "$2:$1",
+			expected: "value:key",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := newMatcher(GrepOptions{Keyword: tc.keyword, IgnoreCase: tc.ignoreCase, Regexp: tc.regexp})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got := m.replaceAll(tc.line, tc.repl); got != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestMatcherAllKeywords(t *testing.T) {
+	lines := []string{"error: read timeout", "Timeout while connecting, ERROR", "error: file not found", "timeout reached", "no keyword"}
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected []string
+	}{
+		{name: "both keywords in any order", option: GrepOptions{Keyword: "error", AllKeywords: []string{"timeout"}}, expected: []string{"error: read timeout"}},
+		{name: "with ignore case", option: GrepOptions{Keyword: "error", AllKeywords: []string{"timeout"}, IgnoreCase: true}, expected: []string{"error: read timeout", "Timeout while connecting, ERROR"}},
+		{name: "anchor applies only to keyword", option: GrepOptions{Keyword: "error", AllKeywords: []string{"found"}, MatchStart: true}, expected: []string{"error: file not found"}},
+		{name: "with regexp", option: GrepOptions{Keyword: "err(or)?", AllKeywords: []string{"time.*"}, Regexp: true}, expected: []string{"error: read timeout"}},
+		{name: "every keyword is required", option: GrepOptions{Keyword: "error", AllKeywords: []string{"timeout", "read", "file"}}, expected: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := newMatcher(tc.option)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, line := range lines {
+				if m.match(line) {
+					got = append(got, line)
+				}
+			}
+			if !slices.Equal(got, tc.expected) {
+				t.Errorf("Expected %v but got %v", tc.expected, got)
+			}
+		})
+	}
+
+	if _, err := newMatcher(GrepOptions{Keyword: "error", AllKeywords: []string{"time("}, Regexp: true}); err == nil {
+		t.Errorf("Expected an error but didn't got one")
+	}
+}
+
+func TestMatcherButNot(t *testing.T) {
+	lines := []string{"error: known issue", "error: disk full", "ERROR: Known issue", "warning: known issue"}
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected []string
+	}{
+		{name: "excludes the lines with pattern", option: GrepOptions{Keyword: "error", ButNot: "known"}, expected: []string{"error: disk full"}},
+		{name: "with ignore case", option: GrepOptions{Keyword: "error", ButNot: "known", IgnoreCase: true}, expected: []string{"error: disk full"}},
+		{name: "with regexp", option: GrepOptions{Keyword: "^(error|warning)", ButNot: "k.own|full", Regexp: true}, expected: nil},
+		{name: "with all keywords", option: GrepOptions{Keyword: "error", AllKeywords: []string{"issue"}, ButNot: "disk"}, expected: []string{"error: known issue"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := newMatcher(tc.option)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, line := range lines {
+				if m.match(line) {
+					got = append(got, line)
+				}
+			}
+			if !slices.Equal(got, tc.expected) {
+				t.Errorf("Expected %v but got %v", tc.expected, got)
+			}
+		})
+	}
+
+	if _, err := newMatcher(GrepOptions{Keyword: "error", ButNot: "known(", Regexp: true}); err == nil {
+		t.Errorf("Expected an error but didn't got one")
+	}
+}
+
+func TestNewMatcherInvalidRegexp(t *testing.T) {
+	_, err := newMatcher(GrepOptions{Keyword: "line(", Regexp: true})
+	if err == nil {
+		t.Errorf("Expected an error but didn't got one")
+	}
+}
+
+func TestContainsFoldASCII(t *testing.T) {
+	testCases := []struct {
+		name     string
+		s        string
+		substr   string
+		expected bool
+	}{
+		{name: "different case", s: "some MaTcH here", substr: "match", expected: true},
+		{name: "without match", s: "some line", substr: "match", expected: false},
+		{name: "non letters", s: "a[b]", substr: "{B}", expected: false},
+		{name: "Kelvin sign doesn't fold to k", s: "\u212a", substr: "k", expected: false},
+		{name: "non ASCII bytes as is", s: "café", substr: "FÉ", expected: false},
+		{name: "empty substr", s: "line", substr: "", expected: true},
+		{name: "substr longer than s", s: "ma", substr: "match", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := containsFoldASCII(tc.s, tc.substr)
+			if got != tc.expected {
+				t.Errorf("Expected %v but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestContainsFold(t *testing.T) {
+	testCases := []struct {
+		name     string
+		s        string
+		substr   string
+		expected bool
+	}{
+		{name: "ASCII with different case", s: "some MaTcH here", substr: "match", expected: true},
+		{name: "ASCII without match", s: "some line", substr: "match", expected: false},
+		{name: "ASCII non letters", s: "a[b]", substr: "{B}", expected: false},
+		{name: "Kelvin sign folds to k", s: "\u212a", substr: "k", expected: true},
+		{name: "sigma forms", s: "ΟΔΟΣ", substr: "οδος", expected: true},
+		{name: "empty substr", s: "line", substr: "", expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := containsFold(tc.s, tc.substr)
+			if got != tc.expected {
+				t.Errorf("Expected %v but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+// compares the lowercasing of each line (as it was done before) with containsFold on a large input
+func BenchmarkIgnoreCaseMatch(b *testing.B) {
+	var buf bytes.Buffer
+	for i := 0; i < 100000; i++ {
+		buf.WriteString("Some Line Without The Keyword\n")
+	}
+	buf.WriteString("line MATCH\n")
+	data := buf.Bytes()
+
+	matchers := []struct {
+		name  string
+		match func(line string) bool
+	}{
+		{name: "ToLower", match: func(line string) bool { return strings.Contains(strings.ToLower(line), "match") }},
+		{name: "containsFold", match: func(line string) bool { return containsFold(line, "match") }},
+	}
+
+	for _, m := range matchers {
+		b.Run(m.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				scanner := bufio.NewScanner(bytes.NewReader(data))
+				for scanner.Scan() {
+					m.match(scanner.Text())
+				}
+			}
+		})
+	}
+}
+
+// compares the unicode folding with the ASCII one of ASCII option on a large ASCII input
+func BenchmarkIgnoreCaseASCII(b *testing.B) {
+	var buf bytes.Buffer
+	for i := 0; i < 100000; i++ {
+		buf.WriteString("Some Line Without The Keyword\n")
+	}
+	buf.WriteString("line MATCH\n")
+	data := buf.Bytes()
+
+	for _, ascii := range []bool{false, true} {
+		b.Run(fmt.Sprintf("ascii=%v", ascii), func(b *testing.B) {
+			option := GrepOptions{Keyword: "match", IgnoreCase: true, ASCII: ascii}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				searchString(bytes.NewReader(data), option)
+			}
+		})
+	}
+}
+
+func TestMatcherPatterns(t *testing.T) {
+	line := "a.b timeout axb timed out"
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected []string
+	}{
+		{name: "literal and regexp", option: GrepOptions{Keyword: "", Patterns: []Pattern{{Text: "a.b"}, {Text: "time(out|d out)", Regexp: true}}}, expected: []string{"a.b", "timeout", "timed out"}},
+		{name: "along with keyword", option: GrepOptions{Keyword: "axb", Patterns: []Pattern{{Text: "a.b"}}}, expected: []string{"a.b", "axb"}},
+		{name: "regexp keyword with literal pattern", option: GrepOptions{Keyword: "a.b", Regexp: true, Patterns: []Pattern{{Text: "timeout"}}}, expected: []string{"a.b", "timeout", "axb"}},
+		{name: "overlapping matches", option: GrepOptions{Keyword: "time", Patterns: []Pattern{{Text: "timeout"}, {Text: "meo"}}}, expected: []string{"timeout", "time"}},
+		{name: "with ignore case", option: GrepOptions{Keyword: "", IgnoreCase: true, Patterns: []Pattern{{Text: "A.B"}, {Text: "AXB", Regexp: true}}}, expected: []string{"a.b", "axb"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := newMatcher(tc.option)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !m.match(line) {
+				t.Fatalf("Expected %q to match", line)
+			}
+
+			var got []string
+			for _, loc := range m.findAll(line) {
+				got = append(got, line[loc[0]:loc[1]])
+			}
+			if !slices.Equal(got, tc.expected) {
+				t.Errorf("Expected %v but got %v", tc.expected, got)
+			}
+		})
+	}
+
+	m, err := newMatcher(GrepOptions{Keyword: "", Patterns: []Pattern{{Text: "a.b"}, {Text: "x+y", Regexp: true}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.match("axb") {
+		t.Errorf("Expected %q to not match", "axb")
+	}
+	if got := m.replaceAll("a.b xxy", "-"); got != "- -" {
+		t.Errorf("Expected %q but got %q", "- -", got)
+	}
+
+	if _, err := newMatcher(GrepOptions{Keyword: "error", Patterns: []Pattern{{Text: "x(", Regexp: true}}}); err == nil {
+		t.Errorf("Expected an error but didn't got one")
+	}
+}
+
+func TestPluralVariants(t *testing.T) {
+	testCases := []struct {
+		keyword  string
+		expected []string
+	}{
+		{keyword: "apple", expected: []string{"apples"}},
+		{keyword: "apples", expected: []string{"apple"}},
+		{keyword: "apply", expected: []string{"applies"}},
+		{keyword: "applies", expected: []string{"apply"}},
+		{keyword: "day", expected: []string{"days"}},
+		{keyword: "box", expected: []string{"boxes"}},
+		{keyword: "boxes", expected: []string{"box"}},
+		{keyword: "glass", expected: []string{"glasses"}},
+		{keyword: "glasses", expected: []string{"glass"}},
+		{keyword: "branch", expected: []string{"branches"}},
+		{keyword: "APPLE", expected: []string{"APPLES"}},
+		{keyword: "Apple", expected: []string{"Apples"}},
+		{keyword: "", expected: nil},
+	}
+
+	for _, tc := range testCases {
+		got := pluralVariants(tc.keyword)
+		if !slices.Equal(got, tc.expected) {
+			t.Errorf("Expected %q for %q but got %q", tc.expected, tc.keyword, got)
+		}
+	}
+}
+
+func TestMatcherPlural(t *testing.T) {
+	lines := []string{"an apple a day", "two apples", "it applies here", "apply it", "no fruit"}
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected []string
+	}{
+		{name: "singular", option: GrepOptions{Keyword: "apple", Plural: true}, expected: []string{"an apple a day", "two apples"}},
+		{name: "plural", option: GrepOptions{Keyword: "apples", Plural: true}, expected: []string{"an apple a day", "two apples"}},
+		{name: "plural without the option", option: GrepOptions{Keyword: "apples"}, expected: []string{"two apples"}},
+		{name: "y to ies", option: GrepOptions{Keyword: "applies", Plural: true}, expected: []string{"it applies here", "apply it"}},
+		{name: "with ignore case", option: GrepOptions{Keyword: "APPLES", Plural: true, IgnoreCase: true}, expected: []string{"an apple a day", "two apples"}},
+		{name: "anchored", option: GrepOptions{Keyword: "apple", Plural: true, MatchEnd: true}, expected: []string{"two apples"}},
+		{name: "ignored with regexp", option: GrepOptions{Keyword: "apples?", Plural: true, Regexp: true}, expected: []string{"an apple a day", "two apples"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := newMatcher(tc.option)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var got []string
+			for _, line := range lines {
+				if m.match(line) {
+					got = append(got, line)
+				}
+			}
+			if !slices.Equal(got, tc.expected) {
+				t.Errorf("Expected %q but got %q", tc.expected, got)
+			}
+		})
+	}
+
+	// longer of the overlapping matches is the matched part
+	m, err := newMatcher(GrepOptions{Keyword: "apple", Plural: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	line := "apples and apple"
+	var got []string
+	for _, loc := range m.findAll(line) {
+		got = append(got, line[loc[0]:loc[1]])
+	}
+	if expected := []string{"apples", "apple"}; !slices.Equal(got, expected) {
+		t.Errorf("Expected %q but got %q", expected, got)
+	}
+}
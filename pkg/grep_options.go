@@ -0,0 +1,233 @@
+package grep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	ErrNegativeOption = errors.New("must not be negative")
+	ErrConflictingOptions = errors.New("can't be passed together")
+	ErrInvalidSortBy = errors.New("invalid sort key")
+	ErrInvalidEncodingErrorMode = errors.New("invalid encoding error mode")
+	ErrInvalidLineRange = errors.New("start of line range is after its end")
+)
+
+// Option sets a field of GrepOptions in NewOptions
+type Option func(*GrepOptions)
+
+// NewOptions returns the options for the keyword with the given ones applied, in order
+// options are validated like Validate, so a GrepOptions built by it is never rejected by the search
+func NewOptions(keyword string, opts ...Option) (GrepOptions, error) {
+	option := GrepOptions{Keyword: keyword}
+	for _, opt := range opts {
+		opt(&option)
+	}
+	if err := option.Validate(); err != nil {
+		return GrepOptions{}, err
+	}
+	return option, nil
+}
+
+// Validate checks the options before a search, instead of failing on the first file (or silently ignoring them)
+// keyword is compiled and encoding is looked up, so it costs about as much as a search of an empty file
+func(o GrepOptions) Validate() error {
+	_, err := o.validateMatcher()
+	return err
+}
+
+// same as Validate, but returns the compiled keyword as well, so that NewEngine doesn't compile it again
+func(o GrepOptions) validateMatcher() (matcher, error) {
+	if err := o.validate(); err != nil {
+		return matcher{}, err
+	}
+	m, err := newMatcher(o)
+	if err != nil {
+		return matcher{}, err
+	}
+	if _, err := decodeReader(strings.NewReader(""), o.Encoding); err != nil {
+		return matcher{}, err
+	}
+	return m, nil
+}
+
+// checks the values of options and their combinations, without compiling the keyword, so that it's cheap for each file
+func(o GrepOptions) validate() error {
+	counts := []struct {
+		name string
+		value int
+	}{
+		{"LinesBeforeMatch", o.LinesBeforeMatch},
+		{"LinesAfterMatch", o.LinesAfterMatch},
+		{"MaxMatchesPerLine", o.MaxMatchesPerLine},
+		{"HeadLines", o.HeadLines},
+		{"TailLines", o.TailLines},
+		{"SnippetRadius", o.SnippetRadius},
+		{"FieldNum", o.FieldNum},
+		{"TotalLimit", o.TotalLimit},
+	}
+	for _, count := range counts {
+		if count.value < 0 {
+			return fmt.Errorf("%s %d: %w", count.name, count.value, ErrNegativeOption)
+		}
+	}
+
+	if o.LineRange[0] < 0 || o.LineRange[1] < 0 {
+		return fmt.Errorf("LineRange %d:%d: %w", o.LineRange[0], o.LineRange[1], ErrNegativeOption)
+	}
+	if o.LineRange[1] > 0 && o.LineRange[0] > o.LineRange[1] {
+		return fmt.Errorf("LineRange %d:%d: %w", o.LineRange[0], o.LineRange[1], ErrInvalidLineRange)
+	}
+
+	// stdin is read only if path isn't passed, so it's fine along with path, but it can't be walked
+	if o.Stdin != nil && o.SearchDir {
+		return fmt.Errorf("Stdin and SearchDir: %w", ErrConflictingOptions)
+	}
+	if o.ListFiles && o.NameOnly {
+		return fmt.Errorf("ListFiles and NameOnly: %w", ErrConflictingOptions)
+	}
+	// counts have no lines to save the context of
+	hasContext := o.LinesBeforeMatch > 0 || o.LinesAfterMatch > 0
+	if hasContext && o.LineCount {
+		return fmt.Errorf("LineCount and context lines: %w", ErrConflictingOptions)
+	}
+	if hasContext && o.CountMatches {
+		return fmt.Errorf("CountMatches and context lines: %w", ErrConflictingOptions)
+	}
+	// whole line is the match, so the matched part is the line itself
+	if o.OnlyMatching && o.MatchStart && o.MatchEnd {
+		return fmt.Errorf("OnlyMatching and whole line match: %w", ErrConflictingOptions)
+	}
+
+	switch o.SortBy {
+	case "", SortPath, SortModified, SortCount:
+	default:
+		return fmt.Errorf("%s: %w", o.SortBy, ErrInvalidSortBy)
+	}
+	switch o.EncodingErrorMode {
+	case "", EncodingErrorStrict, EncodingErrorReplace, EncodingErrorSkip:
+	default:
+		return fmt.Errorf("%s: %w", o.EncodingErrorMode, ErrInvalidEncodingErrorMode)
+	}
+	return nil
+}
+
+// WithPath searches the file (or directory with WithRecursive) at path, relative to the root of file system
+func WithPath(path string) Option {
+	return func(o *GrepOptions) {
+		o.Path = path
+		o.OrigPath = path
+	}
+}
+
+// WithStdin searches r instead of a file
+func WithStdin(r io.Reader) Option {
+	return func(o *GrepOptions) {
+		o.Stdin = r
+	}
+}
+
+// WithRecursive searches every file in the directory at path, for GrepR
+func WithRecursive() Option {
+	return func(o *GrepOptions) {
+		o.SearchDir = true
+	}
+}
+
+func WithIgnoreCase() Option {
+	return func(o *GrepOptions) {
+		o.IgnoreCase = true
+	}
+}
+
+func WithRegexp() Option {
+	return func(o *GrepOptions) {
+		o.Regexp = true
+	}
+}
+
+// WithContext saves the lines before and after each matched line, like -B and -A
+func WithContext(before, after int) Option {
+	return func(o *GrepOptions) {
+		o.LinesBeforeMatch = before
+		o.LinesAfterMatch = after
+	}
+}
+
+// WithCancel stops the search once ctx is done, results found till then are returned with its error
+func WithCancel(ctx context.Context) Option {
+	return func(o *GrepOptions) {
+		o.Context = ctx
+	}
+}
+
+func WithLineCount() Option {
+	return func(o *GrepOptions) {
+		o.LineCount = true
+	}
+}
+
+func WithCountMatches() Option {
+	return func(o *GrepOptions) {
+		o.CountMatches = true
+	}
+}
+
+// WithOnlyMatching saves the matched parts of each line, up to max of them, all if it's 0
+func WithOnlyMatching(max int) Option {
+	return func(o *GrepOptions) {
+		o.OnlyMatching = true
+		o.MaxMatchesPerLine = max
+	}
+}
+
+// WithReplace saves the matched lines with each match replaced by replace
+func WithReplace(replace string) Option {
+	return func(o *GrepOptions) {
+		o.Replace = &replace
+	}
+}
+
+func WithMultiline() Option {
+	return func(o *GrepOptions) {
+		o.Multiline = true
+	}
+}
+
+// WithEncoding decodes the input from enc, like "utf-16le" or "latin1"
+func WithEncoding(enc string) Option {
+	return func(o *GrepOptions) {
+		o.Encoding = enc
+	}
+}
+
+// WithIncludeExt searches only the files with the extensions, with or without the dot
+func WithIncludeExt(exts ...string) Option {
+	return func(o *GrepOptions) {
+		o.IncludeExt = append(o.IncludeExt, exts...)
+	}
+}
+
+// WithExcludeExt skips the files with the extensions, with or without the dot
+func WithExcludeExt(exts ...string) Option {
+	return func(o *GrepOptions) {
+		o.ExcludeExt = append(o.ExcludeExt, exts...)
+	}
+}
+
+// WithExcludeDir skips the directories with the names in GrepR, along with the default ones
+func WithExcludeDir(dirs ...string) Option {
+	return func(o *GrepOptions) {
+		o.ExcludeDir = append(o.ExcludeDir, dirs...)
+	}
+}
+
+// WithCache returns the results of unchanged files from cache, instead of searching them again
+func WithCache(cache Cache) Option {
+	return func(o *GrepOptions) {
+		o.Cache = cache
+	}
+}
@@ -0,0 +1,132 @@
+package grep
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNewOptions(t *testing.T) {
+	ctx := context.Background()
+	stdin := strings.NewReader("test")
+	cache := NewLRUCache(1)
+	replace := "x"
+	testCases := []struct {
+		name     string
+		opts     []Option
+		expected GrepOptions
+	}{
+		{name: "no options", opts: nil, expected: GrepOptions{Keyword: "test"}},
+		{name: "path", opts: []Option{WithPath("dir/a.txt")}, expected: GrepOptions{Keyword: "test", Path: "dir/a.txt", OrigPath: "dir/a.txt"}},
+		{name: "stdin", opts: []Option{WithStdin(stdin)}, expected: GrepOptions{Keyword: "test", Stdin: stdin}},
+		{name: "recursive", opts: []Option{WithPath("dir"), WithRecursive()}, expected: GrepOptions{Keyword: "test", Path: "dir", OrigPath: "dir", SearchDir: true}},
+		{name: "ignore case", opts: []Option{WithIgnoreCase()}, expected: GrepOptions{Keyword: "test", IgnoreCase: true}},
+		{name: "regexp", opts: []Option{WithRegexp()}, expected: GrepOptions{Keyword: "test", Regexp: true}},
+		{name: "context", opts: []Option{WithContext(2, 3)}, expected: GrepOptions{Keyword: "test", LinesBeforeMatch: 2, LinesAfterMatch: 3}},
+		{name: "cancel", opts: []Option{WithCancel(ctx)}, expected: GrepOptions{Keyword: "test", Context: ctx}},
+		{name: "line count", opts: []Option{WithLineCount()}, expected: GrepOptions{Keyword: "test", LineCount: true}},
+		{name: "count matches", opts: []Option{WithCountMatches()}, expected: GrepOptions{Keyword: "test", CountMatches: true}},
+		{name: "only matching", opts: []Option{WithOnlyMatching(2)}, expected: GrepOptions{Keyword: "test", OnlyMatching: true, MaxMatchesPerLine: 2}},
+		{name: "replace", opts: []Option{WithReplace("x")}, expected: GrepOptions{Keyword: "test", Replace: &replace}},
+		{name: "multiline", opts: []Option{WithMultiline()}, expected: GrepOptions{Keyword: "test", Multiline: true}},
+		{name: "encoding", opts: []Option{WithEncoding("latin1")}, expected: GrepOptions{Keyword: "test", Encoding: "latin1"}},
+		{name: "extensions", opts: []Option{WithIncludeExt("go"), WithIncludeExt("md"), WithExcludeExt(".txt")}, expected: GrepOptions{Keyword: "test", IncludeExt: []string{"go", "md"}, ExcludeExt: []string{".txt"}}},
+		{name: "excluded directories", opts: []Option{WithExcludeDir("build", "dist")}, expected: GrepOptions{Keyword: "test", ExcludeDir: []string{"build", "dist"}}},
+		{name: "cache", opts: []Option{WithCache(cache)}, expected: GrepOptions{Keyword: "test", Cache: cache}},
+		{name: "later option wins", opts: []Option{WithContext(1, 1), WithContext(0, 4)}, expected: GrepOptions{Keyword: "test", LinesAfterMatch: 4}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NewOptions("test", tc.opts...)
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %+v but got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewOptionsValidation(t *testing.T) {
+	testCases := []struct {
+		name    string
+		keyword string
+		opts    []Option
+		expErr  error
+	}{
+		{name: "negative lines before match", keyword: "test", opts: []Option{WithContext(-1, 2)}, expErr: ErrNegativeOption},
+		{name: "negative lines after match", keyword: "test", opts: []Option{WithContext(2, -1)}, expErr: ErrNegativeOption},
+		{name: "negative max matches", keyword: "test", opts: []Option{WithOnlyMatching(-1)}, expErr: ErrNegativeOption},
+		{name: "stdin with recursive", keyword: "test", opts: []Option{WithStdin(strings.NewReader("")), WithRecursive()}, expErr: ErrConflictingOptions},
+		{name: "invalid encoding", keyword: "test", opts: []Option{WithEncoding("ebcdic")}, expErr: ErrInvalidEncoding},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewOptions(tc.keyword, tc.opts...)
+			if !errors.Is(err, tc.expErr) {
+				t.Errorf("Expected error %v but got %v", tc.expErr, err)
+			}
+		})
+	}
+
+	// error of the keyword is the one of regexp
+	if _, err := NewOptions("(", WithRegexp()); err == nil {
+		t.Errorf("Expected an error for the invalid regexp")
+	}
+
+	err := GrepOptions{Keyword: "test", LinesBeforeMatch: -1}.Validate()
+	if err == nil || err.Error() != "LinesBeforeMatch -1: must not be negative" {
+		t.Errorf("Expected %q but got %v", "LinesBeforeMatch -1: must not be negative", err)
+	}
+	if err := (GrepOptions{Keyword: "test", SortBy: "size"}).Validate(); !errors.Is(err, ErrInvalidSortBy) {
+		t.Errorf("Expected error %v but got %v", ErrInvalidSortBy, err)
+	}
+	if err := (GrepOptions{Keyword: "test", EncodingErrorMode: "ignore"}).Validate(); !errors.Is(err, ErrInvalidEncodingErrorMode) {
+		t.Errorf("Expected error %v but got %v", ErrInvalidEncodingErrorMode, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		option GrepOptions
+		expErr error
+	}{
+		{name: "valid baseline", option: GrepOptions{Keyword: "test", Path: "a.txt", IgnoreCase: true, LinesBeforeMatch: 2, LinesAfterMatch: 2, OnlyMatching: true, MatchStart: true, LineRange: [2]int{3, 0}}, expErr: nil},
+		{name: "line count with context after", option: GrepOptions{Keyword: "test", LineCount: true, LinesAfterMatch: 2}, expErr: ErrConflictingOptions},
+		{name: "count of matches with context before", option: GrepOptions{Keyword: "test", CountMatches: true, LinesBeforeMatch: 1}, expErr: ErrConflictingOptions},
+		{name: "only matching with whole line", option: GrepOptions{Keyword: "test", OnlyMatching: true, MatchStart: true, MatchEnd: true}, expErr: ErrConflictingOptions},
+		{name: "list files with name only", option: GrepOptions{Keyword: "test", SearchDir: true, ListFiles: true, NameOnly: true}, expErr: ErrConflictingOptions},
+		{name: "negative total limit", option: GrepOptions{Keyword: "test", TotalLimit: -1}, expErr: ErrNegativeOption},
+		{name: "negative head", option: GrepOptions{Keyword: "test", HeadLines: -5}, expErr: ErrNegativeOption},
+		{name: "negative line range", option: GrepOptions{Keyword: "test", LineRange: [2]int{-1, 4}}, expErr: ErrNegativeOption},
+		{name: "line range out of order", option: GrepOptions{Keyword: "test", LineRange: [2]int{9, 4}}, expErr: ErrInvalidLineRange},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.option.Validate()
+			if !errors.Is(err, tc.expErr) || (tc.expErr == nil && err != nil) {
+				t.Errorf("Expected error %v but got %v", tc.expErr, err)
+			}
+		})
+	}
+
+	// searches fail with the same error before reading anything
+	testFS := fstest.MapFS{"a.txt": {Data: []byte("test\n")}}
+	option := GrepOptions{Path: "a.txt", Keyword: "test", LineCount: true, LinesAfterMatch: 1}
+	if got := Grep(testFS, option); !errors.Is(got.Error, ErrConflictingOptions) {
+		t.Errorf("Expected error %v but got %v", ErrConflictingOptions, got.Error)
+	}
+	option.Path, option.SearchDir = ".", true
+	results, stats := GrepRStats(testFS, option)
+	if len(results) != 0 || stats.Errors != 1 || stats.FilesScanned != 0 {
+		t.Errorf("Expected only an error without any file scanned but got %v and %+v", results, stats)
+	}
+}
@@ -0,0 +1,132 @@
+package grep
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// size of the byte range scanned by each worker in ParallelFile, a var so that tests can make it small
+var parallelChunkSize int64 = 4 << 20
+
+// checks if the options can be searched in chunks, since each chunk is searched independently
+// context, multiline and short-circuiting need the lines around a chunk, and UTF-16 can't be split at any new line byte
+// chunks are aligned to new lines, so other line delimiters are searched serially
+// line number in the error of strict encoding error mode would be relative to the chunk, so it's searched serially as well
+// groups of Structured aren't merged across chunks, so it's searched serially too, and so are the head, tail and line range of file
+// byte offsets would be relative to the chunk as well
+func canSearchParallel(option GrepOptions) bool {
+	if option.LinesBeforeMatch > 0 || option.LinesAfterMatch > 0 || option.Multiline || option.FilesWithMatches || lineDelim(option) != '\n' || option.EncodingErrorMode == EncodingErrorStrict || option.Structured || option.HeadLines > 0 || option.TailLines > 0 || option.LineRange != [2]int{} || option.ByteOffset {
+		return false
+	}
+	enc := strings.ToLower(option.Encoding)
+	return enc != "utf-16le" && enc != "utf-16be"
+}
+
+// greps the file in byte ranges aligned to new lines, each range is searched by its own worker
+// line numbers of each range are offset by the lines in the ranges before it, so the result is same as the serial one
+// falls back to the serial search if the file starts with UTF-16 BOM
+func grepParallel(r io.ReaderAt, size int64, name string, m matcher, option GrepOptions) GrepResult {
+	var bom [2]byte
+	if n, _ := r.ReadAt(bom[:], 0); n == 2 && (bom == [2]byte{0xFF, 0xFE} || bom == [2]byte{0xFE, 0xFF}) {
+		return grepReader(io.NewSectionReader(r, 0, size), name, m, option)
+	}
+
+	offsets, err := chunkOffsets(r, size, parallelChunkSize)
+	if err != nil {
+		return GrepResult{Error: err}
+	}
+
+	// each worker saves its result at the index of its chunk, so merging is in the order of the file
+	results := make([]GrepResult, len(offsets)-1)
+	lines := make([]int, len(offsets)-1)
+	bytesRead := make([]int64, len(offsets)-1)
+	errs := make([]error, len(offsets)-1)
+	var wg sync.WaitGroup
+	for i := 0; i < len(offsets)-1; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lc := &lineCounter{r: io.NewSectionReader(r, offsets[i], offsets[i+1]-offsets[i])}
+			results[i], errs[i] = searchWith(lc, m, option)
+			lines[i] = lc.lines
+			bytesRead[i] = lc.bytes
+		}(i)
+	}
+	wg.Wait()
+
+	var merged GrepResult
+	var bytesScanned int64
+	lineOffset := 0
+	for i, res := range results {
+		if errs[i] != nil && !isContextError(errs[i]) {
+			return GrepResult{Error: errs[i]}
+		}
+		merged.MatchedLines = append(merged.MatchedLines, res.MatchedLines...)
+		for _, n := range res.LineNumbers {
+			merged.LineNumbers = append(merged.LineNumbers, n+lineOffset)
+		}
+		merged.LineCount += res.LineCount
+		merged.MatchCount += res.MatchCount
+		merged.Binary = merged.Binary || res.Binary
+		lineOffset += lines[i]
+		bytesScanned += bytesRead[i]
+
+		// ranges after the one cut short by the context are dropped, so that the result has no gaps
+		if errs[i] != nil {
+			res := newResult(name, merged, option)
+			res.Error = errs[i]
+			res.BytesScanned = bytesScanned
+			return res
+		}
+	}
+	res := newResult(name, merged, option)
+	res.BytesScanned = bytesScanned
+	return res
+}
+
+// splits the size bytes of r into ranges of about chunkSize bytes, each ending just after a new line (or at the end)
+// returns the start of each range followed by size, a line longer than chunkSize makes its range longer
+func chunkOffsets(r io.ReaderAt, size, chunkSize int64) ([]int64, error) {
+	offsets := []int64{0}
+	buf := make([]byte, 4096)
+	for next := chunkSize; next < size; next += chunkSize {
+		// the range before is extended over a long line
+		if next <= offsets[len(offsets)-1] {
+			continue
+		}
+
+		// finds the first new line from next
+		end := size
+		for pos := next; pos < size; pos += int64(len(buf)) {
+			n, err := r.ReadAt(buf, pos)
+			if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+				end = pos + int64(i) + 1
+				break
+			}
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+		if end >= size {
+			break
+		}
+		offsets = append(offsets, end)
+	}
+	return append(offsets, size), nil
+}
+
+// counts the new lines and bytes read through it
+type lineCounter struct {
+	r io.Reader
+	lines int
+	bytes int64
+}
+
+func(lc *lineCounter) Read(p []byte) (int, error) {
+	n, err := lc.r.Read(p)
+	lc.lines += bytes.Count(p[:n], []byte{'\n'})
+	lc.bytes += int64(n)
+	return n, err
+}
@@ -0,0 +1,126 @@
+package grep
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writes n lines to file in a temp dir, every third line has a match
+func writeLargeFile(t testing.TB, n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if i%3 == 0 {
+			fmt.Fprintf(&b, "line%d has a Test and another test\n", i)
+		} else {
+			fmt.Fprintf(&b, "line%d has nothing\n", i)
+		}
+	}
+	// last line without new line
+	b.WriteString("last test line")
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "large.txt"), []byte(b.String()), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	return dir
+}
+
+func TestGrepParallelFile(t *testing.T) {
+	dir := writeLargeFile(t, 1000)
+	fSys := os.DirFS(dir)
+
+	// small chunks, so that the file is split in many ranges
+	defer func(size int64) { parallelChunkSize = size }(parallelChunkSize)
+	parallelChunkSize = 100
+
+	replace := "exam"
+	testCases := []struct {
+		name   string
+		option GrepOptions
+	}{
+		{name: "matched lines", option: GrepOptions{Keyword: "test"}},
+		{name: "ignore case", option: GrepOptions{Keyword: "test", IgnoreCase: true}},
+		{name: "regexp", option: GrepOptions{Keyword: "line[0-9]*0 ", Regexp: true}},
+		{name: "line count", option: GrepOptions{Keyword: "test", LineCount: true}},
+		{name: "count matches", option: GrepOptions{Keyword: "test", CountMatches: true, IgnoreCase: true}},
+		{name: "only matching", option: GrepOptions{Keyword: "test", OnlyMatching: true, IgnoreCase: true}},
+		{name: "replace", option: GrepOptions{Keyword: "test", Replace: &replace}},
+		{name: "without matches", option: GrepOptions{Keyword: "vibgyor"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.option.Path = "large.txt"
+			serial := Grep(fSys, tc.option)
+			tc.option.ParallelFile = true
+			parallel := Grep(fSys, tc.option)
+
+			if parallel.Error != nil {
+				t.Fatalf("Didn't expected an error: %v", parallel.Error)
+			}
+			if !reflect.DeepEqual(parallel, serial) {
+				t.Errorf("Expected %v but got %v", serial, parallel)
+			}
+		})
+	}
+}
+
+func TestGrepRParallelFile(t *testing.T) {
+	dir := writeLargeFile(t, 1000)
+	fSys := os.DirFS(dir)
+	defer func(size int64) { parallelChunkSize = size }(parallelChunkSize)
+	parallelChunkSize = 100
+
+	// option reaches the files of walk, with the same results
+	option := GrepOptions{Path: ".", Keyword: "test", SearchDir: true}
+	serial := GrepR(fSys, option)
+	option.ParallelFile = true
+	parallel := GrepR(fSys, option)
+	if len(serial) != 1 || !reflect.DeepEqual(parallel, serial) {
+		t.Errorf("Expected %v but got %v", serial, parallel)
+	}
+}
+
+func TestChunkOffsets(t *testing.T) {
+	testCases := []struct {
+		name      string
+		content   string
+		chunkSize int64
+		expected  []int64
+	}{
+		{name: "aligned to new lines", content: "ab\ncd\nef\n", chunkSize: 2, expected: []int64{0, 3, 6, 9}},
+		{name: "without new line at the end", content: "ab\ncd\nef", chunkSize: 4, expected: []int64{0, 6, 8}},
+		{name: "line longer than chunk", content: "abcdefgh\nij\n", chunkSize: 2, expected: []int64{0, 9, 12}},
+		{name: "chunk bigger than content", content: "ab\ncd\n", chunkSize: 100, expected: []int64{0, 6}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := chunkOffsets(strings.NewReader(tc.content), int64(len(tc.content)), tc.chunkSize)
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %v but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func BenchmarkGrepParallelFile(b *testing.B) {
+	dir := writeLargeFile(b, 1000000)
+	fSys := os.DirFS(dir)
+
+	for _, parallel := range []bool{false, true} {
+		b.Run(fmt.Sprintf("parallel=%v", parallel), func(b *testing.B) {
+			option := GrepOptions{Path: "large.txt", Keyword: "test", ParallelFile: parallel}
+			for i := 0; i < b.N; i++ {
+				Grep(fSys, option)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package grep
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runs the file read from r through the preprocessor command in option.Pre, the output of command is searched instead of it
+// command is split at spaces without a shell, path of an OS file is passed as the last argument
+// content is passed on stdin as well, for the commands which read it (or if the file isn't an OS file)
+// returned cleanup kills the command if it's still running, so that it's always reaped
+func preprocess(r io.Reader, option GrepOptions) (io.Reader, func(), error) {
+	args := strings.Fields(option.Pre)
+	if len(args) == 0 {
+		return nil, nil, ErrEmptyPre
+	}
+	if f, ok := r.(*os.File); ok {
+		args = append(args, f.Name())
+	}
+
+	// errors have the path passed by user, Path is relative to the root of file system
+	name := option.OrigPath
+	if name == "" {
+		name = option.Path
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = r
+	pr := &preReader{cmd: cmd, name: name, pre: option.Pre}
+	cmd.Stderr = &pr.stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %s: %w", name, option.Pre, err)
+	}
+	pr.r = out
+	return pr, pr.close, nil
+}
+
+// reads the output of preprocessor, the failure of command is returned at the end of its output
+type preReader struct {
+	r io.Reader
+	cmd *exec.Cmd
+	name string
+	pre string
+	stderr bytes.Buffer
+	waited bool
+}
+
+func(pr *preReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+	if werr := pr.wait(); werr != nil {
+		return n, werr
+	}
+	return n, io.EOF
+}
+
+// waits for the command once, the error has the stderr of command to tell why it failed
+func(pr *preReader) wait() error {
+	if pr.waited {
+		return nil
+	}
+	pr.waited = true
+	if err := pr.cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(pr.stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s: %w: %s", pr.name, pr.pre, err, msg)
+		}
+		return fmt.Errorf("%s: %s: %w", pr.name, pr.pre, err)
+	}
+	return nil
+}
+
+// kills the command if the output wasn't read till the end, like in FilesWithMatches
+func(pr *preReader) close() {
+	if pr.waited {
+		return
+	}
+	pr.cmd.Process.Kill()
+	pr.wait()
+}
@@ -0,0 +1,86 @@
+package grep
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGrepPre(t *testing.T) {
+	for _, name := range []string{"cat", "sed", "false"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s isn't available: %v", name, err)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("line1\nline2 match\nline3 MATCH"), 0644); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	fSys := os.DirFS(dir)
+
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected []string
+		matched  bool
+	}{
+		{name: "path is passed to command", option: GrepOptions{Path: "file.txt", Keyword: "match", Pre: "cat"}, expected: []string{"line2 match"}, matched: true},
+		{name: "output of command is searched", option: GrepOptions{Path: "file.txt", Keyword: "match", Pre: "sed s/MATCH/match/"}, expected: []string{"line2 match", "line3 match"}, matched: true},
+		{name: "files with matches stops the command", option: GrepOptions{Path: "file.txt", Keyword: "line", Pre: "cat", FilesWithMatches: true}, expected: nil, matched: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Grep(fSys, tc.option)
+			if got.Error != nil {
+				t.Fatalf("Didn't expected an error: %v", got.Error)
+			}
+			if !slices.Equal(got.MatchedLines, tc.expected) || got.Matched != tc.matched {
+				t.Errorf("Expected %v but got %v", tc.expected, got.MatchedLines)
+			}
+		})
+	}
+
+	// content is passed on stdin for the files which aren't OS files
+	testFS := fstest.MapFS{"file.txt": &fstest.MapFile{Data: []byte("line1\nline2 MATCH"), Mode: 0644}}
+	got := Grep(testFS, GrepOptions{Path: "file.txt", Keyword: "match", Pre: "sed s/MATCH/match/"})
+	if got.Error != nil || !slices.Equal(got.MatchedLines, []string{"line2 match"}) {
+		t.Errorf("Expected %v but got %v (%v)", []string{"line2 match"}, got.MatchedLines, got.Error)
+	}
+
+	// failure of command is an error of the file
+	got = Grep(fSys, GrepOptions{Path: "file.txt", Keyword: "match", Pre: "false"})
+	var exitErr *exec.ExitError
+	if !errors.As(got.Error, &exitErr) || !strings.HasPrefix(got.Error.Error(), "file.txt: false: ") {
+		t.Errorf("Expected exit error of command but got %v", got.Error)
+	}
+	// path passed by user is in the error, instead of the one relative to the root
+	got = Grep(fSys, GrepOptions{Path: "file.txt", OrigPath: "../data/file.txt", Keyword: "match", Pre: "false"})
+	if !strings.HasPrefix(got.Error.Error(), "../data/file.txt: false: ") {
+		t.Errorf("Expected error of %q but got %v", "../data/file.txt", got.Error)
+	}
+	events, wait := GrepREvents(os.DirFS(filepath.Dir(dir)), GrepOptions{Path: filepath.Base(dir), OrigPath: "data", SearchDir: true, Keyword: "match", Pre: "false"})
+	for event := range events {
+		if event.Err == nil || !strings.HasPrefix(event.Err.Error(), "data/file.txt: false: ") {
+			t.Errorf("Expected error of %q but got %v", "data/file.txt", event.Err)
+		}
+	}
+	if stats := wait(); stats.Errors != 1 {
+		t.Errorf("Expected 1 error but got %+v", stats)
+	}
+
+	got = Grep(fSys, GrepOptions{Path: "file.txt", Keyword: "match", Pre: "vibgyor-not-a-command"})
+	if !errors.Is(got.Error, exec.ErrNotFound) {
+		t.Errorf("Expected error %v but got %v", exec.ErrNotFound, got.Error)
+	}
+	got = Grep(fSys, GrepOptions{Path: "file.txt", Keyword: "match", Pre: " "})
+	if !errors.Is(got.Error, ErrEmptyPre) {
+		t.Errorf("Expected error %v but got %v", ErrEmptyPre, got.Error)
+	}
+}
@@ -0,0 +1,69 @@
+package grep
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+)
+
+// GrepTar greps each regular file in the tar archive at option.Path (or stdin), like GrepR does for the files of a directory
+// path of each result is the archive path followed by the member name, eg: "logs.tar:app.log"
+// members are filtered by extension, only the results with matches and errors are returned, in the order of archive
+func GrepTar(fSys fs.FS, option GrepOptions) []GrepResult {
+	m, err := newMatcher(option)
+	if err != nil {
+		return []GrepResult{{Error: err}}
+	}
+
+	r, cleanup, err := getReader(fSys, option)
+	if err != nil {
+		return []GrepResult{{Error: err}}
+	}
+	defer cleanup()
+
+	// archive from stdin has no name, so only the member name is used
+	archive := option.OrigPath
+	if archive == "" {
+		archive = option.Path
+	}
+
+	var results []GrepResult
+	done := contextDone(option)
+	tr := tar.NewReader(r)
+	for {
+		// stops at the member after context is done, results found till then are returned
+		select {
+		case <-done:
+			return results
+		default:
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return results
+		}
+		if err != nil {
+			return append(results, GrepResult{Error: fmt.Errorf("%s: %w", archive, err)})
+		}
+
+		// directories, links and devices have no content to search
+		if !hdr.FileInfo().Mode().IsRegular() || !shouldSearch(path.Base(hdr.Name), option) {
+			continue
+		}
+
+		name := hdr.Name
+		if archive != "" {
+			name = archive + ":" + hdr.Name
+		}
+		result := grepReader(tr, name, m, option)
+		if result.Error != nil && !isContextError(result.Error) {
+			results = append(results, GrepResult{Error: fmt.Errorf("%s: %w", name, result.Error)})
+			continue
+		}
+		if hasResult(result) {
+			results = append(results, result)
+		}
+	}
+}
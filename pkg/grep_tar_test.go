@@ -0,0 +1,102 @@
+package grep
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// builds a tar archive with the members in order, a member ending with "/" is added as a directory
+func buildTar(t *testing.T, members [][2]string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, member := range members {
+		hdr := &tar.Header{Name: member[0], Mode: 0644, Size: int64(len(member[1])), Typeflag: tar.TypeReg}
+		if member[0][len(member[0])-1] == '/' {
+			hdr.Typeflag = tar.TypeDir
+			hdr.Mode = 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+		if _, err := tw.Write([]byte(member[1])); err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGrepTar(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["logs.tar"] = &fstest.MapFile{Data: buildTar(t, [][2]string{
+		{"logs/", ""},
+		{"logs/app.log", "line1\nline2 error\nline3"},
+		{"logs/db.log", "error one\nline2\nerror two"},
+		{"logs/image.png", "error in binary"},
+	}), Mode: 0644}
+	testFS["broken.tar"] = &fstest.MapFile{Data: []byte("not a tar archive"), Mode: 0644}
+
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		paths    []string
+		lines    [][]string
+	}{
+		{
+			name:   "matched lines of each member",
+			option: GrepOptions{Path: "logs.tar", OrigPath: "logs.tar", Keyword: "error", ExcludeExt: []string{"png"}},
+			paths:  []string{"logs.tar:logs/app.log", "logs.tar:logs/db.log"},
+			lines:  [][]string{{"line2 error"}, {"error one", "error two"}},
+		},
+		{
+			name:   "members without matches are dropped",
+			option: GrepOptions{Path: "logs.tar", OrigPath: "logs.tar", Keyword: "two"},
+			paths:  []string{"logs.tar:logs/db.log"},
+			lines:  [][]string{{"error two"}},
+		},
+		{
+			name:   "include extension",
+			option: GrepOptions{Path: "logs.tar", OrigPath: "logs.tar", Keyword: "error", IncludeExt: []string{"png"}},
+			paths:  []string{"logs.tar:logs/image.png"},
+			lines:  [][]string{{"error in binary"}},
+		},
+		{
+			name:   "archive from stdin",
+			option: GrepOptions{Stdin: bytes.NewReader(testFS["logs.tar"].Data), Keyword: "line2"},
+			paths:  []string{"logs/app.log", "logs/db.log"},
+			lines:  [][]string{{"line2 error"}, {"line2"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := GrepTar(testFS, tc.option)
+			if len(got) != len(tc.paths) {
+				t.Fatalf("Expected %d results but got %v", len(tc.paths), got)
+			}
+			for i, res := range got {
+				if res.Error != nil {
+					t.Fatalf("Didn't expected an error: %v", res.Error)
+				}
+				if res.Path != tc.paths[i] || !slices.Equal(res.MatchedLines, tc.lines[i]) {
+					t.Errorf("Expected %s with %v but got %s with %v", tc.paths[i], tc.lines[i], res.Path, res.MatchedLines)
+				}
+			}
+		})
+	}
+
+	// errors are returned as results
+	if got := GrepTar(testFS, GrepOptions{Path: "missing.tar", OrigPath: "missing.tar", Keyword: "error"}); len(got) != 1 || !errors.Is(got[0].Error, fs.ErrNotExist) {
+		t.Errorf("Expected error %v but got %v", fs.ErrNotExist, got)
+	}
+	if got := GrepTar(testFS, GrepOptions{Path: "broken.tar", OrigPath: "broken.tar", Keyword: "error"}); len(got) != 1 || got[0].Error == nil {
+		t.Errorf("Expected an error but got %v", got)
+	}
+}
@@ -2,11 +2,20 @@ package grep
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
+	"maps"
+	"runtime"
 	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"testing/fstest"
+	"time"
+	"unicode/utf16"
 )
 
 func TestSearchString(t *testing.T) {
@@ -28,6 +37,22 @@ func TestSearchString(t *testing.T) {
 		Data: []byte("line1\nline2\nline3\nline4\nline5\nline6 match1\nline7 match2\nline8\nline9\nline10"), 
 		Mode: 0755,
 	}
+	testFS["file5.txt"] = &fstest.MapFile{
+		Data: []byte("ΛΟΓΟΣ\nλογος\nkinetic\nKINETIC\nmiſſion\nMISSION"), 
+		Mode: 0755,
+	}
+	testFS["file6.txt"] = &fstest.MapFile{
+		Data: []byte("match match match\nno hit\nMatch"), 
+		Mode: 0755,
+	}
+	testFS["file7.txt"] = &fstest.MapFile{
+		Data: utf16LE("\ufeffline1\r\nline2 match\r\nline3"), 
+		Mode: 0755,
+	}
+	testFS["file8.txt"] = &fstest.MapFile{
+		Data: []byte("caf\xe9 match\nno hit"), 
+		Mode: 0755,
+	}
 	testFS["testDir"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
 
 	testCases := []struct {
@@ -39,6 +64,14 @@ func TestSearchString(t *testing.T) {
 		linesBeforeMatch int
 		linesAfterMatch  int
 		lineCount        bool
+		countMatches     bool
+		onlyMatching     bool
+		regexp           bool
+		encoding         string
+		multiline        bool
+		replace          *string
+		matchStart       bool
+		matchEnd         bool
 		result           GrepResult
 		expErr           error
 	}{
@@ -73,7 +106,15 @@ func TestSearchString(t *testing.T) {
 			keyword:          "match",
 			ignoreCase:       false,
 			linesBeforeMatch: 2,
-			result:           GrepResult{MatchedLines: []string{"line4", "line5", "line6 match1", "line5", "line6 match1", "line7 match2"}},
+			result:           GrepResult{MatchedLines: []string{"line4", "line5", "line6 match1", "line7 match2"}, LineNumbers: []int{4, 5, 6, 7}},
+			expErr:           nil,
+		},
+		{
+			name:             "greps a multi-line file lines with lines before three clustered matches",
+			stdin:            []byte("line1\nline2 match1\nline3\nline4 match2\nline5 match3\nline6"),
+			keyword:          "match",
+			linesBeforeMatch: 2,
+			result:           GrepResult{MatchedLines: []string{"line1", "line2 match1", "line3", "line4 match2", "line5 match3"}, LineNumbers: []int{1, 2, 3, 4, 5}},
 			expErr:           nil,
 		},
 		{
@@ -82,7 +123,15 @@ func TestSearchString(t *testing.T) {
 			keyword:          "match",
 			ignoreCase:       false,
 			linesAfterMatch:  1,
-			result:           GrepResult{MatchedLines: []string{"line6 match1", "line7 match2", "line7 match2", "line8"}},
+			result:           GrepResult{MatchedLines: []string{"line6 match1", "line7 match2", "line8"}, LineNumbers: []int{6, 7, 8}},
+			expErr:           nil,
+		},
+		{
+			name:             "greps a multi-line file lines with lines after two matches one line apart",
+			stdin:            []byte("line1 match1\nline2\nline3 match2\nline4\nline5\nline6"),
+			keyword:          "match",
+			linesAfterMatch:  2,
+			result:           GrepResult{MatchedLines: []string{"line1 match1", "line2", "line3 match2", "line4", "line5"}, LineNumbers: []int{1, 2, 3, 4, 5}},
 			expErr:           nil,
 		},
 		{
@@ -103,6 +152,237 @@ func TestSearchString(t *testing.T) {
 			result:     GrepResult{LineCount: 2},
 			expErr: nil,
 		},
+		{
+			name:       "greps a multi-line file text sensitive with greek final sigma",
+			fileName:   "file5.txt",
+			keyword:    "λογοσ",
+			ignoreCase: true,
+			result:     GrepResult{MatchedLines: []string{"ΛΟΓΟΣ", "λογος"}},
+			expErr:     nil,
+		},
+		{
+			name:       "greps a multi-line file text sensitive with kelvin sign",
+			fileName:   "file5.txt",
+			keyword:    "\u212Ainetic",
+			ignoreCase: true,
+			result:     GrepResult{MatchedLines: []string{"kinetic", "KINETIC"}},
+			expErr:     nil,
+		},
+		{
+			name:       "greps a multi-line file text sensitive with long s",
+			fileName:   "file5.txt",
+			keyword:    "mission",
+			ignoreCase: true,
+			result:     GrepResult{MatchedLines: []string{"miſſion", "MISSION"}},
+			expErr:     nil,
+		},
+		{
+			name:             "greps a multi-line file with line numbers of context",
+			fileName:         "file3.txt",
+			keyword:          "match",
+			linesBeforeMatch: 2,
+			linesAfterMatch:  1,
+			result:           GrepResult{
+				MatchedLines: []string{"line4", "line5", "line6 match1", "line7"},
+				LineNumbers:  []int{4, 5, 6, 7},
+			},
+			expErr:           nil,
+		},
+		{
+			name:         "greps a multi-line file with count matches",
+			fileName:     "file6.txt",
+			keyword:      "match",
+			countMatches: true,
+			result:       GrepResult{MatchCount: 3},
+			expErr:       nil,
+		},
+		{
+			name:         "greps a multi-line file with count matches text sensitive",
+			fileName:     "file6.txt",
+			keyword:      "match",
+			ignoreCase:   true,
+			countMatches: true,
+			result:       GrepResult{MatchCount: 4},
+			expErr:       nil,
+		},
+		{
+			name:         "greps a multi-line file with only matching",
+			fileName:     "file6.txt",
+			keyword:      "match",
+			ignoreCase:   true,
+			onlyMatching: true,
+			result:       GrepResult{MatchedLines: []string{"match", "match", "match", "Match"}},
+			expErr:       nil,
+		},
+		{
+			name:       "greps a multi-line file with match start",
+			fileName:   "file1.txt",
+			keyword:    "th",
+			matchStart: true,
+			result:     GrepResult{MatchedLines: []string{"this"}, LineNumbers: []int{1}},
+		},
+		{
+			name:     "greps a multi-line file with match end",
+			fileName: "file1.txt",
+			keyword:  "s",
+			matchEnd: true,
+			result:   GrepResult{MatchedLines: []string{"this", "is", "Is"}, LineNumbers: []int{1, 2, 5}},
+		},
+		{
+			name:       "greps a multi-line file with match start and end text sensitive",
+			fileName:   "file1.txt",
+			keyword:    "IS",
+			ignoreCase: true,
+			matchStart: true,
+			matchEnd:   true,
+			result:     GrepResult{MatchedLines: []string{"is", "Is"}, LineNumbers: []int{2, 5}},
+		},
+		{
+			name:       "greps a multi-line file with match end text sensitive with unicode",
+			fileName:   "file5.txt",
+			keyword:    "ΟΣ",
+			ignoreCase: true,
+			matchEnd:   true,
+			result:     GrepResult{MatchedLines: []string{"ΛΟΓΟΣ", "λογος"}},
+		},
+		{
+			name:         "greps a multi-line file with match start and only matching",
+			fileName:     "file6.txt",
+			keyword:      "match",
+			onlyMatching: true,
+			matchStart:   true,
+			result:       GrepResult{MatchedLines: []string{"match"}},
+		},
+		{
+			name:       "greps a multi-line file with match start and end regexp",
+			fileName:   "file4.txt",
+			keyword:    "line[0-9]+|match2",
+			regexp:     true,
+			matchStart: true,
+			matchEnd:   true,
+			result:     GrepResult{MatchedLines: []string{"line1", "line2", "line3", "line4", "line5", "line8", "line9", "line10"}},
+		},
+		{
+			name:         "greps a multi-line file with only matching and line count",
+			fileName:     "file6.txt",
+			keyword:      "match",
+			ignoreCase:   true,
+			onlyMatching: true,
+			lineCount:    true,
+			result:       GrepResult{LineCount: 4},
+			expErr:       nil,
+		},
+		{
+			name:         "greps stdin with only matching and line count skips empty matches",
+			stdin:        []byte("ab ab ab\nno\nab"),
+			keyword:      "(ab)?",
+			regexp:       true,
+			onlyMatching: true,
+			lineCount:    true,
+			result:       GrepResult{LineCount: 4},
+			expErr:       nil,
+		},
+		{
+			name:         "greps a multi-line file with only matching regexp",
+			fileName:     "file4.txt",
+			keyword:      "match[0-9]",
+			regexp:       true,
+			onlyMatching: true,
+			result:       GrepResult{MatchedLines: []string{"match1", "match2"}},
+			expErr:       nil,
+		},
+		{
+			name:         "greps a multi-line file with only matching ignores context",
+			fileName:     "file3.txt",
+			keyword:      "match",
+			linesBeforeMatch: 2,
+			onlyMatching: true,
+			result:       GrepResult{MatchedLines: []string{"match"}},
+			expErr:       nil,
+		},
+		{
+			name:     "greps a multi-line file with regexp",
+			fileName: "file3.txt",
+			keyword:  "^line[6-7]",
+			regexp:   true,
+			result:   GrepResult{MatchedLines: []string{"line6 match1", "line7"}},
+			expErr:   nil,
+		},
+		{
+			name:      "greps a multi-line file with multiline regexp",
+			fileName:  "file3.txt",
+			keyword:   "match1.line7",
+			regexp:    true,
+			multiline: true,
+			result:    GrepResult{MatchedLines: []string{"match1\nline7"}, LineNumbers: []int{6}},
+			expErr:    nil,
+		},
+		{
+			name:      "greps a multi-line file with multiline regexp text sensitive",
+			fileName:  "file4.txt",
+			keyword:   "LINE6.*?LINE8",
+			ignoreCase: true,
+			regexp:    true,
+			multiline: true,
+			result:    GrepResult{MatchedLines: []string{"line6 match1\nline7 match2\nline8"}, LineNumbers: []int{6}},
+			expErr:    nil,
+		},
+		{
+			name:     "greps a multi-line file with regexp without multiline",
+			fileName: "file3.txt",
+			keyword:  "match1.line7",
+			regexp:   true,
+			result:   GrepResult{},
+			expErr:   nil,
+		},
+		{
+			name:             "greps a multi-line file with replace",
+			fileName:         "file4.txt",
+			keyword:          "match",
+			linesBeforeMatch: 1,
+			replace:          stringPtr("hit"),
+			result:           GrepResult{MatchedLines: []string{"line5", "line6 hit1", "line7 hit2"}},
+			expErr:           nil,
+		},
+		{
+			name:     "greps a multi-line file with replace regexp group",
+			fileName: "file4.txt",
+			keyword:  `line(\d) match(\d)`,
+			regexp:   true,
+			replace:  stringPtr("$2-$1"),
+			result:   GrepResult{MatchedLines: []string{"1-6", "2-7"}},
+			expErr:   nil,
+		},
+		{
+			name:     "greps a utf-16le file with bom",
+			fileName: "file7.txt",
+			keyword:  "match",
+			result:   GrepResult{MatchedLines: []string{"line2 match"}},
+			expErr:   nil,
+		},
+		{
+			name:     "greps a utf-16le file with encoding",
+			fileName: "file7.txt",
+			keyword:  "line",
+			encoding: "utf-16le",
+			result:   GrepResult{MatchedLines: []string{"line1", "line2 match", "line3"}},
+			expErr:   nil,
+		},
+		{
+			name:     "greps a latin1 file with encoding",
+			fileName: "file8.txt",
+			keyword:  "café",
+			encoding: "latin1",
+			result:   GrepResult{MatchedLines: []string{"café match"}},
+			expErr:   nil,
+		},
+		{
+			name:     "greps a file with invalid encoding",
+			fileName: "file8.txt",
+			keyword:  "match",
+			encoding: "ebcdic",
+			expErr:   ErrInvalidEncoding,
+		},
 		{
 			name:    "reads from stdin",
 			stdin:   []byte("this\nis\na\nfile"),
@@ -129,8 +409,8 @@ func TestSearchString(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			options := GrepOptions{Path: tc.fileName, Stdin: bytes.NewReader(tc.stdin), Keyword: tc.keyword, IgnoreCase: tc.ignoreCase, LinesBeforeMatch: tc.linesBeforeMatch, LinesAfterMatch: tc.linesAfterMatch, LineCount: tc.lineCount}
-			got := Grep(testFS, options)
+			options := GrepOptions{Path: tc.fileName, Stdin: bytes.NewReader(tc.stdin), Keyword: tc.keyword, IgnoreCase: tc.ignoreCase, LinesBeforeMatch: tc.linesBeforeMatch, LinesAfterMatch: tc.linesAfterMatch, LineCount: tc.lineCount, CountMatches: tc.countMatches, OnlyMatching: tc.onlyMatching, Regexp: tc.regexp, Encoding: tc.encoding, Multiline: tc.multiline, Replace: tc.replace, MatchStart: tc.matchStart, MatchEnd: tc.matchEnd}
+			got := Grep(permFS{testFS}, options)
 			want := tc.result
 
 			if tc.expErr != nil {
@@ -154,10 +434,20 @@ func TestSearchString(t *testing.T) {
 				t.Errorf("Expected %v but got %v", want.MatchedLines, got.MatchedLines)
 			}
 
+			// checking line numbers, if expected
+			if want.LineNumbers != nil && !slices.Equal(got.LineNumbers, want.LineNumbers) {
+				t.Errorf("Expected line numbers %v but got %v", want.LineNumbers, got.LineNumbers)
+			}
+
 			// checking matched line count
 			if got.LineCount != want.LineCount {
 				t.Errorf("Expected line count %d but got %d", want.LineCount, got.LineCount)
 			}
+
+			// checking match count
+			if got.MatchCount != want.MatchCount {
+				t.Errorf("Expected match count %d but got %d", want.MatchCount, got.MatchCount)
+			}
 		})
 	}
 }
@@ -172,6 +462,7 @@ func TestSearchStringR(t *testing.T) {
 	testFS["testdata/filexyz.txt"] = &fstest.MapFile{Data: []byte("no matches here"), Mode: 0755}
 	testFS["testdata/inner/test1.txt"] = &fstest.MapFile{Data: []byte("dummy file"), Mode: 0755}
 	testFS["testdata/inner/test2.txt"] = &fstest.MapFile{Data: []byte("this file contains a test line"), Mode: 0755}
+	testFS["testdata/.git/config"] = &fstest.MapFile{Data: []byte("test = true"), Mode: 0755}
 
 	testCases := []struct {
 		name       string
@@ -180,6 +471,9 @@ func TestSearchStringR(t *testing.T) {
 		ignoreCase bool
 		linesBeforeMatch int
 		lineCount bool
+		excludeDir []string
+		noDefaultExcludes bool
+		listFiles bool
 		result     []GrepResult
 	}{
 		{
@@ -188,14 +482,14 @@ func TestSearchStringR(t *testing.T) {
 			keyword: "test",
 			ignoreCase: false,
 			result: []GrepResult{
-				{
-					Path:"testdata/test1.txt",
-					MatchedLines: []string{"this is a test file", "one can test a program by running test cases"},
-				},
 				{
 					Path:"testdata/inner/test2.txt",
 					MatchedLines: []string{"this file contains a test line"},
 				},
+				{
+					Path:"testdata/test1.txt",
+					MatchedLines: []string{"this is a test file", "one can test a program by running test cases"},
+				},
 			},
 		},
 		{
@@ -205,18 +499,17 @@ func TestSearchStringR(t *testing.T) {
 			ignoreCase: false,
 			linesBeforeMatch: 1,
 			result: []GrepResult{
+				{
+					Path:"testdata/inner/test2.txt",
+					MatchedLines: []string{"this file contains a test line"},
+				},
 				{
 					Path:"testdata/test1.txt",
 					MatchedLines: []string{
 						"Dummy Line", "this is a test file",
-						"this is a test file",
 						"one can test a program by running test cases",
 					},
 				},
-				{
-					Path:"testdata/inner/test2.txt",
-					MatchedLines: []string{"this file contains a test line"},
-				},
 			},
 		},
 		{
@@ -226,42 +519,1835 @@ func TestSearchStringR(t *testing.T) {
 			ignoreCase: false,
 			lineCount: true,
 			result: []GrepResult{
+				{
+					Path:"testdata/inner/test2.txt", 
+					LineCount: 1,
+				},
 				{
 					Path:"testdata/test1.txt",
 					LineCount: 2,
 				},
+			},
+		},
+		{
+			name: "greps inside a directory with -r with exclude dir option",
+			path: "testdata",
+			keyword: "test",
+			excludeDir: []string{"inner"},
+			result: []GrepResult{
 				{
-					Path:"testdata/inner/test2.txt", 
-					LineCount: 1,
+					Path:"testdata/test1.txt",
+					MatchedLines: []string{"this is a test file", "one can test a program by running test cases"},
 				},
 			},
 		},
+		{
+			name: "greps inside a directory with -r with exclude dir glob option",
+			path: "testdata",
+			keyword: "test",
+			excludeDir: []string{"node_modules", "in*"},
+			result: []GrepResult{
+				{
+					Path:"testdata/test1.txt",
+					MatchedLines: []string{"this is a test file", "one can test a program by running test cases"},
+				},
+			},
+		},
+		{
+			name: "greps inside a directory with -r with exclude dir option matching the root",
+			path: "testdata",
+			keyword: "test",
+			excludeDir: []string{"testdata"},
+			result: []GrepResult{
+				{
+					Path:"testdata/inner/test2.txt",
+					MatchedLines: []string{"this file contains a test line"},
+				},
+				{
+					Path:"testdata/test1.txt",
+					MatchedLines: []string{"this is a test file", "one can test a program by running test cases"},
+				},
+			},
+		},
+		{
+			name: "greps inside a directory with -r with no default excludes option",
+			path: "testdata",
+			keyword: "test",
+			noDefaultExcludes: true,
+			result: []GrepResult{
+				{
+					Path:"testdata/.git/config",
+					MatchedLines: []string{"test = true"},
+				},
+				{
+					Path:"testdata/inner/test2.txt",
+					MatchedLines: []string{"this file contains a test line"},
+				},
+				{
+					Path:"testdata/test1.txt",
+					MatchedLines: []string{"this is a test file", "one can test a program by running test cases"},
+				},
+			},
+		},
+		{
+			name: "greps inside a directory with -r with no default excludes and exclude dir option",
+			path: "testdata",
+			keyword: "test",
+			excludeDir: []string{"inner"},
+			noDefaultExcludes: true,
+			result: []GrepResult{
+				{
+					Path:"testdata/.git/config",
+					MatchedLines: []string{"test = true"},
+				},
+				{
+					Path:"testdata/test1.txt",
+					MatchedLines: []string{"this is a test file", "one can test a program by running test cases"},
+				},
+			},
+		},
+		{
+			name: "lists files inside a directory with -r",
+			path: "testdata",
+			keyword: "vibgyor",
+			listFiles: true,
+			result: []GrepResult{
+				{Path:"testdata/filexyz.txt"},
+				{Path:"testdata/inner/test1.txt"},
+				{Path:"testdata/inner/test2.txt"},
+				{Path:"testdata/test1.txt"},
+			},
+		},
+		{
+			name: "lists files inside a directory with -r with exclude dir option",
+			path: "testdata",
+			excludeDir: []string{"inner"},
+			noDefaultExcludes: true,
+			listFiles: true,
+			result: []GrepResult{
+				{Path:"testdata/.git/config"},
+				{Path:"testdata/filexyz.txt"},
+				{Path:"testdata/test1.txt"},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			options := GrepOptions{Path: tc.path, Keyword: tc.keyword, IgnoreCase: tc.ignoreCase, LinesBeforeMatch: tc.linesBeforeMatch, LineCount: tc.lineCount}
+			options := GrepOptions{Path: tc.path, Keyword: tc.keyword, IgnoreCase: tc.ignoreCase, LinesBeforeMatch: tc.linesBeforeMatch, LineCount: tc.lineCount, ExcludeDir: tc.excludeDir, NoDefaultExcludes: tc.noDefaultExcludes, ListFiles: tc.listFiles}
 			got := GrepR(testFS, options)
 			want := tc.result
 
-			// checks for equality by checking each slice since order is not guaranteed
-			for _, g := range got {
-				matchFlag := false
-				for _, w := range want {
-					if g.Path == w.Path && slices.Equal(g.MatchedLines, w.MatchedLines) && g.LineCount == w.LineCount {
-                        matchFlag = true
-                        break
-                    }
+			if len(got) != len(want) {
+				t.Fatalf("Expected length %d but got %d", len(want), len(got))
+			}
+
+			// checks for equality in order, since results are sorted by path
+			for i := range want {
+				g, w := got[i], want[i]
+				if g.Path != w.Path || !slices.Equal(g.MatchedLines, w.MatchedLines) || g.LineCount != w.LineCount {
+					t.Errorf("Expected %v at index %d but got %v", w, i, g)
 				}
+			}
+		})
+	}
+}
+
+func TestGrepReader(t *testing.T) {
+	r := bytes.NewReader([]byte("line1\nline2 match\nline3 match"))
+	got := GrepReader(r, "network-stream", GrepOptions{Keyword: "match"})
+	if got.Error != nil {
+		t.Fatalf("Didn't expected an error: %v", got.Error)
+	}
+
+	if got.Path != "network-stream" {
+		t.Errorf("Expected path %q but got %q", "network-stream", got.Path)
+	}
+
+	want := []string{"line2 match", "line3 match"}
+	if !slices.Equal(got.MatchedLines, want) {
+		t.Errorf("Expected %v but got %v", want, got.MatchedLines)
+	}
+}
+
+func TestSearchLineDelim(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		option   GrepOptions
+		expected []string
+		lines    []int
+	}{
+		{name: "semicolon", input: "a;match;b", option: GrepOptions{Keyword: "match", LineDelim: ';'}, expected: []string{"match"}, lines: []int{2}},
+		{name: "new line is part of line", input: "a\nmatch;b;match\n", option: GrepOptions{Keyword: "match", LineDelim: ';'}, expected: []string{"a\nmatch", "match\n"}, lines: []int{1, 3}},
+		{name: "carriage return with context", input: "a\rmatch\rb\rc", option: GrepOptions{Keyword: "match", LineDelim: '\r', LinesAfterMatch: 1}, expected: []string{"match", "b"}, lines: []int{2, 3}},
+		{name: "new line by default", input: "a;match\nb", option: GrepOptions{Keyword: "match"}, expected: []string{"a;match"}, lines: []int{1}},
+	}
 
-				if !matchFlag {
-					t.Errorf("Expected %v but got %v", want, got)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := searchString(strings.NewReader(tc.input), tc.option)
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if !slices.Equal(got.MatchedLines, tc.expected) || !slices.Equal(got.LineNumbers, tc.lines) {
+				t.Errorf("Expected %q at %v but got %q at %v", tc.expected, tc.lines, got.MatchedLines, got.LineNumbers)
+			}
+		})
+	}
+}
+
+func TestSearchMaxMatchesPerLine(t *testing.T) {
+	input := strings.Repeat("ab ", 1000) + "\nab ab\nnone"
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected int
+		lines    []int
+	}{
+		{name: "capped per line", option: GrepOptions{Keyword: "ab", OnlyMatching: true, MaxMatchesPerLine: 3}, expected: 5, lines: []int{1, 1, 1, 2, 2}},
+		{name: "empty matches aren't counted", option: GrepOptions{Keyword: "(ab)?", Regexp: true, OnlyMatching: true, MaxMatchesPerLine: 2}, expected: 4, lines: []int{1, 1, 2, 2}},
+		{name: "no cap by default", option: GrepOptions{Keyword: "ab", OnlyMatching: true}, expected: 1002},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := searchString(strings.NewReader(input), tc.option)
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if len(got.MatchedLines) != tc.expected || got.MatchCount != tc.expected {
+				t.Errorf("Expected %d matches but got %d (count %d)", tc.expected, len(got.MatchedLines), got.MatchCount)
+			}
+			if tc.lines != nil && !slices.Equal(got.LineNumbers, tc.lines) {
+				t.Errorf("Expected line numbers %v but got %v", tc.lines, got.LineNumbers)
+			}
+			for _, part := range got.MatchedLines {
+				if part != "ab" {
+					t.Fatalf("Expected only %q but got %q", "ab", part)
 				}
 			}
+		})
+	}
+}
 
-			if len(got) != len(want) {
-				t.Errorf("Expected length %d but got %d", len(want), len(got))
+func TestSearchEncodingErrorMode(t *testing.T) {
+	input := "line1 match\ncaf\xe9 match\nline3\nline4 match"
+	testCases := []struct {
+		name     string
+		mode     string
+		expected []string
+		lines    []int
+		expErr   error
+	}{
+		{name: "as is by default", mode: "", expected: []string{"line1 match", "caf\xe9 match", "line4 match"}, lines: []int{1, 2, 4}},
+		{name: "strict", mode: EncodingErrorStrict, expErr: ErrInvalidUTF8},
+		{name: "replace", mode: EncodingErrorReplace, expected: []string{"line1 match", "caf\ufffd match", "line4 match"}, lines: []int{1, 2, 4}},
+		{name: "skip", mode: EncodingErrorSkip, expected: []string{"line1 match", "line4 match"}, lines: []int{1, 4}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := searchString(strings.NewReader(input), GrepOptions{Keyword: "match", EncodingErrorMode: tc.mode})
+			if !errors.Is(err, tc.expErr) {
+				t.Fatalf("Expected error %v but got %v", tc.expErr, err)
+			}
+			if !slices.Equal(got.MatchedLines, tc.expected) || !slices.Equal(got.LineNumbers, tc.lines) {
+				t.Errorf("Expected %q at %v but got %q at %v", tc.expected, tc.lines, got.MatchedLines, got.LineNumbers)
 			}
 		})
 	}
+
+	// short-circuiting search stops at the invalid line in strict, and ignores it in skip
+	matched, err := hasMatch(strings.NewReader("caf\xe9 match\nmatch"), GrepOptions{Keyword: "match", EncodingErrorMode: EncodingErrorStrict})
+	if !errors.Is(err, ErrInvalidUTF8) || matched {
+		t.Errorf("Expected error %v but got %v", ErrInvalidUTF8, err)
+	}
+	matched, err = hasMatch(strings.NewReader("caf\xe9 match\nline2"), GrepOptions{Keyword: "match", EncodingErrorMode: EncodingErrorSkip})
+	if err != nil || matched {
+		t.Errorf("Expected no match but got %v (%v)", matched, err)
+	}
+}
+
+func TestSearchStructured(t *testing.T) {
+	input := "line1\nline2 match\nline3\nline4\nline5\nline6 match\nline7 match\nline8"
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected []MatchGroup
+	}{
+		{
+			name:   "without context",
+			option: GrepOptions{Keyword: "match", Structured: true},
+			expected: []MatchGroup{
+				{Match: "line2 match", LineNumber: 2},
+				{Match: "line6 match", LineNumber: 6},
+				{Match: "line7 match", LineNumber: 7},
+			},
+		},
+		{
+			name:   "lines before match",
+			option: GrepOptions{Keyword: "match", Structured: true, LinesBeforeMatch: 2},
+			expected: []MatchGroup{
+				{Before: []string{"line1"}, Match: "line2 match", LineNumber: 2},
+				{Before: []string{"line4", "line5"}, Match: "line6 match", LineNumber: 6},
+				{Before: []string{"line5", "line6 match"}, Match: "line7 match", LineNumber: 7},
+			},
+		},
+		{
+			name:   "lines after match",
+			option: GrepOptions{Keyword: "match", Structured: true, LinesAfterMatch: 2},
+			expected: []MatchGroup{
+				{Match: "line2 match", After: []string{"line3", "line4"}, LineNumber: 2},
+				{Match: "line6 match", After: []string{"line7 match", "line8"}, LineNumber: 6},
+				{Match: "line7 match", After: []string{"line8"}, LineNumber: 7},
+			},
+		},
+		{
+			name:   "lines before and after match",
+			option: GrepOptions{Keyword: "match", Structured: true, LinesBeforeMatch: 1, LinesAfterMatch: 1},
+			expected: []MatchGroup{
+				{Before: []string{"line1"}, Match: "line2 match", After: []string{"line3"}, LineNumber: 2},
+				{Before: []string{"line5"}, Match: "line6 match", After: []string{"line7 match"}, LineNumber: 6},
+				{Before: []string{"line6 match"}, Match: "line7 match", After: []string{"line8"}, LineNumber: 7},
+			},
+		},
+		{
+			name:     "flat by default",
+			option:   GrepOptions{Keyword: "match", LinesAfterMatch: 1},
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := searchString(strings.NewReader(input), tc.option)
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if !slices.EqualFunc(got.Groups, tc.expected, func(a, b MatchGroup) bool {
+				return slices.Equal(a.Before, b.Before) && a.Match == b.Match && slices.Equal(a.After, b.After) && a.LineNumber == b.LineNumber
+			}) {
+				t.Errorf("Expected %q but got %q", tc.expected, got.Groups)
+			}
+		})
+	}
+}
+
+func TestGrepRMatchStart(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+	testFS["testdata/file1.txt"] = &fstest.MapFile{Data: []byte("match first\nnot a match"), Mode: 0755}
+
+	results := GrepR(testFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "match", MatchStart: true})
+	if len(results) != 1 || !slices.Equal(results[0].MatchedLines, []string{"match first"}) {
+		t.Errorf("Expected %v but got %v", []string{"match first"}, results)
+	}
+}
+
+func TestGrepRLineDelim(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+	testFS["testdata/file1.txt"] = &fstest.MapFile{Data: []byte("a;match;b"), Mode: 0755}
+
+	results := GrepR(testFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "match", LineDelim: ';'})
+	if len(results) != 1 || !slices.Equal(results[0].MatchedLines, []string{"match"}) {
+		t.Errorf("Expected %v but got %v", []string{"match"}, results)
+	}
+}
+
+// returns one line per read after a pause, like a slow network stream
+type slowReader struct {
+	lines []string
+	pause time.Duration
+}
+
+func(r *slowReader) Read(p []byte) (int, error) {
+	if len(r.lines) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.pause)
+	n := copy(p, r.lines[0])
+	r.lines = r.lines[1:]
+	return n, nil
+}
+
+func TestGrepBytesScanned(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata/file1.txt"] = &fstest.MapFile{Data: []byte("line1\r\nline2 match\nline3"), Mode: 0755}
+	testFS["testdata/file2.txt"] = &fstest.MapFile{Data: []byte("no match here\n"), Mode: 0755}
+	testFS["testdata/file3.txt"] = &fstest.MapFile{Data: []byte("nothing\n"), Mode: 0755}
+
+	testCases := []struct {
+		name   string
+		option GrepOptions
+	}{
+		{name: "matched lines", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "match"}},
+		{name: "line count", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "match", LineCount: true}},
+		{name: "without match", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "vibgyor"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Grep(testFS, tc.option)
+			if want := int64(len(testFS["testdata/file1.txt"].Data)); got.BytesScanned != want {
+				t.Errorf("Expected %d bytes scanned but got %d", want, got.BytesScanned)
+			}
+		})
+	}
+
+	// files without matches are in the total as well
+	_, stats := GrepRStats(testFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "match"})
+	if want := int64(24 + 14 + 8); stats.BytesScanned != want {
+		t.Errorf("Expected %d bytes scanned but got %d", want, stats.BytesScanned)
+	}
+}
+
+func TestGrepSkipBlank(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata/file1.txt"] = &fstest.MapFile{Data: []byte("first\n\n  \t\nsecond line\n\nthird\n"), Mode: 0755}
+
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected []string
+		count    int
+	}{
+		{name: "blank lines match empty keyword by default", option: GrepOptions{Path: "testdata/file1.txt", Keyword: ""}, expected: []string{"first", "", "  \t", "second line", "", "third"}},
+		{name: "blank lines are skipped", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "", SkipBlank: true}, expected: []string{"first", "second line", "third"}},
+		{name: "white space keyword", option: GrepOptions{Path: "testdata/file1.txt", Keyword: " ", SkipBlank: true}, expected: []string{"second line"}},
+		{name: "line count", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "", SkipBlank: true, LineCount: true}, count: 3},
+		{name: "regexp", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "^\\s*$", Regexp: true, SkipBlank: true}, expected: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Grep(testFS, tc.option)
+			if got.Error != nil {
+				t.Fatalf("Didn't expected an error: %v", got.Error)
+			}
+			if !tc.option.LineCount && !slices.Equal(got.MatchedLines, tc.expected) {
+				t.Errorf("Expected %q but got %q", tc.expected, got.MatchedLines)
+			}
+			if tc.option.LineCount && got.LineCount != tc.count {
+				t.Errorf("Expected line count %d but got %d", tc.count, got.LineCount)
+			}
+		})
+	}
+}
+
+func TestGrepHeadLines(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata/file1.txt"] = &fstest.MapFile{Data: []byte("---\ntitle: match\n---\nbody match\nmatch again\n"), Mode: 0755}
+	testFS["testdata/file2.txt"] = &fstest.MapFile{Data: utf16LE("\ufeffline1\r\nline2\r\nline3\r\nline4 match"), Mode: 0755}
+
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected []string
+		lines    []int
+	}{
+		{name: "lines after head aren't searched", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "match", HeadLines: 3}, expected: []string{"title: match"}, lines: []int{2}},
+		{name: "head longer than file", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "match", HeadLines: 10}, expected: []string{"title: match", "body match", "match again"}, lines: []int{2, 4, 5}},
+		{name: "context stops at head", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "title", HeadLines: 3, LinesAfterMatch: 5}, expected: []string{"title: match", "---"}, lines: []int{2, 3}},
+		{name: "decoded lines", option: GrepOptions{Path: "testdata/file2.txt", Keyword: "match", HeadLines: 3}, expected: nil},
+		{name: "parallel file", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "match", HeadLines: 1, ParallelFile: true}, expected: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Grep(testFS, tc.option)
+			if got.Error != nil {
+				t.Fatalf("Didn't expected an error: %v", got.Error)
+			}
+			if !slices.Equal(got.MatchedLines, tc.expected) {
+				t.Errorf("Expected %q but got %q", tc.expected, got.MatchedLines)
+			}
+			if !slices.Equal(got.LineNumbers, tc.lines) {
+				t.Errorf("Expected line numbers %v but got %v", tc.lines, got.LineNumbers)
+			}
+		})
+	}
+
+	matched, err := hasMatch(strings.NewReader("one\ntwo\nmatch\n"), GrepOptions{Keyword: "match", HeadLines: 2})
+	if err != nil {
+		t.Fatalf("Didn't expected an error: %v", err)
+	}
+	if matched {
+		t.Errorf("Expected no match after the head")
+	}
+}
+
+func TestGrepTailLines(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata/file1.txt"] = &fstest.MapFile{Data: []byte("match 1\nline 2\nmatch 3\nline 4\nmatch 5\n"), Mode: 0755}
+	testFS["testdata/file2.txt"] = &fstest.MapFile{Data: []byte("caf\xe9 match\nno hit\nmatch\xe9\nlast"), Mode: 0755}
+
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected []string
+		lines    []int
+	}{
+		{name: "only last lines are searched", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "match", TailLines: 3}, expected: []string{"match 3", "match 5"}, lines: []int{3, 5}},
+		{name: "tail longer than file", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "match", TailLines: 10}, expected: []string{"match 1", "match 3", "match 5"}, lines: []int{1, 3, 5}},
+		{name: "context within tail", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "match 3", TailLines: 3, LinesBeforeMatch: 2, LinesAfterMatch: 1}, expected: []string{"match 3", "line 4"}, lines: []int{3, 4}},
+		{name: "with head", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "match", TailLines: 3, HeadLines: 4}, expected: []string{"match 3"}, lines: []int{3}},
+		{name: "decoded lines", option: GrepOptions{Path: "testdata/file2.txt", Keyword: "match", TailLines: 3, Encoding: "latin1"}, expected: []string{"match\u00e9"}, lines: []int{3}},
+		{name: "parallel file", option: GrepOptions{Path: "testdata/file1.txt", Keyword: "match", TailLines: 1, ParallelFile: true}, expected: []string{"match 5"}, lines: []int{5}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Grep(testFS, tc.option)
+			if got.Error != nil {
+				t.Fatalf("Didn't expected an error: %v", got.Error)
+			}
+			if !slices.Equal(got.MatchedLines, tc.expected) {
+				t.Errorf("Expected %q but got %q", tc.expected, got.MatchedLines)
+			}
+			if !slices.Equal(got.LineNumbers, tc.lines) {
+				t.Errorf("Expected line numbers %v but got %v", tc.lines, got.LineNumbers)
+			}
+		})
+	}
+
+	// line number in the error is the one in file
+	_, err := searchString(strings.NewReader("ok\nbad\xff\nok\n"), GrepOptions{Keyword: "ok", TailLines: 2, EncodingErrorMode: EncodingErrorStrict})
+	if !errors.Is(err, ErrInvalidUTF8) || !strings.Contains(err.Error(), "line 2:") {
+		t.Errorf("Expected %v at line 2 but got %v", ErrInvalidUTF8, err)
+	}
+
+	matched, err := hasMatch(strings.NewReader("match\ntwo\nthree\n"), GrepOptions{Keyword: "match", TailLines: 2})
+	if err != nil {
+		t.Fatalf("Didn't expected an error: %v", err)
+	}
+	if matched {
+		t.Errorf("Expected no match in the tail")
+	}
+}
+
+func TestSearchLineRange(t *testing.T) {
+	input := "match 1\nline 2\nmatch 3\nline 4\nmatch 5\nline 6\n"
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected []string
+		lines    []int
+	}{
+		{name: "out of range match is excluded", option: GrepOptions{Keyword: "match", LineRange: [2]int{2, 4}}, expected: []string{"match 3"}, lines: []int{3}},
+		{name: "range is inclusive", option: GrepOptions{Keyword: "match", LineRange: [2]int{3, 5}}, expected: []string{"match 3", "match 5"}, lines: []int{3, 5}},
+		{name: "open start", option: GrepOptions{Keyword: "match", LineRange: [2]int{0, 2}}, expected: []string{"match 1"}, lines: []int{1}},
+		{name: "open end", option: GrepOptions{Keyword: "match", LineRange: [2]int{4, 0}}, expected: []string{"match 5"}, lines: []int{5}},
+		{name: "context outside range", option: GrepOptions{Keyword: "match", LineRange: [2]int{3, 3}, LinesBeforeMatch: 1, LinesAfterMatch: 1}, expected: []string{"line 2", "match 3", "line 4"}, lines: []int{2, 3, 4}},
+		{name: "every line in range", option: GrepOptions{Keyword: "", LineRange: [2]int{2, 5}}, expected: []string{"line 2", "match 3", "line 4", "match 5"}, lines: []int{2, 3, 4, 5}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := searchString(strings.NewReader(input), tc.option)
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if !slices.Equal(got.MatchedLines, tc.expected) {
+				t.Errorf("Expected %q but got %q", tc.expected, got.MatchedLines)
+			}
+			if !slices.Equal(got.LineNumbers, tc.lines) {
+				t.Errorf("Expected line numbers %v but got %v", tc.lines, got.LineNumbers)
+			}
+		})
+	}
+
+	matched, err := hasMatch(strings.NewReader(input), GrepOptions{Keyword: "match", LineRange: [2]int{6, 0}})
+	if err != nil {
+		t.Fatalf("Didn't expected an error: %v", err)
+	}
+	if matched {
+		t.Errorf("Expected no match in the range")
+	}
+}
+
+func TestSearchReplaceNamedGroups(t *testing.T) {
+	input := "user=alice id=42\nno pairs here\nk=v"
+	testCases := []struct {
+		name     string
+		keyword  string
+		replace  string
+		expected []string
+	}{
+		{name: "named groups", keyword: `(?P<key>\w+)=(?P<val>\w+)`, replace: "${val}:${key}", expected: []string{"alice:user 42:id", "v:k"}},
+		{name: "named and numbered groups", keyword: `(?P<key>\w+)=(\w+)`, replace: "${key}->$2", expected: []string{"user->alice id->42", "k->v"}},
+		{name: "escaped dollar", keyword: `(?P<key>\w+)=(?P<val>\w+)`, replace: "$${key}=${val}", expected: []string{"${key}=alice ${key}=42", "${key}=v"}},
+		{name: "unknown group is empty", keyword: `(?P<key>\w+)=\w+`, replace: "${key}:${missing}", expected: []string{"user: id:", "k:"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := searchString(strings.NewReader(input), GrepOptions{Keyword: tc.keyword, Regexp: true, Replace: stringPtr(tc.replace)})
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if !slices.Equal(got.MatchedLines, tc.expected) {
+				t.Errorf("Expected %q but got %q", tc.expected, got.MatchedLines)
+			}
+		})
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	long := strings.Repeat("x", 100) + " error here " + strings.Repeat("y", 100)
+	testCases := []struct {
+		name     string
+		input    string
+		option   GrepOptions
+		expected []string
+	}{
+		{name: "long line", input: long, option: GrepOptions{Keyword: "error", SnippetRadius: 5}, expected: []string{"...xxxx error here..."}},
+		{name: "match near the start", input: "an error in a long line", option: GrepOptions{Keyword: "error", SnippetRadius: 5}, expected: []string{"an error in a..."}},
+		{name: "match near the end", input: "a long line with error", option: GrepOptions{Keyword: "error", SnippetRadius: 6}, expected: []string{"... with error"}},
+		{name: "each match", input: "err1 ........ err2", option: GrepOptions{Keyword: "err[0-9]", Regexp: true, SnippetRadius: 2}, expected: []string{"err1 ....", ".... err2"}},
+		{name: "rune boundaries", input: "ééééé match ééééé", option: GrepOptions{Keyword: "match", SnippetRadius: 3}, expected: []string{"...éé match éé..."}},
+		{name: "with mark", input: long, option: GrepOptions{Keyword: "error", SnippetRadius: 1, MarkBefore: "[", MarkAfter: "]"}, expected: []string{"... [error] ..."}},
+		{name: "limit per line", input: "a a a", option: GrepOptions{Keyword: "a", SnippetRadius: 1, MaxMatchesPerLine: 2}, expected: []string{"a ...", "... a ..."}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := searchString(strings.NewReader(tc.input), tc.option)
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if !slices.Equal(got.MatchedLines, tc.expected) {
+				t.Errorf("Expected %q but got %q", tc.expected, got.MatchedLines)
+			}
+		})
+	}
+}
+
+func TestSearchField(t *testing.T) {
+	csv := "id,name,city\n1,error,paris\n2,bob,error\n3,errors,\n4\n"
+	testCases := []struct {
+		name     string
+		input    string
+		option   GrepOptions
+		expected []string
+	}{
+		{name: "only the column is matched", input: csv, option: GrepOptions{Keyword: "error", FieldNum: 2, FieldSep: ","}, expected: []string{"1,error,paris", "3,errors,"}},
+		{name: "last column", input: csv, option: GrepOptions{Keyword: "error", FieldNum: 3, FieldSep: ","}, expected: []string{"2,bob,error"}},
+		{name: "anchored to the field", input: csv, option: GrepOptions{Keyword: "error", FieldNum: 2, FieldSep: ",", MatchStart: true, MatchEnd: true}, expected: []string{"1,error,paris"}},
+		{name: "empty field", input: csv, option: GrepOptions{Keyword: "^$", Regexp: true, FieldNum: 3, FieldSep: ","}, expected: []string{"3,errors,"}},
+		{name: "line without the field", input: csv, option: GrepOptions{Keyword: "", FieldNum: 2, FieldSep: ","}, expected: []string{"id,name,city", "1,error,paris", "2,bob,error", "3,errors,"}},
+		{name: "multi-byte separator", input: "a::error\nerror::b\n", option: GrepOptions{Keyword: "error", FieldNum: 2, FieldSep: "::"}, expected: []string{"a::error"}},
+		{name: "white space", input: "  GET  /error 500\nERROR /ok\t200\n", option: GrepOptions{Keyword: "error", FieldNum: 2, IgnoreCase: true}, expected: []string{"  GET  /error 500"}},
+		{name: "matched part", input: csv, option: GrepOptions{Keyword: "error", FieldNum: 3, FieldSep: ",", OnlyMatching: true}, expected: []string{"error"}},
+		{name: "replace in the field", input: "error,error\n", option: GrepOptions{Keyword: "error", FieldNum: 2, FieldSep: ",", Replace: stringPtr("ok")}, expected: []string{"error,ok"}},
+		{name: "mark in the field", input: "error,error\n", option: GrepOptions{Keyword: "error", FieldNum: 2, FieldSep: ",", MarkBefore: "[", MarkAfter: "]"}, expected: []string{"error,[error]"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := searchString(strings.NewReader(tc.input), tc.option)
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if !slices.Equal(got.MatchedLines, tc.expected) {
+				t.Errorf("Expected %q but got %q", tc.expected, got.MatchedLines)
+			}
+		})
+	}
+
+	matched, err := hasMatch(strings.NewReader(csv), GrepOptions{Keyword: "paris", FieldNum: 2, FieldSep: ","})
+	if err != nil {
+		t.Fatalf("Didn't expected an error: %v", err)
+	}
+	if matched {
+		t.Errorf("Expected no match in the field")
+	}
+}
+
+func TestSearchMark(t *testing.T) {
+	input := "foo bar foo\nnone\nfoofoo"
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected []string
+	}{
+		{name: "each match is marked", option: GrepOptions{Keyword: "foo"}, expected: []string{"[[foo]] bar [[foo]]", "[[foo]][[foo]]"}},
+		{name: "regexp", option: GrepOptions{Keyword: "o+ ?", Regexp: true}, expected: []string{"f[[oo ]]bar f[[oo]]", "n[[o]]ne", "f[[oo]]f[[oo]]"}},
+		{name: "empty matches aren't marked", option: GrepOptions{Keyword: "x*", Regexp: true}, expected: []string{"foo bar foo", "none", "foofoo"}},
+		{name: "only matching", option: GrepOptions{Keyword: "bar", OnlyMatching: true}, expected: []string{"[[bar]]"}},
+		{name: "context isn't marked", option: GrepOptions{Keyword: "bar", LinesAfterMatch: 1}, expected: []string{"foo [[bar]] foo", "none"}},
+		{name: "replace takes precedence", option: GrepOptions{Keyword: "bar", Replace: new(string)}, expected: []string{"foo  foo"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.option.MarkBefore, tc.option.MarkAfter = "[[", "]]"
+			got, err := searchString(strings.NewReader(input), tc.option)
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if !slices.Equal(got.MatchedLines, tc.expected) {
+				t.Errorf("Expected %q but got %q", tc.expected, got.MatchedLines)
+			}
+		})
+	}
+}
+
+func TestSearchByteOffset(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		option   GrepOptions
+		expected []int64
+	}{
+		{name: "last line without new line", input: "ab\r\nmatch\nx match", option: GrepOptions{Keyword: "match"}, expected: []int64{4, 10}},
+		{name: "last line with new line", input: "ab\r\nmatch\nx match\n", option: GrepOptions{Keyword: "match"}, expected: []int64{4, 10}},
+		{name: "only matching", input: "ab\r\nmatch\nx match", option: GrepOptions{Keyword: "match", OnlyMatching: true}, expected: []int64{4, 12}},
+		{name: "context", input: "ab\r\nmatch\nx match", option: GrepOptions{Keyword: "ab", LinesAfterMatch: 2}, expected: []int64{0, 4, 10}},
+		{name: "context before", input: "ab\r\nmatch\nx match", option: GrepOptions{Keyword: "x", LinesBeforeMatch: 2}, expected: []int64{0, 4, 10}},
+		{name: "tail", input: "ab\r\nmatch\nx match", option: GrepOptions{Keyword: "match", TailLines: 1}, expected: []int64{10}},
+		{name: "line delimiter", input: "a;match;match", option: GrepOptions{Keyword: "match", LineDelim: ';'}, expected: []int64{2, 8}},
+		{name: "empty lines", input: "\n\nmatch", option: GrepOptions{Keyword: ""}, expected: []int64{0, 1, 2}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.option.ByteOffset = true
+			got, err := searchString(strings.NewReader(tc.input), tc.option)
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if !slices.Equal(got.ByteOffsets, tc.expected) {
+				t.Errorf("Expected %v but got %v", tc.expected, got.ByteOffsets)
+			}
+			if len(got.ByteOffsets) != len(got.MatchedLines) {
+				t.Errorf("Expected an offset for each of %q", got.MatchedLines)
+			}
+		})
+	}
+
+	// last line is counted whether it ends with new line or not, same as GNU grep
+	for _, input := range []string{"match\nmatch", "match\nmatch\n"} {
+		got, err := searchString(strings.NewReader(input), GrepOptions{Keyword: "match", LineCount: true})
+		if err != nil {
+			t.Fatalf("Didn't expected an error: %v", err)
+		}
+		if got.LineCount != 2 {
+			t.Errorf("Expected line count 2 for %q but got %d", input, got.LineCount)
+		}
+	}
+}
+
+func TestGrepNoFollowSymlink(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata/file1.txt"] = &fstest.MapFile{Data: []byte("match"), Mode: 0755}
+	testFS["testdata/link.txt"] = &fstest.MapFile{Data: []byte("file1.txt"), Mode: fs.ModeSymlink}
+
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		expected []string
+		expErr   error
+	}{
+		{name: "symlink is followed by default", option: GrepOptions{Path: "testdata/link.txt", OrigPath: "testdata/link.txt", Keyword: "match"}, expected: []string{"match"}},
+		{name: "symlink isn't followed", option: GrepOptions{Path: "testdata/link.txt", OrigPath: "testdata/link.txt", Keyword: "match", NoFollowSymlink: true}, expErr: ErrSymlink},
+		{name: "regular file isn't affected", option: GrepOptions{Path: "testdata/file1.txt", OrigPath: "testdata/file1.txt", Keyword: "match", NoFollowSymlink: true}, expected: []string{"match"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Grep(testFS, tc.option)
+			if !errors.Is(got.Error, tc.expErr) {
+				t.Fatalf("Expected error %v but got %v", tc.expErr, got.Error)
+			}
+			if !slices.Equal(got.MatchedLines, tc.expected) {
+				t.Errorf("Expected %q but got %q", tc.expected, got.MatchedLines)
+			}
+		})
+	}
+
+	// symlinks found in the walk are still followed
+	results := GrepR(testFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "match", NoFollowSymlink: true, FilesWithMatches: true})
+	if len(results) != 2 {
+		t.Errorf("Expected the file and the symlink in results but got %v", results)
+	}
+}
+
+func TestGrepReaderTimeout(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("line%d match\n", i))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	got := GrepReader(&slowReader{lines: lines, pause: 5 * time.Millisecond}, "slow-stream", GrepOptions{Keyword: "match", Context: ctx})
+	if !errors.Is(got.Error, context.DeadlineExceeded) {
+		t.Fatalf("Expected error %v but got %v", context.DeadlineExceeded, got.Error)
+	}
+
+	// lines matched before the timeout are kept
+	if len(got.MatchedLines) == 0 || len(got.MatchedLines) >= len(lines) {
+		t.Fatalf("Expected partial result but got %d of %d lines", len(got.MatchedLines), len(lines))
+	}
+	for i, line := range got.MatchedLines {
+		if want := strings.TrimSuffix(lines[i], "\n"); line != want {
+			t.Errorf("Expected %q at index %d but got %q", want, i, line)
+		}
+	}
+}
+
+func TestGrepRExtFilter(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+	testFS["testdata/test1.txt"] = &fstest.MapFile{Data: []byte("test in txt"), Mode: 0755}
+	testFS["testdata/test2.md"] = &fstest.MapFile{Data: []byte("test in md"), Mode: 0755}
+	testFS["testdata/test3.log"] = &fstest.MapFile{Data: []byte("test in log"), Mode: 0755}
+	testFS["testdata/inner/test4.txt"] = &fstest.MapFile{Data: []byte("test in inner txt"), Mode: 0755}
+	testFS["testdata/README.TXT"] = &fstest.MapFile{Data: []byte("test in uppercase txt"), Mode: 0755}
+	testFS["testdata/IMAGE.PNG"] = &fstest.MapFile{Data: []byte("test in uppercase png"), Mode: 0755}
+
+	testCases := []struct {
+		name       string
+		includeExt []string
+		excludeExt []string
+		result     []string
+	}{
+		{
+			name:       "include with leading dot",
+			includeExt: []string{".txt"},
+			result:     []string{"testdata/README.TXT", "testdata/inner/test4.txt", "testdata/test1.txt"},
+		},
+		{
+			name:       "include without leading dot",
+			includeExt: []string{"txt"},
+			result:     []string{"testdata/README.TXT", "testdata/inner/test4.txt", "testdata/test1.txt"},
+		},
+		{
+			name:       "include with mixed list",
+			includeExt: []string{"md", ".log"},
+			result:     []string{"testdata/test2.md", "testdata/test3.log"},
+		},
+		{
+			name:       "exclude with leading dot",
+			excludeExt: []string{".txt"},
+			result:     []string{"testdata/IMAGE.PNG", "testdata/test2.md", "testdata/test3.log"},
+		},
+		{
+			name:       "exclude with mixed list",
+			excludeExt: []string{"txt", ".md"},
+			result:     []string{"testdata/IMAGE.PNG", "testdata/test3.log"},
+		},
+		{
+			name:       "include with uppercase extension",
+			includeExt: []string{"TXT"},
+			result:     []string{"testdata/README.TXT", "testdata/inner/test4.txt", "testdata/test1.txt"},
+		},
+		{
+			name:       "exclude matching uppercase file extension",
+			excludeExt: []string{"png", "txt"},
+			result:     []string{"testdata/test2.md", "testdata/test3.log"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			options := GrepOptions{Path: "testdata", Keyword: "test", IncludeExt: tc.includeExt, ExcludeExt: tc.excludeExt}
+			var got []string
+			for _, res := range GrepR(testFS, options) {
+				got = append(got, res.Path)
+			}
+
+			if !slices.Equal(got, tc.result) {
+				t.Errorf("Expected %v but got %v", tc.result, got)
+			}
+		})
+	}
+}
+
+func TestGrepExtFilter(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["app.log"] = &fstest.MapFile{Data: []byte("foo in log"), Mode: 0755}
+	testFS["notes.TXT"] = &fstest.MapFile{Data: []byte("foo in notes"), Mode: 0755}
+
+	testCases := []struct {
+		name       string
+		path       string
+		includeExt []string
+		excludeExt []string
+		skipped    bool
+	}{
+		{name: "no filters", path: "app.log", skipped: false},
+		{name: "excluded file", path: "app.log", excludeExt: []string{"log"}, skipped: true},
+		{name: "not excluded file", path: "notes.TXT", excludeExt: []string{"log"}, skipped: false},
+		{name: "included file", path: "notes.TXT", includeExt: []string{".txt"}, skipped: false},
+		{name: "not included file", path: "app.log", includeExt: []string{"txt"}, skipped: true},
+		{name: "exclude wins over include", path: "app.log", includeExt: []string{"log"}, excludeExt: []string{"log"}, skipped: true},
+		{name: "missing file is skipped without opening", path: "missing.log", excludeExt: []string{"log"}, skipped: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Grep(testFS, GrepOptions{Path: tc.path, OrigPath: tc.path, Keyword: "foo", IncludeExt: tc.includeExt, ExcludeExt: tc.excludeExt})
+			if got.Error != nil {
+				t.Fatalf("Didn't expected an error: %v", got.Error)
+			}
+			if tc.skipped {
+				if got.Skipped != SkipReasonExtension || hasResult(got) {
+					t.Errorf("Expected file to be skipped but got %+v", got)
+				}
+				return
+			}
+			if got.Skipped != "" || len(got.MatchedLines) != 1 {
+				t.Errorf("Expected file to be searched but got %+v", got)
+			}
+		})
+	}
+}
+
+func TestGrepRNameOnly(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+	testFS["testdata/test1.txt"] = &fstest.MapFile{Data: []byte("no keyword here"), Mode: 0755}
+	testFS["testdata/filexyz.txt"] = &fstest.MapFile{Data: []byte("test in content only"), Mode: 0755}
+	testFS["testdata/inner/test2.md"] = &fstest.MapFile{Data: nil, Mode: 0755}
+	testFS["testdata/tests/file.txt"] = &fstest.MapFile{Data: nil, Mode: 0755}
+	testFS["testdata/.git/test_config"] = &fstest.MapFile{Data: nil, Mode: 0755}
+	// unreadable, but it's never opened
+	testFS["testdata/test_perm.txt"] = &fstest.MapFile{Data: nil, Mode: 0000}
+
+	testCases := []struct {
+		name       string
+		keyword    string
+		regexp     bool
+		ignoreCase bool
+		includeExt []string
+		result     []string
+	}{
+		{
+			name:    "matches the path instead of content",
+			keyword: "test",
+			result:  []string{"testdata/inner/test2.md", "testdata/test1.txt", "testdata/test_perm.txt", "testdata/tests/file.txt"},
+		},
+		{
+			name:       "matches the path with include option",
+			keyword:    "test",
+			includeExt: []string{"txt"},
+			result:     []string{"testdata/test1.txt", "testdata/test_perm.txt", "testdata/tests/file.txt"},
+		},
+		{
+			name:    "matches the path with regexp option",
+			keyword: "^test[0-9]",
+			regexp:  true,
+			result:  []string{"testdata/test1.txt"},
+		},
+		{
+			name:       "matches the path with ignore case option",
+			keyword:    "XYZ",
+			ignoreCase: true,
+			result:     []string{"testdata/filexyz.txt"},
+		},
+		{
+			name:    "matches the path without matches",
+			keyword: "vibgyor",
+			result:  nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results := GrepR(testFS, GrepOptions{
+				Path: "testdata",
+				OrigPath: "testdata",
+				Keyword: tc.keyword,
+				Regexp: tc.regexp,
+				IgnoreCase: tc.ignoreCase,
+				IncludeExt: tc.includeExt,
+				NameOnly: true,
+			})
+
+			var got []string
+			for _, res := range results {
+				got = append(got, res.Path)
+			}
+			if !slices.Equal(got, tc.result) {
+				t.Errorf("Expected %v but got %v", tc.result, got)
+			}
+		})
+	}
+}
+
+func TestGrepRPathFilter(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+	testFS["testdata/test1.txt"] = &fstest.MapFile{Data: []byte("foo in test file"), Mode: 0755}
+	testFS["testdata/file1.txt"] = &fstest.MapFile{Data: []byte("foo in other file"), Mode: 0755}
+	testFS["testdata/tests/file2.txt"] = &fstest.MapFile{Data: []byte("foo in test dir"), Mode: 0755}
+	testFS["testdata/tests/file3.txt"] = &fstest.MapFile{Data: []byte("no keyword in test dir"), Mode: 0755}
+
+	testCases := []struct {
+		name       string
+		pathFilter string
+		result     []string
+		skipped    int
+	}{
+		{
+			name:       "substring filter with content keyword",
+			pathFilter: "test",
+			result:     []string{"testdata/test1.txt", "testdata/tests/file2.txt"},
+			skipped:    1,
+		},
+		{
+			name:       "regexp filter with content keyword",
+			pathFilter: "^tests/.*[0-9]\\.txt$",
+			result:     []string{"testdata/tests/file2.txt"},
+			skipped:    2,
+		},
+		{
+			name:       "filter doesn't match the root",
+			pathFilter: "testdata",
+			result:     nil,
+			skipped:    4,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results, stats := GrepRStats(testFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "foo", PathFilter: tc.pathFilter})
+
+			var got []string
+			for _, res := range results {
+				got = append(got, res.Path)
+			}
+			if !slices.Equal(got, tc.result) {
+				t.Errorf("Expected %v but got %v", tc.result, got)
+			}
+			if stats.FilesSkipped[SkipReasonPathFilter] != tc.skipped {
+				t.Errorf("Expected files skipped by path filter %d but got %d", tc.skipped, stats.FilesSkipped[SkipReasonPathFilter])
+			}
+		})
+	}
+
+	// invalid filter is counted as an error
+	_, stats := GrepRStats(testFS, GrepOptions{Path: "testdata", Keyword: "foo", PathFilter: "test("})
+	if stats.Errors != 1 {
+		t.Errorf("Expected errors %d but got %d", 1, stats.Errors)
+	}
+}
+
+func TestGrepRReport(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+	testFS["testdata/a.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+	testFS["testdata/b.txt"] = &fstest.MapFile{Data: []byte("bar"), Mode: 0755}
+	testFS["testdata/c.md"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+	testFS["testdata/inner/d.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+	testFS["testdata/vendor/e.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+
+	// filtered out files aren't in report
+	results := GrepR(testFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "foo", IncludeExt: []string{"txt"}, Report: true})
+	var got []string
+	for _, res := range results {
+		got = append(got, fmt.Sprintf("%s:%v", res.Path, res.Matched))
+	}
+	want := []string{"testdata/a.txt:true", "testdata/b.txt:false", "testdata/inner/d.txt:true"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v but got %v", want, got)
+	}
+}
+
+func TestGrepRExcludeEmpty(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+	testFS["testdata/file1.txt"] = &fstest.MapFile{Data: []byte{}, Mode: 0755}
+	testFS["testdata/file2.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+	testFS["testdata/file3.txt"] = &fstest.MapFile{Data: []byte("bar"), Mode: 0755}
+
+	testCases := []struct {
+		name         string
+		excludeEmpty bool
+		result       []string
+		skipped      int
+	}{
+		{name: "empty file is included by default", excludeEmpty: false, result: []string{"testdata/file1.txt:false", "testdata/file2.txt:true", "testdata/file3.txt:false"}, skipped: 0},
+		{name: "empty file is excluded", excludeEmpty: true, result: []string{"testdata/file2.txt:true", "testdata/file3.txt:false"}, skipped: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results, stats := GrepRStats(testFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "foo", Report: true, FilesWithMatches: true, ExcludeEmpty: tc.excludeEmpty})
+			var got []string
+			for _, res := range results {
+				got = append(got, fmt.Sprintf("%s:%v", res.Path, res.Matched))
+			}
+			if !slices.Equal(got, tc.result) {
+				t.Errorf("Expected %v but got %v", tc.result, got)
+			}
+			if stats.FilesSkipped[SkipReasonEmpty] != tc.skipped {
+				t.Errorf("Expected skipped %d but got %d", tc.skipped, stats.FilesSkipped[SkipReasonEmpty])
+			}
+			if stats.FilesScanned != len(tc.result) {
+				t.Errorf("Expected files scanned %d but got %d", len(tc.result), stats.FilesScanned)
+			}
+		})
+	}
+}
+
+func TestGrepRProgress(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+	for i := 0; i < 20; i++ {
+		testFS[fmt.Sprintf("testdata/dir%d/file%d.txt", i%3, i)] = &fstest.MapFile{Data: []byte("foo\nbar\nfoo"), Mode: 0755}
+	}
+	testFS["testdata/empty.txt"] = &fstest.MapFile{Data: []byte("bar"), Mode: 0755}
+
+	// func isn't called concurrently, so it's safe without a lock
+	var calls [][2]int
+	GrepR(testFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "foo", ProgressFunc: func(scanned, matched int) {
+		calls = append(calls, [2]int{scanned, matched})
+	}})
+
+	if len(calls) != 21 {
+		t.Fatalf("Expected %d calls but got %d", 21, len(calls))
+	}
+	for i, call := range calls {
+		if call[0] != i+1 {
+			t.Errorf("Expected scanned %d at call %d but got %d", i+1, i, call[0])
+		}
+		if i > 0 && call[1] < calls[i-1][1] {
+			t.Errorf("Expected matched to not go down at call %d but got %d after %d", i, call[1], calls[i-1][1])
+		}
+	}
+	if last := calls[len(calls)-1]; last != [2]int{21, 40} {
+		t.Errorf("Expected last call %v but got %v", [2]int{21, 40}, last)
+	}
+}
+
+func TestGrepRSort(t *testing.T) {
+	now := time.Now()
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+	testFS["testdata/a.txt"] = &fstest.MapFile{Data: []byte("foo\nfoo"), Mode: 0755, ModTime: now.Add(-time.Hour)}
+	testFS["testdata/b.txt"] = &fstest.MapFile{Data: []byte("foo\nfoo\nfoo"), Mode: 0755, ModTime: now.Add(-2 * time.Hour)}
+	testFS["testdata/c.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755, ModTime: now}
+	testFS["testdata/d.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755, ModTime: now}
+
+	testCases := []struct {
+		name    string
+		sortBy  string
+		reverse bool
+		result  []string
+	}{
+		{name: "path by default", result: []string{"testdata/a.txt", "testdata/b.txt", "testdata/c.txt", "testdata/d.txt"}},
+		{name: "path", sortBy: SortPath, result: []string{"testdata/a.txt", "testdata/b.txt", "testdata/c.txt", "testdata/d.txt"}},
+		{name: "path reverse", sortBy: SortPath, reverse: true, result: []string{"testdata/d.txt", "testdata/c.txt", "testdata/b.txt", "testdata/a.txt"}},
+		{name: "modified", sortBy: SortModified, result: []string{"testdata/b.txt", "testdata/a.txt", "testdata/c.txt", "testdata/d.txt"}},
+		{name: "modified reverse", sortBy: SortModified, reverse: true, result: []string{"testdata/d.txt", "testdata/c.txt", "testdata/a.txt", "testdata/b.txt"}},
+		{name: "count", sortBy: SortCount, result: []string{"testdata/c.txt", "testdata/d.txt", "testdata/a.txt", "testdata/b.txt"}},
+		{name: "count reverse", sortBy: SortCount, reverse: true, result: []string{"testdata/b.txt", "testdata/a.txt", "testdata/d.txt", "testdata/c.txt"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results := GrepR(testFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "foo", SortBy: tc.sortBy, SortReverse: tc.reverse})
+
+			var got []string
+			for _, res := range results {
+				got = append(got, res.Path)
+			}
+			if !slices.Equal(got, tc.result) {
+				t.Errorf("Expected %v but got %v", tc.result, got)
+			}
+		})
+	}
+}
+
+func TestGrepRSortPathLikeWalk(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata/dir/a.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+	testFS["testdata/dir.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+	testFS["testdata/dir-b.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+
+	// directory "dir" comes before "dir-b.txt" and "dir.txt" in walk, though "/" sorts after "-" and "."
+	want := []string{"testdata/dir/a.txt", "testdata/dir-b.txt", "testdata/dir.txt"}
+	var got []string
+	for _, res := range GrepR(testFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "foo"}) {
+		got = append(got, res.Path)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v but got %v", want, got)
+	}
+}
+
+// blocks on opening the file at path till release is closed
+type blockingFS struct {
+	fstest.MapFS
+	path string
+	release chan struct{}
+}
+
+func(f blockingFS) Open(name string) (fs.File, error) {
+	if name == f.path {
+		<-f.release
+	}
+	return f.MapFS.Open(name)
+}
+
+func TestGrepRStream(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata/a.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+	testFS["testdata/b.txt"] = &fstest.MapFile{Data: []byte("bar"), Mode: 0755}
+	testFS["testdata/dir/c.txt"] = &fstest.MapFile{Data: []byte("foo\nfoo"), Mode: 0755}
+	testFS["testdata/z.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+	blockFS := blockingFS{MapFS: testFS, path: "testdata/z.txt", release: make(chan struct{})}
+
+	results, wait := GrepRStream(blockFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "foo", SortBy: SortCount, SortReverse: true})
+
+	// results before the blocked file are sent before the search is done
+	var got []string
+	for len(got) < 2 {
+		select {
+		case res := <-results:
+			got = append(got, res.Path)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected results before the search is done, but got %v", got)
+		}
+	}
+	close(blockFS.release)
+	for res := range results {
+		got = append(got, res.Path)
+	}
+
+	// sort is ignored, results are in the order of walk
+	want := []string{"testdata/a.txt", "testdata/dir/c.txt", "testdata/z.txt"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v but got %v", want, got)
+	}
+	stats := wait()
+	if stats.FilesScanned != 4 || stats.Matches != 4 {
+		t.Errorf("Expected 4 files scanned with 4 matches but got %d with %d", stats.FilesScanned, stats.Matches)
+	}
+}
+
+func TestGrepREvents(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata/a.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+	testFS["testdata/b.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0000}
+	testFS["testdata/c.txt"] = &fstest.MapFile{Data: []byte("bar"), Mode: 0755}
+	testFS["testdata/d.txt"] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+
+	events, wait := GrepREvents(permFS{testFS}, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "foo"})
+	var got []string
+	for event := range events {
+		switch {
+		case event.Err != nil && event.Result == nil:
+			if !errors.Is(event.Err, fs.ErrPermission) {
+				t.Errorf("Expected error %v but got %v", fs.ErrPermission, event.Err)
+			}
+			got = append(got, "error")
+		case event.Result != nil && event.Err == nil:
+			if event.Result.Error != nil || !event.Result.Matched {
+				t.Errorf("Expected a matched result without error but got %+v", event.Result)
+			}
+			got = append(got, event.Result.Path)
+		default:
+			t.Errorf("Expected either result or error in event but got %+v", event)
+		}
+	}
+
+	// error is in the order of walk, and isn't in the results
+	want := []string{"testdata/a.txt", "error", "testdata/d.txt"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v but got %v", want, got)
+	}
+	if stats := wait(); stats.Errors != 1 || stats.Matches != 2 {
+		t.Errorf("Expected 1 error with 2 matches but got %d with %d", stats.Errors, stats.Matches)
+	}
+
+	// error which fails the whole search is sent as well
+	events, wait = GrepREvents(testFS, GrepOptions{Path: "testdata", Keyword: "foo", PathFilter: "("})
+	var errs []error
+	for event := range events {
+		errs = append(errs, event.Err)
+	}
+	if len(errs) != 1 || errs[0] == nil || wait().Errors != 1 {
+		t.Errorf("Expected an error for the invalid path filter but got %v", errs)
+	}
+
+	// results of GrepRStream are unchanged, errors are only counted
+	results, waitStream := GrepRStream(permFS{testFS}, GrepOptions{Path: "testdata", Keyword: "foo"})
+	count := 0
+	for res := range results {
+		if res.Error != nil {
+			t.Errorf("Didn't expected an error: %v", res.Error)
+		}
+		count++
+	}
+	if count != 2 || waitStream().Errors != 1 {
+		t.Errorf("Expected 2 results with 1 error counted but got %d", count)
+	}
+}
+
+// pauses on reading each directory, so that the workers of files found before it get to run
+type slowDirFS struct {
+	fstest.MapFS
+	pause time.Duration
+}
+
+func(f slowDirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	time.Sleep(f.pause)
+	return f.MapFS.ReadDir(name)
+}
+
+// counts the files opened, to check how far the search went
+type countingFS struct {
+	fstest.MapFS
+	opened *atomic.Int64
+}
+
+func(f countingFS) Open(name string) (fs.File, error) {
+	f.opened.Add(1)
+	return f.MapFS.Open(name)
+}
+
+func TestGrepRFunc(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	files := 3000
+	for i := 0; i < files; i++ {
+		testFS[fmt.Sprintf("testdata/file%04d.txt", i)] = &fstest.MapFile{Data: []byte("foo"), Mode: 0755}
+	}
+	countFS := countingFS{MapFS: testFS, opened: &atomic.Int64{}}
+
+	// every result is handled in the order of walk
+	var got []string
+	err := GrepRFunc(countFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "foo"}, func(result GrepResult) error {
+		got = append(got, result.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Didn't expected an error: %v", err)
+	}
+	if len(got) != files || got[0] != "testdata/file0000.txt" || got[files-1] != "testdata/file2999.txt" {
+		t.Errorf("Expected %d results in the order of walk but got %d", files, len(got))
+	}
+
+	// search stops at the error of handler
+	errHandle := errors.New("sink is full")
+	countFS.opened.Store(0)
+	handled := 0
+	err = GrepRFunc(countFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "foo"}, func(result GrepResult) error {
+		handled++
+		if handled == 3 {
+			return errHandle
+		}
+		return nil
+	})
+	if !errors.Is(err, errHandle) {
+		t.Errorf("Expected error %v but got %v", errHandle, err)
+	}
+	if handled != 3 {
+		t.Errorf("Expected handler to be called 3 times but got %d", handled)
+	}
+	// walk can't be ahead of the handler by more than the pending files
+	if opened := countFS.opened.Load(); opened >= int64(files) {
+		t.Errorf("Expected the walk to stop, but %d files were opened", opened)
+	}
+}
+
+func TestGrepRTotalLimit(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+	for i := 0; i < 100; i++ {
+		testFS[fmt.Sprintf("testdata/dir%03d/file.txt", i)] = &fstest.MapFile{Data: []byte("foo1\nbar\nfoo2 foo3"), Mode: 0755}
+	}
+
+	testCases := []struct {
+		name   string
+		option GrepOptions
+		lines  int
+	}{
+		{name: "matched lines", option: GrepOptions{Keyword: "foo"}, lines: 3},
+		{name: "only matching", option: GrepOptions{Keyword: "foo", OnlyMatching: true}, lines: 3},
+		{name: "line count", option: GrepOptions{Keyword: "foo", LineCount: true}, lines: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.option.Path = "testdata"
+			tc.option.OrigPath = "testdata"
+			tc.option.TotalLimit = 3
+			results, stats := GrepRStats(slowDirFS{testFS, time.Millisecond}, tc.option)
+
+			// counting the distinct matched lines in result
+			got := 0
+			for _, res := range results {
+				if res.Error != nil {
+					t.Fatalf("Didn't expected an error: %v", res.Error)
+				}
+				got += res.LineCount
+				last := 0
+				for _, num := range res.LineNumbers {
+					if num != last {
+						got++
+						last = num
+					}
+				}
+			}
+			if got != tc.lines || stats.Matches != tc.lines {
+				t.Errorf("Expected %d lines but got %d (%d in stats)", tc.lines, got, stats.Matches)
+			}
+
+			// walk stops soon after the limit, instead of going through every file
+			if stats.FilesScanned >= 100 {
+				t.Errorf("Expected the walk to stop before %d files but scanned %d", 100, stats.FilesScanned)
+			}
+		})
+	}
+}
+
+func TestGrepRStats(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+	testFS["testdata/test1.txt"] = &fstest.MapFile{Data: []byte("test line\nanother test line\nno hit"), Mode: 0755}
+	testFS["testdata/test2.log"] = &fstest.MapFile{Data: []byte("test in log"), Mode: 0755}
+	testFS["testdata/.git/config"] = &fstest.MapFile{Data: []byte("test = true"), Mode: 0755}
+
+	results, stats := GrepRStats(testFS, GrepOptions{Path: "testdata", Keyword: "test", ExcludeExt: []string{"log"}})
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result but got %v", results)
+	}
+
+	if stats.FilesScanned != 1 {
+		t.Errorf("Expected files scanned %d but got %d", 1, stats.FilesScanned)
+	}
+	if stats.FilesSkipped[SkipReasonExtension] != 1 {
+		t.Errorf("Expected files skipped by extension %d but got %d", 1, stats.FilesSkipped[SkipReasonExtension])
+	}
+	if stats.FilesSkipped[SkipReasonExcludedDir] != 1 {
+		t.Errorf("Expected directories skipped %d but got %d", 1, stats.FilesSkipped[SkipReasonExcludedDir])
+	}
+	if stats.Matches != 2 {
+		t.Errorf("Expected matches %d but got %d", 2, stats.Matches)
+	}
+	if stats.FilesMatched != 1 {
+		t.Errorf("Expected files matched %d but got %d", 1, stats.FilesMatched)
+	}
+	if !maps.Equal(stats.MatchesByExt, map[string]int{".txt": 2}) {
+		t.Errorf("Expected matches by extension %v but got %v", map[string]int{".txt": 2}, stats.MatchesByExt)
+	}
+	if stats.Elapsed <= 0 {
+		t.Errorf("Expected elapsed time to be set")
+	}
+	if stats.Errors != 0 {
+		t.Errorf("Expected errors %d but got %d", 0, stats.Errors)
+	}
+
+	// non regular files are skipped rather than read
+	testFS["testdata/fifo"] = &fstest.MapFile{Data: []byte("test in fifo"), Mode: fs.ModeNamedPipe | 0755}
+	testFS["testdata/device"] = &fstest.MapFile{Data: []byte("test in device"), Mode: fs.ModeDevice | fs.ModeCharDevice | 0755}
+	results, stats = GrepRStats(testFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "test", ExcludeExt: []string{"log"}})
+	if len(results) != 1 || results[0].Path != "testdata/test1.txt" {
+		t.Errorf("Expected only testdata/test1.txt in result but got %v", results)
+	}
+	if stats.FilesSkipped[SkipReasonNotRegular] != 2 {
+		t.Errorf("Expected files skipped as not regular %d but got %d", 2, stats.FilesSkipped[SkipReasonNotRegular])
+	}
+	if !slices.Equal(stats.NotRegular, []string{"testdata/device", "testdata/fifo"}) {
+		t.Errorf("Expected %v but got %v", []string{"testdata/device", "testdata/fifo"}, stats.NotRegular)
+	}
+	if stats.FilesScanned != 1 {
+		t.Errorf("Expected files scanned %d but got %d", 1, stats.FilesScanned)
+	}
+
+	// walking a missing directory is counted as an error
+	_, stats = GrepRStats(testFS, GrepOptions{Path: "missing", Keyword: "test"})
+	if stats.Errors != 1 {
+		t.Errorf("Expected errors %d but got %d", 1, stats.Errors)
+	}
+}
+
+func TestResultStats(t *testing.T) {
+	testFS := fstest.MapFS{
+		"a.go": {Data: []byte("TODO one\nTODO two\n")},
+		"b.md": {Data: []byte("TODO three\n")},
+		"Makefile": {Data: []byte("TODO four\n")},
+		"c.txt": {Data: []byte("done\n")},
+	}
+	var results []GrepResult
+	for _, name := range []string{"a.go", "b.md", "Makefile", "c.txt", "missing.txt"} {
+		results = append(results, Grep(testFS, GrepOptions{Path: name, Keyword: "TODO"}))
+	}
+
+	stats := ResultStats(results)
+	if stats.Matches != 4 || stats.FilesMatched != 3 || stats.FilesScanned != 4 || stats.Errors != 1 {
+		t.Errorf("Expected 4 matches in 3 of 4 files with 1 error but got %+v", stats)
+	}
+	expected := map[string]int{".go": 2, ".md": 1, "": 1}
+	if !maps.Equal(stats.MatchesByExt, expected) {
+		t.Errorf("Expected matches by extension %v but got %v", expected, stats.MatchesByExt)
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["file.txt"] = &fstest.MapFile{Data: []byte("test"), Mode: 0644}
+	testFS["no_perm.txt"] = &fstest.MapFile{Data: []byte("test"), Mode: 0000}
+	testFS["dir"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+
+	testCases := []struct {
+		name     string
+		fSys     fs.FS
+		fileName string
+		expErr   error
+	}{
+		{name: "regular file", fSys: testFS, fileName: "file.txt", expErr: nil},
+		{name: "missing file", fSys: testFS, fileName: "missing.txt", expErr: fs.ErrNotExist},
+		{name: "directory", fSys: testFS, fileName: "dir", expErr: ErrIsDirectory},
+		{name: "permission error on open", fSys: permFS{testFS}, fileName: "no_perm.txt", expErr: fs.ErrPermission},
+		// mode bits aren't guessed from, file is readable if open succeeds (eg: for root)
+		{name: "no permission bits but open succeeds", fSys: testFS, fileName: "no_perm.txt", expErr: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file, err := openFile(tc.fSys, tc.fileName, tc.fileName)
+			if tc.expErr == nil {
+				if err != nil {
+					t.Fatalf("Didn't expected an error: %v", err)
+				}
+				file.Close()
+				return
+			}
+			if !errors.Is(err, tc.expErr) {
+				t.Errorf("Expected error %v but got %v", tc.expErr, err)
+			}
+		})
+	}
+}
+
+func TestShouldSearch(t *testing.T) {
+	testCases := []struct {
+		name       string
+		fileName   string
+		includeExt []string
+		excludeExt []string
+		expected   bool
+	}{
+		{name: "no filters", fileName: "test.txt", expected: true},
+		{name: "include only with match", fileName: "test.txt", includeExt: []string{"txt"}, expected: true},
+		{name: "include only without match", fileName: "test.md", includeExt: []string{"txt"}, expected: false},
+		{name: "include only without extension", fileName: "Makefile", includeExt: []string{"txt"}, expected: false},
+		{name: "exclude only with match", fileName: "test.log", excludeExt: []string{"log"}, expected: false},
+		{name: "exclude only without match", fileName: "test.txt", excludeExt: []string{"log"}, expected: true},
+		{name: "overlapping include and exclude on same file", fileName: "test.txt", includeExt: []string{"txt"}, excludeExt: []string{".txt"}, expected: false},
+		{name: "include and exclude on different files", fileName: "test.txt", includeExt: []string{"txt", "md"}, excludeExt: []string{"md"}, expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := shouldSearch(tc.fileName, GrepOptions{IncludeExt: tc.includeExt, ExcludeExt: tc.excludeExt})
+			if got != tc.expected {
+				t.Errorf("Expected %v but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+// reader which fails after returning its data, to check that reading stops early
+type failingReader struct {
+	data []byte
+	read bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.read {
+		return 0, errors.New("read after the first match")
+	}
+	r.read = true
+	return copy(p, r.data), nil
+}
+
+func TestHasMatch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		r        io.Reader
+		keyword  string
+		expected bool
+	}{
+		{
+			name:     "match in line 1 stops reading",
+			r:        &failingReader{data: []byte("line1 match\nline2\n")},
+			keyword:  "match",
+			expected: true,
+		},
+		{
+			name:     "match in last line",
+			r:        strings.NewReader("line1\nline2\nline3 match"),
+			keyword:  "match",
+			expected: true,
+		},
+		{
+			name:     "no match",
+			r:        strings.NewReader("line1\nline2\nline3"),
+			keyword:  "match",
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := hasMatch(tc.r, GrepOptions{Keyword: tc.keyword})
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("Expected %v but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestGrepFilesWithMatches(t *testing.T) {
+	testFS := fstest.MapFS{}
+	testFS["match.txt"] = &fstest.MapFile{Data: []byte("match\nline2"), Mode: 0755}
+	testFS["nomatch.txt"] = &fstest.MapFile{Data: []byte("line1\nline2"), Mode: 0755}
+
+	for fileName, expected := range map[string]bool{"match.txt": true, "nomatch.txt": false} {
+		got := Grep(testFS, GrepOptions{Path: fileName, Keyword: "match", FilesWithMatches: true})
+		if got.Error != nil {
+			t.Fatalf("Didn't expected an error: %v", got.Error)
+		}
+		if got.Matched != expected {
+			t.Errorf("Expected matched %v for %s but got %v", expected, fileName, got.Matched)
+		}
+		if len(got.MatchedLines) != 0 {
+			t.Errorf("Expected no matched lines but got %v", got.MatchedLines)
+		}
+	}
+}
+
+func TestGrepBinary(t *testing.T) {
+	testFS := fstest.MapFS{}
+	testFS["app.bin"] = &fstest.MapFile{Data: []byte("head\x00er\nmatch\n"), Mode: 0755}
+	testFS["app.txt"] = &fstest.MapFile{Data: []byte("head\nmatch\n"), Mode: 0755}
+
+	for fileName, expected := range map[string]bool{"app.bin": true, "app.txt": false} {
+		got := Grep(testFS, GrepOptions{Path: fileName, Keyword: "match"})
+		if got.Error != nil {
+			t.Fatalf("Didn't expected an error: %v", got.Error)
+		}
+		if !got.Matched || got.Binary != expected {
+			t.Errorf("Expected a match with binary %v for %s but got %+v", expected, fileName, got)
+		}
+	}
+
+	// binary file counts as without matches, even when the NUL byte is after the first match
+	for _, option := range []GrepOptions{{}, {FilesWithMatches: true}, {LineCount: true}} {
+		option.Path, option.Keyword, option.IgnoreBinaryMatches = "app.bin", "match", true
+		got := Grep(testFS, option)
+		if got.Error != nil {
+			t.Fatalf("Didn't expected an error: %v", got.Error)
+		}
+		if got.Matched || len(got.MatchedLines) != 0 || got.LineCount != 0 {
+			t.Errorf("Expected no match but got %+v", got)
+		}
+	}
+	if got := Grep(testFS, GrepOptions{Path: "app.txt", Keyword: "match", IgnoreBinaryMatches: true}); !got.Matched {
+		t.Errorf("Expected a match in the text file but got %+v", got)
+	}
+
+	// text wins over ignoring the binary file
+	for _, option := range []GrepOptions{{}, {FilesWithMatches: true}} {
+		option.Path, option.Keyword, option.IgnoreBinaryMatches, option.Text = "app.bin", "match", true, true
+		got := Grep(testFS, option)
+		if got.Error != nil {
+			t.Fatalf("Didn't expected an error: %v", got.Error)
+		}
+		if !got.Matched || got.Binary {
+			t.Errorf("Expected a match as text but got %+v", got)
+		}
+	}
+}
+
+// large input with a match in line 1
+func benchmarkInput() []byte {
+	var b bytes.Buffer
+	b.WriteString("line match\n")
+	for i := 0; i < 100000; i++ {
+		b.WriteString("some line without the keyword\n")
+	}
+	return b.Bytes()
+}
+
+func BenchmarkSearchString(b *testing.B) {
+	data := benchmarkInput()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		searchString(bytes.NewReader(data), GrepOptions{Keyword: "match"})
+	}
+}
+
+func BenchmarkHasMatch(b *testing.B) {
+	data := benchmarkInput()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hasMatch(bytes.NewReader(data), GrepOptions{Keyword: "match"})
+	}
+}
+
+// many small files, where allocations per file count more than the search itself
+func BenchmarkGrepRManyFiles(b *testing.B) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["testdata"] = &fstest.MapFile{Data: nil, Mode: fs.ModeDir}
+	files := 1000
+	for i := 0; i < files; i++ {
+		testFS[fmt.Sprintf("testdata/dir%d/file%d.txt", i%10, i)] = &fstest.MapFile{Data: []byte("line1\nline2 match\nline3"), Mode: 0755}
+	}
+
+	// without the pool each file allocates its own buffer, to compare the allocations before and after it
+	for _, pooled := range []bool{true, false} {
+		name := "pooled"
+		if !pooled {
+			name = "unpooled"
+		}
+		b.Run(name, func(b *testing.B) {
+			poolScanBuffers = pooled
+			defer func() { poolScanBuffers = true }()
+
+			b.ReportAllocs()
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				GrepR(testFS, GrepOptions{Path: "testdata", OrigPath: "testdata", Keyword: "match"})
+			}
+			b.StopTimer()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/float64(b.N*files), "B/file")
+		})
+	}
+}
+
+// file system which fails to open the files without read permission, like the OS does for a user other than root
+// since fstest.MapFS opens the files irrespective of their mode
+type permFS struct {
+	fstest.MapFS
+}
+
+func(p permFS) Open(name string) (fs.File, error) {
+	if file, ok := p.MapFS[name]; ok && !file.Mode.IsDir() && file.Mode.Perm()&0444 == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return p.MapFS.Open(name)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// encodes s as UTF-16LE
+func utf16LE(s string) []byte {
+	var data []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		data = append(data, byte(u), byte(u>>8))
+	}
+	return data
+}
+
+func TestReplace(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		keyword  string
+		replace  *string
+		delim    byte
+		expected string
+		expErr   error
+	}{
+		{
+			name:     "replaces matches and keeps other lines",
+			content:  "line1\nline2 match\r\nline3 match",
+			keyword:  "match",
+			replace:  stringPtr("hit"),
+			expected: "line1\nline2 hit\r\nline3 hit",
+		},
+		{
+			name:     "keeps trailing new line",
+			content:  "match\n",
+			keyword:  "match",
+			replace:  stringPtr(""),
+			expected: "\n",
+		},
+		{
+			name:     "custom line delimiter",
+			content:  "a;match\r;b match",
+			keyword:  "match",
+			replace:  stringPtr("hit"),
+			delim:    ';',
+			expected: "a;hit\r;b hit",
+		},
+		{
+			name:    "without replace",
+			content: "match",
+			keyword: "match",
+			expErr:  ErrNoReplace,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got bytes.Buffer
+			err := Replace(strings.NewReader(tc.content), &got, GrepOptions{Keyword: tc.keyword, Replace: tc.replace, LineDelim: tc.delim})
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Fatalf("Expected error %v but got %v", tc.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Didn't expected an error: %v", err)
+			}
+
+			if got.String() != tc.expected {
+				t.Errorf("Expected %q but got %q", tc.expected, got.String())
+			}
+		})
+	}
+
+	// raw lines are rewritten, so the ones decoded for the search can't be
+	for _, option := range []GrepOptions{{Encoding: "latin1"}, {Pre: "cat"}, {Multiline: true, Regexp: true}} {
+		option.Keyword, option.Replace = "x", stringPtr("Y")
+		if err := Replace(strings.NewReader("x\n"), io.Discard, option); !errors.Is(err, ErrReplaceDecoded) {
+			t.Errorf("Expected error %v but got %v", ErrReplaceDecoded, err)
+		}
+	}
+	if err := Replace(strings.NewReader("\xff\xfex\x00\n\x00"), io.Discard, GrepOptions{Keyword: "x", Replace: stringPtr("Y")}); !errors.Is(err, ErrReplaceDecoded) {
+		t.Errorf("Expected error %v but got %v", ErrReplaceDecoded, err)
+	}
+
+	// last line without a line ending is one of the tail
+	var got bytes.Buffer
+	if err := Replace(strings.NewReader("a x\nb x\nc x"), &got, GrepOptions{Keyword: "x", Replace: stringPtr("Y"), TailLines: 1}); err != nil {
+		t.Fatalf("Didn't expected an error: %v", err)
+	}
+	if got.String() != "a x\nb x\nc Y" {
+		t.Errorf("Expected %q but got %q", "a x\nb x\nc Y", got.String())
+	}
+}
+
+func ExampleSearch() {
+	r := strings.NewReader("line1\nline2 match\nline3")
+	lines, err := Search(r, GrepOptions{Keyword: "match", LinesBeforeMatch: 1})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	// Output:
+	// line1
+	// line2 match
 }
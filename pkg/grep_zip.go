@@ -0,0 +1,79 @@
+package grep
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// GrepZip greps each file in the zip archive at option.Path (or stdin), the archive is searched with GrepR as a file system
+// path of each result is the archive path followed by the member name, eg: "logs.zip:app.log"
+// members which couldn't be read are returned as errors with their path, after the results
+// default excludes of directories (like vendor and .git) don't apply inside the archive, since its members are picked already
+func GrepZip(fSys fs.FS, option GrepOptions) []GrepResult {
+	r, cleanup, err := getReader(fSys, option)
+	if err != nil {
+		return []GrepResult{{Error: err}}
+	}
+	defer cleanup()
+
+	// archive from stdin has no name, so only the member name is used
+	archive := option.OrigPath
+	if archive == "" {
+		archive = option.Path
+	}
+
+	zr, err := zipReader(r)
+	if err != nil {
+		return []GrepResult{{Error: fmt.Errorf("%s: %w", archive, err)}}
+	}
+
+	// walking from the root of archive, empty user path keeps the member names as is
+	memberOption := option
+	memberOption.Path = "."
+	memberOption.OrigPath = ""
+	memberOption.NoDefaultExcludes = true
+	events, _ := GrepREvents(zr, memberOption)
+
+	var results, errs []GrepResult
+	for event := range events {
+		if event.Err != nil {
+			if name := memberPath(archive, event.Path); name != "" {
+				event.Err = fmt.Errorf("%s: %w", name, event.Err)
+			}
+			errs = append(errs, GrepResult{Error: event.Err})
+			continue
+		}
+		result := *event.Result
+		result.Path = memberPath(archive, result.Path)
+		results = append(results, result)
+	}
+	sortResults(results, option)
+	return append(results, errs...)
+}
+
+// path of member shown to the user, the archive is left out if it has no name (and the member for errors of whole archive)
+func memberPath(archive, member string) string {
+	if archive == "" || member == "" {
+		return archive + member
+	}
+	return archive + ":" + member
+}
+
+// opens the zip from r, which needs random access
+// content of r is read into memory if it can't be read at an offset, like stdin
+func zipReader(r io.Reader) (*zip.Reader, error) {
+	if f, ok := r.(interface{ io.ReaderAt; Stat() (fs.FileInfo, error) }); ok {
+		if info, err := f.Stat(); err == nil {
+			return zip.NewReader(f, info.Size())
+		}
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(content), int64(len(content)))
+}
@@ -0,0 +1,124 @@
+package grep
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// builds a zip archive with the members in order
+func buildZip(t *testing.T, members [][2]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, member := range members {
+		w, err := zw.Create(member[0])
+		if err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+		if _, err := w.Write([]byte(member[1])); err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGrepZip(t *testing.T) {
+	var testFS fstest.MapFS = make(map[string]*fstest.MapFile)
+	testFS["logs.zip"] = &fstest.MapFile{Data: buildZip(t, [][2]string{
+		{"logs/app.log", "line1\nline2 error\nline3"},
+		{"logs/db.log", "error one\nline2\nerror two"},
+		{"logs/cache.log", "line1\nline2"},
+		{"README.md", "errors are logged"},
+	}), Mode: 0644}
+	testFS["broken.zip"] = &fstest.MapFile{Data: []byte("not a zip archive"), Mode: 0644}
+
+	testCases := []struct {
+		name     string
+		option   GrepOptions
+		paths    []string
+		lines    [][]string
+	}{
+		{
+			name:   "matched lines of each member",
+			option: GrepOptions{Path: "logs.zip", OrigPath: "logs.zip", Keyword: "error"},
+			paths:  []string{"logs.zip:README.md", "logs.zip:logs/app.log", "logs.zip:logs/db.log"},
+			lines:  [][]string{{"errors are logged"}, {"line2 error"}, {"error one", "error two"}},
+		},
+		{
+			name:   "extension filter",
+			option: GrepOptions{Path: "logs.zip", OrigPath: "logs.zip", Keyword: "error", IncludeExt: []string{"log"}},
+			paths:  []string{"logs.zip:logs/app.log", "logs.zip:logs/db.log"},
+			lines:  [][]string{{"line2 error"}, {"error one", "error two"}},
+		},
+		{
+			name:   "archive from stdin",
+			option: GrepOptions{Stdin: bytes.NewReader(testFS["logs.zip"].Data), Keyword: "line2"},
+			paths:  []string{"logs/app.log", "logs/cache.log", "logs/db.log"},
+			lines:  [][]string{{"line2 error"}, {"line2"}, {"line2"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := GrepZip(testFS, tc.option)
+			if len(got) != len(tc.paths) {
+				t.Fatalf("Expected %d results but got %v", len(tc.paths), got)
+			}
+			for i, res := range got {
+				if res.Error != nil {
+					t.Fatalf("Didn't expected an error: %v", res.Error)
+				}
+				if res.Path != tc.paths[i] || !slices.Equal(res.MatchedLines, tc.lines[i]) {
+					t.Errorf("Expected %s with %v but got %s with %v", tc.paths[i], tc.lines[i], res.Path, res.MatchedLines)
+				}
+			}
+		})
+	}
+
+	// errors are returned as results
+	if got := GrepZip(testFS, GrepOptions{Path: "missing.zip", OrigPath: "missing.zip", Keyword: "error"}); len(got) != 1 || !errors.Is(got[0].Error, fs.ErrNotExist) {
+		t.Errorf("Expected error %v but got %v", fs.ErrNotExist, got)
+	}
+	if got := GrepZip(testFS, GrepOptions{Path: "broken.zip", OrigPath: "broken.zip", Keyword: "error"}); len(got) != 1 || !errors.Is(got[0].Error, zip.ErrFormat) {
+		t.Errorf("Expected error %v but got %v", zip.ErrFormat, got)
+	}
+
+	// members which couldn't be read are reported with their path, after the results
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, member := range []struct{ name, content string; crc uint32 }{
+		{"a.log", "error one", crc32.ChecksumIEEE([]byte("error one"))},
+		{"b.log", "error two", 1},		// wrong checksum fails the read
+	} {
+		w, err := zw.CreateRaw(&zip.FileHeader{Name: member.name, Method: zip.Store, CRC32: member.crc, CompressedSize64: uint64(len(member.content)), UncompressedSize64: uint64(len(member.content))})
+		if err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+		if _, err := w.Write([]byte(member.content)); err != nil {
+			t.Fatalf("Unexpected error while setting up test: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Unexpected error while setting up test: %v", err)
+	}
+	testFS["corrupt.zip"] = &fstest.MapFile{Data: buf.Bytes(), Mode: 0644}
+	got := GrepZip(testFS, GrepOptions{Path: "corrupt.zip", OrigPath: "corrupt.zip", Keyword: "error"})
+	if len(got) != 2 || got[0].Path != "corrupt.zip:a.log" || !errors.Is(got[1].Error, zip.ErrChecksum) || !strings.HasPrefix(got[1].Error.Error(), "corrupt.zip:b.log: ") {
+		t.Errorf("Expected corrupt.zip:a.log and error of corrupt.zip:b.log but got %v", got)
+	}
+
+	// default excludes of directories don't apply to the members
+	testFS["vendor.zip"] = &fstest.MapFile{Data: buildZip(t, [][2]string{{"vendor/lib.log", "error"}}), Mode: 0644}
+	if got := GrepZip(testFS, GrepOptions{Path: "vendor.zip", OrigPath: "vendor.zip", Keyword: "error"}); len(got) != 1 || got[0].Path != "vendor.zip:vendor/lib.log" {
+		t.Errorf("Expected vendor.zip:vendor/lib.log but got %v", got)
+	}
+}